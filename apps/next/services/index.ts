@@ -188,10 +188,11 @@ export type Problem = {
   status: number;
   errors: Record<string, string>;
   reason: string;
+  current?: unknown; // Current representation of the resource when an update was based on an old version
 };
 
 const DEFAULT_PROBLEM: Problem = {
-  type: "https://httpstatuses.com",
+  type: "about:blank",
   message: "An unknown error occurred.",
   status: -999,
   errors: {},
@@ -222,12 +223,32 @@ export function parseProblem(error: unknown): Problem {
   if (data && typeof data === "object") {
     return {
       type: (data.type as string) ?? DEFAULT_PROBLEM.type,
-      message: (data.message as string) ?? DEFAULT_PROBLEM.message,
+      message: (data.detail as string) ?? DEFAULT_PROBLEM.message,
       status: (data.status as number) ?? DEFAULT_PROBLEM.status,
-      errors: (data.errors as Record<string, any>) ?? DEFAULT_PROBLEM.errors,
-      reason: (data.reason as string) ?? DEFAULT_PROBLEM.reason
+      errors: parseProblemErrors(data.errors),
+      reason: (data.title as string) ?? DEFAULT_PROBLEM.reason,
+      current: data.current
     };
   }
 
   return DEFAULT_PROBLEM;
 }
+
+// Problem errors are keyed by JSON pointers, such as "/fields/severity", while
+// forms name their fields with dot-separated paths, such as "fields.severity".
+function parseProblemErrors(errors: unknown): Record<string, string> {
+  if (!errors || typeof errors !== "object") {
+    return DEFAULT_PROBLEM.errors;
+  }
+
+  return Object.fromEntries(
+    Object.entries(errors as Record<string, string>).map(([pointer, message]) => [
+      pointer
+        .replace(/^\//, "")
+        .split("/")
+        .map((token) => token.replace(/~1/g, "/").replace(/~0/g, "~"))
+        .join("."),
+      message
+    ])
+  );
+}
@@ -4,6 +4,7 @@ import (
 	_ "github.com/prince272/konabra/docs/swagger"
 	"github.com/prince272/konabra/internal/builds"
 	"github.com/prince272/konabra/internal/handlers"
+	"github.com/prince272/konabra/internal/jobs"
 	"github.com/prince272/konabra/internal/repositories"
 	"github.com/prince272/konabra/internal/services"
 )
@@ -15,6 +16,9 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-Api-Key
 func main() {
 	// Initialize the API application
 	api := builds.NewApi()
@@ -22,21 +26,41 @@ func main() {
 	// Register the configuration for the application
 	api.RegisterCore()
 
+	// Apply or verify database migrations depending on DB_MIGRATE
+	api.Migrate()
+
 	// Register repositories in the application's container
 	api.Register(repositories.NewIdentityRepository)
 	api.Register(repositories.NewCategoryRepository)
 	api.Register(repositories.NewIncidentRepository)
+	api.Register(repositories.NewAuditRepository)
 
 	// Register services in the application's container
+	api.Register(services.NewAuditService)
 	api.Register(services.NewIdentityService)
 	api.Register(services.NewCategoryService)
 	api.Register(services.NewIncidentService)
+	api.Register(services.NewPrivacyService)
+	api.Register(services.NewSyncService)
+	api.Register(services.NewUssdService)
+	api.Register(services.NewSmsService)
 
 	// Register handlers in the application's container
 	api.Register(handlers.NewSwaggerHandler)
+	api.Register(handlers.NewProbeHandler)
+	api.Register(handlers.NewMetricsHandler)
+	api.Register(handlers.NewProblemHandler)
 	api.Register(handlers.NewIdentityHandler)
 	api.Register(handlers.NewCategoryHandler)
 	api.Register(handlers.NewIncidentHandler)
+	api.Register(handlers.NewAuditHandler)
+	api.Register(handlers.NewPrivacyHandler)
+	api.Register(handlers.NewSyncHandler)
+	api.Register(handlers.NewUssdHandler)
+	api.Register(handlers.NewSmsHandler)
+
+	// Register background jobs in the application's container
+	api.Register(jobs.NewErasureJob)
 
 	// Run the application (starts the server and handles requests)
 	api.Run()
@@ -0,0 +1,90 @@
+// Command konabra is the operator command-line interface. It manages the
+// database schema, seeds default data and bootstraps accounts using the same
+// configuration and wiring as the API server.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/prince272/konabra/internal/builds"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/seeds"
+	"github.com/prince272/konabra/internal/services"
+)
+
+const usage = `Usage: konabra <command> [arguments]
+
+Commands:
+  migrate up                 Apply all pending migrations
+  migrate down [-steps N]    Revert the last N applied migrations (default 1)
+  migrate status             List migrations and when they were applied
+  migrate verify             Fail when migrations are pending
+  migrate check              Fail when the models and the migrated schema disagree
+  seed [-demo N]             Seed roles and default categories, and optionally N demo incidents
+  user create [flags]        Create a verified account, run "konabra user create -h" for flags
+  token issue -user NAME     Issue an access token for an existing account
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+
+	switch command {
+	case "migrate":
+		runMigrate(args)
+	case "seed":
+		runSeed(args)
+	case "user":
+		runUser(args)
+	case "token":
+		runToken(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%v", command, usage)
+		os.Exit(2)
+	}
+}
+
+// newApi builds the application container without the HTTP handlers or background jobs
+func newApi() *builds.Api {
+	// Initialize the API application
+	api := builds.NewApi()
+
+	// Register the configuration for the application
+	api.RegisterCore()
+
+	// Register repositories in the application's container
+	api.Register(repositories.NewIdentityRepository)
+	api.Register(repositories.NewCategoryRepository)
+	api.Register(repositories.NewIncidentRepository)
+	api.Register(repositories.NewAuditRepository)
+
+	// Register services in the application's container
+	api.Register(services.NewAuditService)
+	api.Register(services.NewIdentityService)
+
+	// Register seeders in the application's container
+	api.Register(seeds.NewSeeder)
+
+	return api
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	os.Exit(1)
+}
+
+func failWithProblem(problem *problems.Problem) {
+	fmt.Fprintf(os.Stderr, "error: %v\n", problem.Detail)
+	for field, message := range problem.Errors {
+		fmt.Fprintf(os.Stderr, "  %v: %v\n", field, message)
+	}
+	os.Exit(1)
+}
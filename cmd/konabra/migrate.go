@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prince272/konabra/internal/migrations"
+)
+
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "up":
+		flags := flag.NewFlagSet("migrate up", flag.ExitOnError)
+		flags.Parse(args[1:])
+
+		newApi().Invoke(func(migrator *migrations.Migrator) {
+			applied, err := migrator.Up()
+			for _, migration := range applied {
+				fmt.Printf("applied %04d_%v\n", migration.Version, migration.Name)
+			}
+			if err != nil {
+				fail(err)
+			}
+			if len(applied) == 0 {
+				fmt.Println("no pending migrations")
+			}
+		})
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		flags.Parse(args[1:])
+
+		if *steps <= 0 {
+			fail(fmt.Errorf("steps must be greater than zero"))
+		}
+
+		newApi().Invoke(func(migrator *migrations.Migrator) {
+			reverted, err := migrator.Down(*steps)
+			for _, migration := range reverted {
+				fmt.Printf("reverted %04d_%v\n", migration.Version, migration.Name)
+			}
+			if err != nil {
+				fail(err)
+			}
+			if len(reverted) == 0 {
+				fmt.Println("no applied migrations")
+			}
+		})
+
+	case "status":
+		flags := flag.NewFlagSet("migrate status", flag.ExitOnError)
+		flags.Parse(args[1:])
+
+		newApi().Invoke(func(migrator *migrations.Migrator) {
+			statuses, err := migrator.Status()
+			if err != nil {
+				fail(err)
+			}
+
+			writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(writer, "VERSION\tNAME\tAPPLIED AT")
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.AppliedAt != nil {
+					appliedAt = status.AppliedAt.Format(time.RFC3339)
+				}
+				fmt.Fprintf(writer, "%04d\t%v\t%v\n", status.Version, status.Name, appliedAt)
+			}
+			writer.Flush()
+		})
+
+	case "verify":
+		flags := flag.NewFlagSet("migrate verify", flag.ExitOnError)
+		flags.Parse(args[1:])
+
+		newApi().Invoke(func(migrator *migrations.Migrator) {
+			if err := migrator.Verify(); err != nil {
+				fail(err)
+			}
+			fmt.Println("all migrations applied")
+		})
+
+	case "check":
+		flags := flag.NewFlagSet("migrate check", flag.ExitOnError)
+		flags.Parse(args[1:])
+
+		newApi().Invoke(func(migrator *migrations.Migrator) {
+			if err := migrator.Verify(); err != nil {
+				fail(err)
+			}
+
+			differences, err := migrator.Check(migrations.Models...)
+			if err != nil {
+				fail(err)
+			}
+
+			for _, difference := range differences {
+				fmt.Fprintln(os.Stderr, difference)
+			}
+			if len(differences) > 0 {
+				fail(fmt.Errorf("%d differences between the models and the migrations", len(differences)))
+			}
+			fmt.Println("models and migrations agree")
+		})
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%v", args[0], usage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/prince272/konabra/internal/seeds"
+)
+
+func runSeed(args []string) {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	demo := flags.Int("demo", 0, "number of demo incidents to create around Accra and Kumasi")
+	flags.Parse(args)
+
+	if *demo < 0 {
+		fail(fmt.Errorf("demo must not be negative"))
+	}
+
+	newApi().Invoke(func(seeder *seeds.Seeder) {
+		ctx := context.Background()
+
+		if err := seeder.SeedRoles(ctx); err != nil {
+			fail(err)
+		}
+		fmt.Println("seeded roles")
+
+		created, err := seeder.SeedCategories(ctx)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("seeded %d categories\n", created)
+
+		if *demo > 0 {
+			created, err := seeder.SeedDemoIncidents(ctx, *demo)
+			if err != nil {
+				fail(err)
+			}
+			fmt.Printf("seeded %d demo incidents\n", created)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/prince272/konabra/internal/services"
+)
+
+func runToken(args []string) {
+	if len(args) == 0 || args[0] != "issue" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("token issue", flag.ExitOnError)
+	user := flags.String("user", "", "email address or phone number of the account")
+	asJson := flags.Bool("json", false, "print the full token response as JSON instead of only the access token")
+	flags.Parse(args[1:])
+
+	if *user == "" {
+		fail(fmt.Errorf("-user is required"))
+	}
+
+	newApi().Invoke(func(identityService *services.IdentityService) {
+		account, problem := identityService.IssueToken(context.Background(), *user)
+		if problem != nil {
+			failWithProblem(problem)
+		}
+
+		if !*asJson {
+			fmt.Println(account.AccessToken)
+			return
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(account); err != nil {
+			fail(err)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/services"
+)
+
+func runUser(args []string) {
+	if len(args) == 0 || args[0] != "create" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("user create", flag.ExitOnError)
+	email := flags.String("email", "", "email address of the account")
+	phone := flags.String("phone", "", "phone number of the account, used when no email is given")
+	firstName := flags.String("first-name", "", "first name")
+	lastName := flags.String("last-name", "", "last name")
+	password := flags.String("password", os.Getenv("KONABRA_PASSWORD"), "password, defaults to $KONABRA_PASSWORD")
+	admin := flags.Bool("admin", false, "add the account to the Administrator role")
+	flags.Parse(args[1:])
+
+	username := *email
+	if username == "" {
+		username = *phone
+	}
+
+	if username == "" {
+		fail(fmt.Errorf("either -email or -phone is required"))
+	}
+
+	roleNames := []string{}
+	if *admin {
+		roleNames = append(roleNames, models.RoleAdministrator)
+	}
+
+	newApi().Invoke(func(identityService *services.IdentityService) {
+		account, problem := identityService.CreateVerifiedAccount(context.Background(), services.CreateAccountForm{
+			FirstName: *firstName,
+			LastName:  *lastName,
+			Username:  username,
+			Password:  *password,
+		}, roleNames...)
+
+		if problem != nil {
+			failWithProblem(problem)
+		}
+
+		fmt.Printf("created account %v (%v) with roles %v\n", account.Id, username, account.Roles)
+	})
+}
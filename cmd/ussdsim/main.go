@@ -0,0 +1,88 @@
+// Command ussdsim simulates a USSD aggregator against a running api, so that
+// the USSD menus can be tried from a terminal. Every line typed is sent as the
+// input of the current screen, the way a phone network forwards it.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func main() {
+	endpoint := flag.String("url", "http://localhost:8000/ussd", "USSD callback url of the api")
+	phoneNumber := flag.String("phone", "+233240000000", "phone number of the simulated caller")
+	serviceCode := flag.String("code", "*920*44#", "service code dialled by the caller")
+	secret := flag.String("secret", os.Getenv("USSD_SECRET"), "secret shared with the aggregator, defaults to USSD_SECRET")
+	language := flag.String("lang", "", "Accept-Language sent with the callbacks, such as tw or fr")
+	flag.Parse()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	sessionId := uuid.New().String()
+	input := bufio.NewScanner(os.Stdin)
+
+	var typed []string
+	for {
+		reply, err := send(client, *endpoint, *secret, *language, url.Values{
+			"sessionId":   {sessionId},
+			"serviceCode": {*serviceCode},
+			"phoneNumber": {*phoneNumber},
+			"text":        {strings.Join(typed, "*")},
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		message, more := strings.CutPrefix(reply, "CON ")
+		if !more {
+			fmt.Println(strings.TrimPrefix(reply, "END "))
+			return
+		}
+
+		fmt.Println(message)
+		fmt.Print("> ")
+		if !input.Scan() {
+			fmt.Println()
+			return
+		}
+		typed = append(typed, strings.TrimSpace(input.Text()))
+	}
+}
+
+// send posts a callback the way aggregators do and returns the screen sent back
+func send(client *http.Client, endpoint string, secret string, language string, values url.Values) (string, error) {
+	request, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(values.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("X-Ussd-Secret", secret)
+	if language != "" {
+		request.Header.Set("Accept-Language", language)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the api answered %v: %s", response.Status, body)
+	}
+
+	return string(body), nil
+}
@@ -1,23 +1,30 @@
 package builds
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
-	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
 	"github.com/knadh/koanf/parsers/dotenv"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
 	"github.com/knadh/koanf/v2"
 	"github.com/prince272/konabra/internal/helpers"
-	models "github.com/prince272/konabra/internal/models"
-
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/metrics"
+	"github.com/prince272/konabra/internal/migrations"
+	"github.com/prince272/konabra/internal/probes"
 	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/tracing"
 	"github.com/prince272/konabra/pkg/di"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -34,11 +41,25 @@ type Config struct {
 	Env          string `koanf:"ENV"`
 	Port         string `koanf:"PORT"`
 	AllowOrigins string `koanf:"ALLOW_ORIGINS"`
+	WebUrl       string `koanf:"WEB_URL"`
+
+	HttpReadTimeout     time.Duration `koanf:"HTTP_READ_TIMEOUT"`
+	HttpWriteTimeout    time.Duration `koanf:"HTTP_WRITE_TIMEOUT"`
+	HttpIdleTimeout     time.Duration `koanf:"HTTP_IDLE_TIMEOUT"`
+	HttpShutdownTimeout time.Duration `koanf:"HTTP_SHUTDOWN_TIMEOUT"`
+	HttpDrainDelay      time.Duration `koanf:"HTTP_DRAIN_DELAY"` // Time /readyz reports draining before the listener closes
 
 	DbDefault string `koanf:"DB_DEFAULT"`
+	DbMigrate string `koanf:"DB_MIGRATE"` // "up", "verify" or "off"
 
-	LogLevel string `koanf:"LOG_LEVEL"`
-	LogFile  string `koanf:"LOG_OUTPUT"`
+	LogLevel          string `koanf:"LOG_LEVEL"`
+	LogFile           string `koanf:"LOG_OUTPUT"`
+	LogRedactDisabled bool   `koanf:"LOG_REDACT_DISABLED"` // Only honoured in development
+
+	TracingExporter    string  `koanf:"TRACING_EXPORTER"` // "none", "stdout" or "otlp"
+	TracingEndpoint    string  `koanf:"TRACING_ENDPOINT"`
+	TracingServiceName string  `koanf:"TRACING_SERVICE_NAME"`
+	TracingSampleRatio float64 `koanf:"TRACING_SAMPLE_RATIO"`
 
 	JwtAuthSecret   string `koanf:"JWT_AUTH_SECRET"`
 	JwtAUthIssuer   string `koanf:"JWT_AUTH_ISSUER"`
@@ -50,8 +71,57 @@ type Config struct {
 	SmtpPort     int    `koanf:"SMTP_PORT"`
 	SmtpUsername string `koanf:"SMTP_USERNAME"`
 	SmtpPassword string `koanf:"SMTP_PASSWORD"`
+	SmtpFrom     string `koanf:"SMTP_FROM"` // Address codes and links are emailed from, SMTP_USERNAME when empty
+
+	CodeTtlVerifyAccount time.Duration `koanf:"CODE_TTL_VERIFY_ACCOUNT"`
+	CodeTtlChangeAccount time.Duration `koanf:"CODE_TTL_CHANGE_ACCOUNT"`
+	CodeTtlResetPassword time.Duration `koanf:"CODE_TTL_RESET_PASSWORD"`
+	CodeTtlSignIn        time.Duration `koanf:"CODE_TTL_SIGN_IN"`
+	CodeMaxAttempts      int           `koanf:"CODE_MAX_ATTEMPTS"`
+	CodeResendCooldown   time.Duration `koanf:"CODE_RESEND_COOLDOWN"`
+	CodeLockout          time.Duration `koanf:"CODE_LOCKOUT"`
+
+	PasswordMinLength  int `koanf:"PASSWORD_MIN_LENGTH"`
+	PasswordMinClasses int `koanf:"PASSWORD_MIN_CLASSES"`
+	PasswordMaxRepeats int `koanf:"PASSWORD_MAX_REPEATS"`
+	PasswordHistory    int `koanf:"PASSWORD_HISTORY"`
+
+	ErasureGracePeriod time.Duration `koanf:"ERASURE_GRACE_PERIOD"`
+
+	QueryTimeout       time.Duration `koanf:"QUERY_TIMEOUT"`
+	QueryTimeoutReport time.Duration `koanf:"QUERY_TIMEOUT_REPORT"`
+
+	RateLimitStore          string `koanf:"RATE_LIMIT_STORE"` // "memory" or "database"
+	RateLimitIp             string `koanf:"RATE_LIMIT_IP"`
+	RateLimitUser           string `koanf:"RATE_LIMIT_USER"`
+	RateLimitSignIn         string `koanf:"RATE_LIMIT_SIGN_IN"`
+	RateLimitCode           string `koanf:"RATE_LIMIT_CODE"`
+	RateLimitIncidentCreate string `koanf:"RATE_LIMIT_INCIDENT_CREATE"`
+
+	IdempotencyStore     string        `koanf:"IDEMPOTENCY_STORE"` // "memory" or "database"
+	IdempotencyRetention time.Duration `koanf:"IDEMPOTENCY_RETENTION"`
+
+	PhoneDefaultRegion string `koanf:"PHONE_DEFAULT_REGION"` // Region of phone numbers received without a country code
+
+	UssdSecret         string        `koanf:"USSD_SECRET"` // Shared with the USSD aggregator, the USSD channel is off when empty
+	UssdSessionTimeout time.Duration `koanf:"USSD_SESSION_TIMEOUT"`
+
+	SmsSecret       string `koanf:"SMS_SECRET"`        // Shared with the SMS provider, the inbound SMS channel is off when empty
+	SmsFromFields   string `koanf:"SMS_FROM_FIELDS"`   // Comma-separated payload fields holding the sender, the first one present is used
+	SmsTextFields   string `koanf:"SMS_TEXT_FIELDS"`   // Comma-separated payload fields holding the message
+	SmsIdFields     string `koanf:"SMS_ID_FIELDS"`     // Comma-separated payload fields holding the message id, used to ignore redeliveries
+	SmsSender       string `koanf:"SMS_SENDER"`        // "log" or "http"
+	SmsGatewayUrl   string `koanf:"SMS_GATEWAY_URL"`   // Messages are posted here when SMS_SENDER is http
+	SmsGatewayToken string `koanf:"SMS_GATEWAY_TOKEN"` // Bearer token of the gateway
+	SmsSenderId     string `koanf:"SMS_SENDER_ID"`     // Name or number messages appear to come from
 }
 
+var (
+	DbMigrateUp     = "up"     // Apply pending migrations at startup
+	DbMigrateVerify = "verify" // Refuse to start while migrations are pending
+	DbMigrateOff    = "off"    // Do not check migrations at startup
+)
+
 func (config *Config) IsDevelopment() bool {
 	return config.Env == "development"
 }
@@ -69,7 +139,7 @@ func (api *Api) registerConfig() error {
 		if err := k.Load(file.Provider(".env"), dotenv.Parser()); err != nil {
 			return fmt.Errorf("error loading .env file: %w", err)
 		}
-		fmt.Println("Loaded .env file")
+		fmt.Fprintln(os.Stderr, "Loaded .env file")
 	}
 
 	// Load environment variables
@@ -79,7 +149,7 @@ func (api *Api) registerConfig() error {
 		return fmt.Errorf("error loading env vars: %w", err)
 	}
 
-	fmt.Println("Loaded environment variables")
+	fmt.Fprintln(os.Stderr, "Loaded environment variables")
 
 	var cfg *Config
 	if err := k.Unmarshal("", &cfg); err != nil {
@@ -94,6 +164,174 @@ func (api *Api) registerConfig() error {
 		cfg.Port = "8000"
 	}
 
+	if cfg.HttpReadTimeout <= 0 {
+		cfg.HttpReadTimeout = 15 * time.Second
+	}
+
+	if cfg.HttpWriteTimeout <= 0 {
+		cfg.HttpWriteTimeout = 60 * time.Second
+	}
+
+	if cfg.HttpIdleTimeout <= 0 {
+		cfg.HttpIdleTimeout = 120 * time.Second
+	}
+
+	if cfg.HttpShutdownTimeout <= 0 {
+		cfg.HttpShutdownTimeout = 30 * time.Second
+	}
+
+	if cfg.HttpDrainDelay <= 0 {
+		cfg.HttpDrainDelay = 5 * time.Second
+	}
+
+	if cfg.TracingExporter == "" {
+		cfg.TracingExporter = tracing.ExporterNone
+	}
+
+	if cfg.TracingServiceName == "" {
+		cfg.TracingServiceName = "konabra-api"
+	}
+
+	if cfg.TracingSampleRatio <= 0 || cfg.TracingSampleRatio > 1 {
+		cfg.TracingSampleRatio = 1
+	}
+
+	switch cfg.DbMigrate {
+	case "":
+		cfg.DbMigrate = DbMigrateUp
+	case DbMigrateUp, DbMigrateVerify, DbMigrateOff:
+	default:
+		return fmt.Errorf("invalid DB_MIGRATE value %q, expected %q, %q or %q", cfg.DbMigrate, DbMigrateUp, DbMigrateVerify, DbMigrateOff)
+	}
+
+	if cfg.CodeTtlVerifyAccount <= 0 {
+		cfg.CodeTtlVerifyAccount = 15 * time.Minute
+	}
+
+	if cfg.CodeTtlChangeAccount <= 0 {
+		cfg.CodeTtlChangeAccount = 15 * time.Minute
+	}
+
+	if cfg.CodeTtlResetPassword <= 0 {
+		cfg.CodeTtlResetPassword = 10 * time.Minute
+	}
+
+	if cfg.CodeTtlSignIn <= 0 {
+		cfg.CodeTtlSignIn = 10 * time.Minute
+	}
+
+	if cfg.CodeMaxAttempts <= 0 {
+		cfg.CodeMaxAttempts = 5
+	}
+
+	if cfg.CodeResendCooldown <= 0 {
+		cfg.CodeResendCooldown = 1 * time.Minute
+	}
+
+	if cfg.CodeLockout <= 0 {
+		cfg.CodeLockout = 15 * time.Minute
+	}
+
+	if cfg.PasswordMinLength <= 0 {
+		cfg.PasswordMinLength = 8
+	}
+
+	if cfg.PasswordMinClasses <= 0 {
+		cfg.PasswordMinClasses = 3
+	}
+
+	if cfg.PasswordMaxRepeats <= 0 {
+		cfg.PasswordMaxRepeats = 3
+	}
+
+	if cfg.PasswordHistory <= 0 {
+		cfg.PasswordHistory = 5
+	}
+
+	if cfg.ErasureGracePeriod <= 0 {
+		cfg.ErasureGracePeriod = 30 * 24 * time.Hour
+	}
+
+	if cfg.QueryTimeout <= 0 {
+		cfg.QueryTimeout = 10 * time.Second
+	}
+
+	if cfg.QueryTimeoutReport <= 0 {
+		cfg.QueryTimeoutReport = 30 * time.Second
+	}
+
+	switch cfg.RateLimitStore {
+	case "":
+		cfg.RateLimitStore = helpers.RateLimitStoreMemory
+	case helpers.RateLimitStoreMemory, helpers.RateLimitStoreDatabase:
+	default:
+		return fmt.Errorf("invalid RATE_LIMIT_STORE value %q, expected %q or %q", cfg.RateLimitStore, helpers.RateLimitStoreMemory, helpers.RateLimitStoreDatabase)
+	}
+
+	if cfg.RateLimitIp == "" {
+		cfg.RateLimitIp = "300/1m"
+	}
+
+	if cfg.RateLimitUser == "" {
+		cfg.RateLimitUser = "600/1m"
+	}
+
+	if cfg.RateLimitSignIn == "" {
+		cfg.RateLimitSignIn = "10/1m"
+	}
+
+	if cfg.RateLimitCode == "" {
+		cfg.RateLimitCode = "5/10m"
+	}
+
+	if cfg.RateLimitIncidentCreate == "" {
+		cfg.RateLimitIncidentCreate = "30/1h"
+	}
+
+	switch cfg.IdempotencyStore {
+	case "":
+		cfg.IdempotencyStore = helpers.IdempotencyStoreMemory
+	case helpers.IdempotencyStoreMemory, helpers.IdempotencyStoreDatabase:
+	default:
+		return fmt.Errorf("invalid IDEMPOTENCY_STORE value %q, expected %q or %q", cfg.IdempotencyStore, helpers.IdempotencyStoreMemory, helpers.IdempotencyStoreDatabase)
+	}
+
+	if cfg.IdempotencyRetention <= 0 {
+		cfg.IdempotencyRetention = 24 * time.Hour
+	}
+
+	if cfg.PhoneDefaultRegion == "" {
+		cfg.PhoneDefaultRegion = "GH"
+	}
+
+	if cfg.UssdSessionTimeout <= 0 {
+		cfg.UssdSessionTimeout = 3 * time.Minute
+	}
+
+	if cfg.SmsFromFields == "" {
+		cfg.SmsFromFields = "from,From,msisdn,sender,phoneNumber"
+	}
+
+	if cfg.SmsTextFields == "" {
+		cfg.SmsTextFields = "text,Text,Body,body,message,content,Content"
+	}
+
+	if cfg.SmsIdFields == "" {
+		cfg.SmsIdFields = "id,messageId,MessageSid,SmsSid,linkId"
+	}
+
+	switch cfg.SmsSender {
+	case "":
+		cfg.SmsSender = helpers.SmsSenderLog
+	case helpers.SmsSenderLog:
+	case helpers.SmsSenderHttp:
+		if cfg.SmsGatewayUrl == "" {
+			return fmt.Errorf("SMS_GATEWAY_URL is required when SMS_SENDER is %q", helpers.SmsSenderHttp)
+		}
+	default:
+		return fmt.Errorf("invalid SMS_SENDER value %q, expected %q or %q", cfg.SmsSender, helpers.SmsSenderLog, helpers.SmsSenderHttp)
+	}
+
 	return api.container.Register(func() *Config {
 		return cfg
 	})
@@ -136,8 +374,16 @@ func (api *Api) registerLogger() error {
 		))
 	}
 
+	core := zapcore.NewTee(cores...)
+
+	// Passwords, codes and tokens are kept out of the logs unless explicitly
+	// allowed while developing, where codes are not always delivered
+	if !(isDev && cfg.LogRedactDisabled) {
+		core = logging.NewRedactingCore(core)
+	}
+
 	return api.container.Register(func() *zap.Logger {
-		return zap.New(zapcore.NewTee(cores...), zap.AddCaller())
+		return zap.New(core, zap.AddCaller())
 	})
 }
 
@@ -149,6 +395,7 @@ func (api *Api) registerSmtp() error {
 		Port:     cfg.SmtpPort,
 		Username: cfg.SmtpUsername,
 		Password: cfg.SmtpPassword,
+		From:     cfg.SmtpFrom,
 	})
 
 	if err != nil {
@@ -160,9 +407,89 @@ func (api *Api) registerSmtp() error {
 	})
 }
 
+func (api *Api) registerSmsSender() error {
+	cfg := di.MustGet[*Config](api.container)
+	logger := di.MustGet[*zap.Logger](api.container)
+
+	var sender helpers.SmsSender = helpers.NewLogSmsSender(logger)
+	if cfg.SmsSender == helpers.SmsSenderHttp {
+		sender = helpers.NewHttpSmsSender(helpers.HttpSmsSenderOptions{
+			Url:      cfg.SmsGatewayUrl,
+			Token:    cfg.SmsGatewayToken,
+			SenderId: cfg.SmsSenderId,
+		})
+	}
+
+	return api.container.Register(func() helpers.SmsSender {
+		return sender
+	})
+}
+
+func (api *Api) registerMetrics() error {
+	registry, err := metrics.NewMetrics()
+	if err != nil {
+		return fmt.Errorf("failed to create metrics: %w", err)
+	}
+
+	return api.container.Register(func() *metrics.Metrics {
+		return registry
+	})
+}
+
+func (api *Api) registerLifecycle() error {
+	return api.container.Register(func() *helpers.Lifecycle {
+		return helpers.NewLifecycle()
+	})
+}
+
+func (api *Api) registerTracing() error {
+	cfg := di.MustGet[*Config](api.container)
+	lifecycle := di.MustGet[*helpers.Lifecycle](api.container)
+
+	provider, err := tracing.NewTracing(tracing.Options{
+		ServiceName: cfg.TracingServiceName,
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+
+	lifecycle.OnShutdown("tracing", provider.Shutdown)
+
+	return api.container.Register(func() *tracing.Tracing {
+		return provider
+	})
+}
+
 func (api *Api) registerState() error {
+	lifecycle := di.MustGet[*helpers.Lifecycle](api.container)
+
+	state := helpers.NewState()
+	lifecycle.OnShutdown("state", func(ctx context.Context) error {
+		state.Close()
+		return nil
+	})
+
 	return api.container.Register(func() *helpers.State {
-		return helpers.NewState()
+		return state
+	})
+}
+
+func (api *Api) registerCodeStore() error {
+	state := di.MustGet[*helpers.State](api.container)
+
+	return api.container.Register(func() *helpers.CodeStore {
+		return helpers.NewCodeStore(state)
+	})
+}
+
+func (api *Api) registerChallengeStore() error {
+	state := di.MustGet[*helpers.State](api.container)
+
+	return api.container.Register(func() *helpers.ChallengeStore {
+		return helpers.NewChallengeStore(state)
 	})
 }
 
@@ -182,15 +509,14 @@ func (api *Api) registerDefaultDB() error {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err := db.AutoMigrate(
-		&models.User{},
-		&models.Role{},
-		&models.JwtToken{},
-		&models.Category{},
-		&models.Incident{},
-		&models.IncidentActivity{},
-	); err != nil {
-		return fmt.Errorf("auto migration failed: %w", err)
+	registry := di.MustGet[*metrics.Metrics](api.container)
+	if err := registry.InstrumentDB(db); err != nil {
+		return fmt.Errorf("failed to instrument database: %w", err)
+	}
+
+	provider := di.MustGet[*tracing.Tracing](api.container)
+	if err := provider.InstrumentDB(db); err != nil {
+		return fmt.Errorf("failed to trace database: %w", err)
 	}
 
 	sqlDB, err := db.DB()
@@ -203,19 +529,69 @@ func (api *Api) registerDefaultDB() error {
 	sqlDB.SetMaxOpenConns(10)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	if err := registry.RegisterDBStats(sqlDB, "default"); err != nil {
+		return fmt.Errorf("failed to register database metrics: %w", err)
+	}
+
+	lifecycle := di.MustGet[*helpers.Lifecycle](api.container)
+	lifecycle.OnShutdown("database", func(ctx context.Context) error {
+		return sqlDB.Close()
+	})
+
 	return api.container.Register(func() *DefaultDB {
 		return &DefaultDB{DB: db}
 	})
 }
 
+func (api *Api) registerProber() error {
+	defaultDB := di.MustGet[*DefaultDB](api.container)
+	smtp := di.MustGet[*helpers.Smtp](api.container)
+
+	prober := probes.NewProber(3 * time.Second)
+	prober.AddCheck("database", func(ctx context.Context) error {
+		sqlDB, err := defaultDB.DB.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	})
+	prober.AddCheck("smtp", smtp.Ping)
+
+	return api.container.Register(func() *probes.Prober {
+		return prober
+	})
+}
+
+func (api *Api) registerMigrator() error {
+	defaultDB := di.MustGet[*DefaultDB](api.container)
+	logger := di.MustGet[*zap.Logger](api.container)
+
+	migrator, err := migrations.NewMigrator(defaultDB.DB, logger)
+	if err != nil {
+		return err
+	}
+
+	return api.container.Register(func() *migrations.Migrator {
+		return migrator
+	})
+}
+
 func (api *Api) registerRouter() error {
 
 	router := gin.New()
 	logger := di.MustGet[*zap.Logger](api.container)
 	config := di.MustGet[*Config](api.container)
+	apiKeyHelper := di.MustGet[*helpers.ApiKeyHelper](api.container)
+	rateLimiter := di.MustGet[*helpers.RateLimiter](api.container)
+	idempotency := di.MustGet[*helpers.Idempotency](api.container)
+	registry := di.MustGet[*metrics.Metrics](api.container)
+	provider := di.MustGet[*tracing.Tracing](api.container)
 
 	// Add middlewares
-	router.Use(ginzap.RecoveryWithZap(logger, true))
+	router.Use(provider.Middleware())
+	router.Use(logging.Middleware(logger))
+	router.Use(locales.Middleware())
+	router.Use(registry.Middleware())
 	router.Use(gin.CustomRecovery(func(c *gin.Context, unknownErr any) {
 		var err error
 		switch e := unknownErr.(type) {
@@ -225,25 +601,40 @@ func (api *Api) registerRouter() error {
 			err = fmt.Errorf("%v", unknownErr)
 		}
 
-		logger.Error("Panic recovered",
+		// A panic caused by a deadline or a disconnected client is still answered
+		// with 504 or 499, and is not reported as a server error
+		problem := problems.FromError(err)
+		fields := []zap.Field{
 			zap.Any("error", err),
 			zap.String("method", c.Request.Method),
 			zap.String("path", c.Request.URL.Path),
-			zap.Int("status_code", http.StatusInternalServerError),
-		)
-		c.JSON(http.StatusInternalServerError, problems.FromError(err))
+			zap.Int("status_code", problem.Status),
+		}
+		level := zapcore.WarnLevel
+		if problem.Status == http.StatusInternalServerError {
+			level = zapcore.ErrorLevel
+			fields = append(fields, zap.Stack("stack"))
+		}
+
+		logging.FromContext(c.Request.Context(), logger).Log(level, "Panic recovered", fields...)
+		problems.Abort(c, problem)
 	}))
 
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     strings.Split(config.AllowOrigins, ","),
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "Accept-Language", "If-Match", "If-None-Match", "If-Modified-Since", helpers.IdempotencyKeyHeader, helpers.ApiKeyHeader, logging.RequestIdHeader},
+		ExposeHeaders:    []string{"Content-Length", "Content-Language", "ETag", "Last-Modified", logging.RequestIdHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", helpers.IdempotentReplayedHeader},
 		AllowCredentials: true,
 	}))
 
+	router.Use(helpers.CaptureRequestInfo())
+	router.Use(rateLimiter.Limit(helpers.RateLimitIp, helpers.RateLimitByIp))
+	router.Use(apiKeyHelper.Authenticate())
+	router.Use(idempotency.Middleware())
+
 	router.NoRoute(func(c *gin.Context) {
-		c.JSON(http.StatusNotFound, problems.NewProblem(http.StatusNotFound, "The requested resource was not found on this server."))
+		problems.Write(c, problems.NewProblem(http.StatusNotFound, "The requested resource was not found on this server."))
 	})
 
 	return api.container.Register(func() *gin.Engine {
@@ -252,7 +643,14 @@ func (api *Api) registerRouter() error {
 }
 
 func (api *Api) registerValidator() error {
-	validator, err := helpers.NewValidator()
+	cfg := di.MustGet[*Config](api.container)
+
+	validator, err := helpers.NewValidator(helpers.PasswordPolicy{
+		MinLength:  cfg.PasswordMinLength,
+		MaxLength:  256,
+		MinClasses: cfg.PasswordMinClasses,
+		MaxRepeats: cfg.PasswordMaxRepeats,
+	})
 
 	if err != nil {
 		return err
@@ -280,6 +678,70 @@ func (api *Api) registerJwtHelper() error {
 	})
 }
 
+func (api *Api) registerApiKeyHelper() error {
+	defaultDB := di.MustGet[*DefaultDB](api.container)
+	deadlines := di.MustGet[*helpers.QueryDeadlines](api.container)
+	logger := di.MustGet[*zap.Logger](api.container)
+
+	return api.container.Register(func() *helpers.ApiKeyHelper {
+		return helpers.NewApiKeyHelper(defaultDB.DB, deadlines, logger)
+	})
+}
+
+func (api *Api) registerQueryDeadlines() error {
+	cfg := di.MustGet[*Config](api.container)
+
+	return api.container.Register(func() *helpers.QueryDeadlines {
+		return helpers.NewQueryDeadlines(cfg.QueryTimeout, cfg.QueryTimeoutReport)
+	})
+}
+
+func (api *Api) registerRateLimiter() error {
+	cfg := di.MustGet[*Config](api.container)
+	defaultDB := di.MustGet[*DefaultDB](api.container)
+	registry := di.MustGet[*metrics.Metrics](api.container)
+	logger := di.MustGet[*zap.Logger](api.container)
+
+	policies := map[string]helpers.RateLimit{}
+	for policy, value := range map[string]string{
+		helpers.RateLimitIp:             cfg.RateLimitIp,
+		helpers.RateLimitUser:           cfg.RateLimitUser,
+		helpers.RateLimitSignIn:         cfg.RateLimitSignIn,
+		helpers.RateLimitCode:           cfg.RateLimitCode,
+		helpers.RateLimitIncidentCreate: cfg.RateLimitIncidentCreate,
+	} {
+		limit, err := helpers.ParseRateLimit(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s rate limit: %w", policy, err)
+		}
+		policies[policy] = limit
+	}
+
+	var store helpers.RateLimitStore = helpers.NewMemoryRateLimitStore()
+	if cfg.RateLimitStore == helpers.RateLimitStoreDatabase {
+		store = helpers.NewDatabaseRateLimitStore(defaultDB.DB, logger)
+	}
+
+	return api.container.Register(func() *helpers.RateLimiter {
+		return helpers.NewRateLimiter(store, policies, registry, logger)
+	})
+}
+
+func (api *Api) registerIdempotency() error {
+	cfg := di.MustGet[*Config](api.container)
+	defaultDB := di.MustGet[*DefaultDB](api.container)
+	logger := di.MustGet[*zap.Logger](api.container)
+
+	var store helpers.IdempotencyStore = helpers.NewMemoryIdempotencyStore()
+	if cfg.IdempotencyStore == helpers.IdempotencyStoreDatabase {
+		store = helpers.NewDatabaseIdempotencyStore(defaultDB.DB, logger)
+	}
+
+	return api.container.Register(func() *helpers.Idempotency {
+		return helpers.NewIdempotency(store, cfg.IdempotencyRetention, logger)
+	})
+}
+
 func NewApi() *Api {
 	container := di.New()
 	return &Api{container: container}
@@ -296,10 +758,22 @@ func (api *Api) RegisterCore() {
 	services := []func() error{
 		api.registerConfig,
 		api.registerLogger,
+		api.registerMetrics,
+		api.registerLifecycle,
+		api.registerTracing,
 		api.registerSmtp,
+		api.registerSmsSender,
 		api.registerState,
+		api.registerCodeStore,
+		api.registerChallengeStore,
 		api.registerDefaultDB,
+		api.registerMigrator,
+		api.registerProber,
 		api.registerJwtHelper,
+		api.registerQueryDeadlines,
+		api.registerApiKeyHelper,
+		api.registerRateLimiter,
+		api.registerIdempotency,
 		api.registerValidator,
 		api.registerRouter,
 	}
@@ -311,14 +785,87 @@ func (api *Api) RegisterCore() {
 	}
 }
 
+// Invoke calls the function with its parameters resolved from the container
+func (api *Api) Invoke(function any) {
+	if err := api.container.Invoke(function); err != nil {
+		panic(fmt.Errorf("failed to invoke function: %w", err))
+	}
+}
+
+// Migrate applies or verifies the database migrations according to DB_MIGRATE
+func (api *Api) Migrate() {
+	cfg := di.MustGet[*Config](api.container)
+	migrator := di.MustGet[*migrations.Migrator](api.container)
+
+	switch cfg.DbMigrate {
+	case DbMigrateUp:
+		if _, err := migrator.Up(); err != nil {
+			panic(fmt.Errorf("failed to apply migrations: %w", err))
+		}
+	case DbMigrateVerify:
+		if err := migrator.Verify(); err != nil {
+			panic(fmt.Errorf("failed to verify migrations: %w", err))
+		}
+	}
+}
+
+// Run serves requests until SIGINT or SIGTERM is received, then stops accepting
+// traffic, drains in-flight requests and runs the shutdown hooks
 func (api *Api) Run() {
 	router := di.MustGet[*gin.Engine](api.container)
 	cfg := di.MustGet[*Config](api.container)
+	logger := di.MustGet[*zap.Logger](api.container)
+	prober := di.MustGet[*probes.Prober](api.container)
+	lifecycle := di.MustGet[*helpers.Lifecycle](api.container)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%v", cfg.Port),
+		Handler:           router,
+		ReadTimeout:       cfg.HttpReadTimeout,
+		ReadHeaderTimeout: cfg.HttpReadTimeout,
+		WriteTimeout:      cfg.HttpWriteTimeout,
+		IdleTimeout:       cfg.HttpIdleTimeout,
+	}
 
-	port := cfg.Port
-	addr := fmt.Sprintf(":%v", port)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Server listening", zap.String("addr", server.Addr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
 
-	if err := router.Run(addr); err != nil {
-		panic(fmt.Errorf("server failed: %w", err))
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			panic(fmt.Errorf("server failed: %w", err))
+		}
+	case <-ctx.Done():
 	}
+
+	stop()
+	logger.Info("Shutting down server")
+	prober.SetDraining()
+
+	// Requests keep being served while load balancers notice that /readyz
+	// reports draining and stop routing new ones here
+	time.Sleep(cfg.HttpDrainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.HttpShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error draining server: ", zap.Error(err))
+	}
+
+	if err := lifecycle.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Error running shutdown hooks: ", zap.Error(err))
+	}
+
+	logger.Info("Server stopped")
+	logger.Sync()
 }
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/constants"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/services"
+)
+
+// AuditHandler handles audit log routes
+type AuditHandler struct {
+	auditService *services.AuditService
+	jwtHelper    *helpers.JwtHelper
+}
+
+// NewAuditHandler registers audit routes
+func NewAuditHandler(router *gin.Engine, auditService *services.AuditService, jwtHelper *helpers.JwtHelper, deadlines *helpers.QueryDeadlines) *AuditHandler {
+	handler := &AuditHandler{auditService, jwtHelper}
+
+	auditGroup := router.Group("/audit", jwtHelper.RequireAuth(models.RoleAdministrator), deadlines.Standard())
+	{
+		auditGroup.GET("", handler.handleWithData(handler.GetPaginatedAuditEvents))
+	}
+
+	router.GET("/account/activity", jwtHelper.RequireAuth(), deadlines.Standard(), handler.handleWithData(handler.GetSecurityActivity))
+
+	return handler
+}
+
+func (handler *AuditHandler) handleWithData(handlerFunc func(*gin.Context) (any, *problems.Problem)) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		response, problem := handlerFunc(context)
+		if problem != nil {
+			problems.Write(context, problem)
+			return
+		}
+		helpers.WriteCachedJSON(context, http.StatusOK, response)
+	}
+}
+
+// GetPaginatedAuditEvents retrieves audit events with filtering and pagination
+// @Summary Get paginated audit events
+// @Tags Audit
+// @Accept json
+// @Produce json
+// @Param filter query repositories.AuditEventPaginatedFilter false "Audit event filter"
+// @Security BearerAuth
+// @Router /audit [get]
+func (handler *AuditHandler) GetPaginatedAuditEvents(context *gin.Context) (any, *problems.Problem) {
+	var filter repositories.AuditEventPaginatedFilter
+	if err := context.ShouldBindQuery(&filter); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	return handler.auditService.GetPaginatedAuditEvents(context.Request.Context(), filter)
+}
+
+// GetSecurityActivity retrieves recent security events for the current account
+// @Summary Get current account security activity
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Router /account/activity [get]
+func (handler *AuditHandler) GetSecurityActivity(context *gin.Context) (any, *problems.Problem) {
+	userId := context.MustGet(constants.ContextClaimsKey).(map[string]any)["sub"].(string)
+	return handler.auditService.GetSecurityActivity(context.Request.Context(), userId)
+}
@@ -17,17 +17,26 @@ type CategoryHandler struct {
 }
 
 // NewCategoryHandler registers category routes
-func NewCategoryHandler(router *gin.Engine, categoryService *services.CategoryService, jwtHelper *helpers.JwtHelper) *CategoryHandler {
+func NewCategoryHandler(router *gin.Engine, categoryService *services.CategoryService, jwtHelper *helpers.JwtHelper, rateLimiter *helpers.RateLimiter, deadlines *helpers.QueryDeadlines) *CategoryHandler {
 	handler := &CategoryHandler{categoryService, jwtHelper}
 
-	categoryGroup := router.Group("/categories", jwtHelper.RequireAuth())
+	categoryGroup := router.Group("/categories", jwtHelper.RequireAuth(), rateLimiter.Limit(helpers.RateLimitUser, helpers.RateLimitByUser), deadlines.Standard())
 	{
 		categoryGroup.GET("", handler.handleWithData(handler.GetPaginatedCategories))
 		categoryGroup.GET("/:id", handler.handleWithData(handler.GetCategoryById))
 		categoryGroup.POST("", handler.handleWithData(handler.CreateCategory))
 		categoryGroup.PUT("/:id", handler.handleWithData(handler.UpdateCategory))
+		categoryGroup.PATCH("/:id", handler.handleWithData(handler.PatchCategory))
 		categoryGroup.DELETE("/:id", handler.handle(handler.DeleteCategory))
-		categoryGroup.GET("/statistics", handler.handleWithData(handler.GetCategoryStatistics))
+		categoryGroup.GET("/tree", handler.handleWithData(handler.GetCategoryTree))
+		categoryGroup.PATCH("/order", handler.handle(handler.ReorderCategories))
+		categoryGroup.POST("/:id/archive", handler.handleWithData(handler.ArchiveCategory))
+		categoryGroup.POST("/:id/unarchive", handler.handleWithData(handler.UnarchiveCategory))
+	}
+
+	reportGroup := router.Group("/categories", jwtHelper.RequireAuth(), rateLimiter.Limit(helpers.RateLimitUser, helpers.RateLimitByUser), deadlines.Report())
+	{
+		reportGroup.GET("/statistics", handler.handleWithData(handler.GetCategoryStatistics))
 	}
 
 	return handler
@@ -37,10 +46,10 @@ func (handler *CategoryHandler) handleWithData(handlerFunc func(*gin.Context) (a
 	return func(context *gin.Context) {
 		response, problem := handlerFunc(context)
 		if problem != nil {
-			context.JSON(problem.Status, problem)
+			problems.Write(context, problem)
 			return
 		}
-		context.JSON(http.StatusOK, response)
+		helpers.WriteCachedJSON(context, http.StatusOK, response)
 	}
 }
 
@@ -48,7 +57,7 @@ func (handler *CategoryHandler) handle(handlerFunc func(*gin.Context) *problems.
 	return func(context *gin.Context) {
 		problem := handlerFunc(context)
 		if problem != nil {
-			context.JSON(problem.Status, problem)
+			problems.Write(context, problem)
 			return
 		}
 		context.JSON(http.StatusOK, nil)
@@ -69,7 +78,7 @@ func (handler *CategoryHandler) CreateCategory(context *gin.Context) (any, *prob
 		return nil, problems.FromError(err)
 	}
 
-	return handler.categoryService.CreateCategory(form)
+	return handler.categoryService.CreateCategory(context.Request.Context(), form)
 }
 
 // UpdateCategory updates an existing category
@@ -78,6 +87,7 @@ func (handler *CategoryHandler) CreateCategory(context *gin.Context) (any, *prob
 // @Accept json
 // @Produce json
 // @Param id path string true "Category Id"
+// @Param If-Match header string false "ETag or version of the category the update is based on"
 // @Param body body services.UpdateCategoryForm true "Category update form"
 // @Security BearerAuth
 // @Router /categories/{id} [put]
@@ -92,15 +102,53 @@ func (handler *CategoryHandler) UpdateCategory(context *gin.Context) (any, *prob
 		return nil, problems.FromError(err)
 	}
 
-	return handler.categoryService.UpdateCategory(id, form)
+	version, problem := helpers.IfMatchVersion(context)
+	if problem != nil {
+		return nil, problem
+	}
+	form.ExpectedVersion = version
+
+	return handler.categoryService.UpdateCategory(context.Request.Context(), id, form)
+}
+
+// PatchCategory partially updates an existing category
+// @Summary Partially update an existing category
+// @Description Accepts a JSON merge patch (RFC 7396). Only the fields in the patch are changed and validated, and fields set to null are cleared.
+// @Tags Categories
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Category Id"
+// @Param If-Match header string false "ETag or version of the category the update is based on"
+// @Param body body services.UpdateCategoryForm true "Category merge patch"
+// @Security BearerAuth
+// @Router /categories/{id} [patch]
+func (handler *CategoryHandler) PatchCategory(context *gin.Context) (any, *problems.Problem) {
+	id := context.Param("id")
+	if id == "" {
+		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
+	}
+
+	patch, problem := helpers.ReadMergePatch(context)
+	if problem != nil {
+		return nil, problem
+	}
+
+	version, problem := helpers.IfMatchVersion(context)
+	if problem != nil {
+		return nil, problem
+	}
+
+	return handler.categoryService.PatchCategory(context.Request.Context(), id, patch, version)
 }
 
 // DeleteCategory deletes a category by Id
 // @Summary Delete a category by Id
+// @Description Fails with 409 while incidents reference the category, unless they are moved with moveTo or the delete is forced.
 // @Tags Categories
 // @Accept json
 // @Produce json
 // @Param id path string true "Category Id"
+// @Param form query services.DeleteCategoryForm false "Delete options"
 // @Security BearerAuth
 // @Router /categories/{id} [delete]
 func (handler *CategoryHandler) DeleteCategory(context *gin.Context) *problems.Problem {
@@ -109,7 +157,63 @@ func (handler *CategoryHandler) DeleteCategory(context *gin.Context) *problems.P
 		return problems.NewProblem(http.StatusNotFound, "Category not found.")
 	}
 
-	return handler.categoryService.DeleteCategory(id)
+	var form services.DeleteCategoryForm
+	if err := context.ShouldBindQuery(&form); err != nil {
+		return problems.FromError(err)
+	}
+
+	return handler.categoryService.DeleteCategory(context.Request.Context(), id, form)
+}
+
+// ArchiveCategory archives a category and its subcategories
+// @Summary Archive a category
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Param id path string true "Category Id"
+// @Security BearerAuth
+// @Router /categories/{id}/archive [post]
+func (handler *CategoryHandler) ArchiveCategory(context *gin.Context) (any, *problems.Problem) {
+	id := context.Param("id")
+	if id == "" {
+		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
+	}
+
+	return handler.categoryService.ArchiveCategory(context.Request.Context(), id)
+}
+
+// UnarchiveCategory restores an archived category and its subcategories
+// @Summary Unarchive a category
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Param id path string true "Category Id"
+// @Security BearerAuth
+// @Router /categories/{id}/unarchive [post]
+func (handler *CategoryHandler) UnarchiveCategory(context *gin.Context) (any, *problems.Problem) {
+	id := context.Param("id")
+	if id == "" {
+		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
+	}
+
+	return handler.categoryService.UnarchiveCategory(context.Request.Context(), id)
+}
+
+// ReorderCategories updates the order of several categories
+// @Summary Reorder categories
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Param body body services.ReorderCategoriesForm true "Category orders"
+// @Security BearerAuth
+// @Router /categories/order [patch]
+func (handler *CategoryHandler) ReorderCategories(context *gin.Context) *problems.Problem {
+	var form services.ReorderCategoriesForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return problems.FromError(err)
+	}
+
+	return handler.categoryService.ReorderCategories(context.Request.Context(), form)
 }
 
 // GetPaginatedCategories retrieves paginated categories based on filters
@@ -126,7 +230,7 @@ func (handler *CategoryHandler) GetPaginatedCategories(context *gin.Context) (an
 		return nil, problems.FromError(err)
 	}
 
-	return handler.categoryService.GetPaginatedCategories(filter)
+	return handler.categoryService.GetPaginatedCategories(context.Request.Context(), filter)
 }
 
 // GetCategory retrieves a single category by Id
@@ -143,7 +247,7 @@ func (handler *CategoryHandler) GetCategoryById(context *gin.Context) (any, *pro
 		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
 	}
 
-	return handler.categoryService.GetCategoryById(id)
+	return handler.categoryService.GetCategoryById(context.Request.Context(), id)
 }
 
 // GetCategoryStatistics retrieves statistics for categories
@@ -160,5 +264,18 @@ func (handler *CategoryHandler) GetCategoryStatistics(context *gin.Context) (any
 		return nil, problems.FromError(err)
 	}
 
-	return handler.categoryService.GetCategoryStatistics(filter)
+	return handler.categoryService.GetCategoryStatistics(context.Request.Context(), filter)
+}
+
+// GetCategoryTree retrieves all categories with their subcategories
+// @Summary Get category tree
+// @Tags Categories
+// @Accept json
+// @Produce json
+// @Param includeArchived query bool false "Include archived categories"
+// @Security BearerAuth
+// @Router /categories/tree [get]
+func (handler *CategoryHandler) GetCategoryTree(context *gin.Context) (any, *problems.Problem) {
+	includeArchived := context.Query("includeArchived") == "true"
+	return handler.categoryService.GetCategoryTree(context.Request.Context(), includeArchived)
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prince272/konabra/internal/constants"
 	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/models"
 	"github.com/prince272/konabra/internal/problems"
 	"github.com/prince272/konabra/internal/repositories"
 	"github.com/prince272/konabra/internal/services"
@@ -19,38 +20,62 @@ type IdentityHandler struct {
 }
 
 // NewIdentityHandler registers identity routes
-func NewIdentityHandler(router *gin.Engine, jwtHelper *helpers.JwtHelper, identityService *services.IdentityService) *IdentityHandler {
+func NewIdentityHandler(router *gin.Engine, jwtHelper *helpers.JwtHelper, rateLimiter *helpers.RateLimiter, deadlines *helpers.QueryDeadlines, identityService *services.IdentityService) *IdentityHandler {
 	handler := &IdentityHandler{identityService: identityService, jwtHelper: jwtHelper}
 
-	identityGroup := router.Group("/account")
+	// Credential checks and requests that send a one-time code are limited
+	// separately to slow down password guessing and SMS pumping
+	signInLimit := rateLimiter.Limit(helpers.RateLimitSignIn, helpers.RateLimitByIp)
+	codeLimit := rateLimiter.Limit(helpers.RateLimitCode, helpers.RateLimitByIp)
+
+	identityGroup := router.Group("/account", deadlines.Standard())
 	{
-		identityGroup.POST("/create", handler.handleWithData(handler.CreateAccount))
-		identityGroup.POST("/signin", handler.handleWithData(handler.SignIn))
-		identityGroup.POST("/signin/refresh", handler.handleWithData(handler.SignInWithRefreshToken))
+		identityGroup.POST("/create", signInLimit, handler.handleWithData(handler.CreateAccount))
+		identityGroup.POST("/signin", signInLimit, handler.handleWithData(handler.SignIn))
+		identityGroup.POST("/signin/refresh", signInLimit, handler.handleWithData(handler.SignInWithRefreshToken))
+		identityGroup.POST("/signin/code", codeLimit, handler.handle(handler.SignInWithCode))
+		identityGroup.POST("/signin/code/complete", signInLimit, handler.handleWithData(handler.CompleteSignInWithCode))
+		identityGroup.POST("/signin/link/complete", signInLimit, handler.handleWithData(handler.CompleteSignInWithLink))
 		identityGroup.POST("/signout", jwtHelper.RequireAuth(), handler.handle(handler.SignOut))
 		identityGroup.GET("/current", jwtHelper.RequireAuth(), handler.handleWithData(handler.GetCurrentAccount))
+		identityGroup.PATCH("/current", jwtHelper.RequireAuth(), handler.handleWithData(handler.PatchCurrentAccount))
 		identityGroup.DELETE("/current", jwtHelper.RequireAuth(), handler.handle(handler.DeleteCurrentAccount))
-		identityGroup.POST("/verify", handler.handle(handler.VerifyAccount))
-		identityGroup.POST("/verify/complete", handler.handle(handler.CompleteVerifyAccount))
-		identityGroup.POST("/change", jwtHelper.RequireAuth(), handler.handle(handler.ChangeAccount))
-		identityGroup.POST("/change/complete", jwtHelper.RequireAuth(), handler.handle(handler.CompleteChangeAccount))
-		identityGroup.POST("/password/reset", handler.handle(handler.ResetPassword))
-		identityGroup.POST("/password/reset/complete", handler.handle(handler.CompleteResetPassword))
+		identityGroup.POST("/verify", codeLimit, handler.handle(handler.VerifyAccount))
+		identityGroup.POST("/verify/complete", signInLimit, handler.handle(handler.CompleteVerifyAccount))
+		identityGroup.POST("/change", jwtHelper.RequireAuth(), codeLimit, handler.handle(handler.ChangeAccount))
+		identityGroup.POST("/change/complete", jwtHelper.RequireAuth(), signInLimit, handler.handle(handler.CompleteChangeAccount))
+		identityGroup.POST("/password/reset", codeLimit, handler.handle(handler.ResetPassword))
+		identityGroup.POST("/password/reset/complete", signInLimit, handler.handle(handler.CompleteResetPassword))
 		identityGroup.POST("/password/change", jwtHelper.RequireAuth(), handler.handle(handler.ChangePassword))
+		identityGroup.POST("/apikeys", jwtHelper.RequireAuth(), handler.handleWithData(handler.CreateApiKey))
+		identityGroup.GET("/apikeys", jwtHelper.RequireAuth(), handler.handleWithData(handler.GetApiKeys))
+		identityGroup.DELETE("/apikeys/:id", jwtHelper.RequireAuth(), handler.handle(handler.RevokeApiKey))
+	}
+
+	// Service accounts
+	serviceAccountsGroup := router.Group("/serviceaccounts", jwtHelper.RequireAuth(models.RoleAdministrator), deadlines.Standard())
+	{
+		serviceAccountsGroup.POST("", handler.handleWithData(handler.CreateServiceAccount))
+		serviceAccountsGroup.GET("", handler.handleWithData(handler.GetServiceAccounts))
+		serviceAccountsGroup.DELETE("/:id", handler.handle(handler.DeleteServiceAccount))
+		serviceAccountsGroup.POST("/:id/apikeys", handler.handleWithData(handler.CreateServiceAccountApiKey))
+		serviceAccountsGroup.GET("/:id/apikeys", handler.handleWithData(handler.GetServiceAccountApiKeys))
+		serviceAccountsGroup.DELETE("/:id/apikeys/:apiKeyId", handler.handle(handler.RevokeServiceAccountApiKey))
 	}
 
 	// Roles
-	rolesGroup := router.Group("/roles")
+	rolesGroup := router.Group("/roles", deadlines.Standard())
 	{
 		rolesGroup.POST("", jwtHelper.RequireAuth(), handler.handleWithData(handler.CreateRole))
 		rolesGroup.PUT("/:id", jwtHelper.RequireAuth(), handler.handleWithData(handler.UpdateRole))
+		rolesGroup.PATCH("/:id", jwtHelper.RequireAuth(), handler.handleWithData(handler.PatchRole))
 		rolesGroup.GET("/:id", jwtHelper.RequireAuth(), handler.handleWithData(handler.GetRoleById))
 		rolesGroup.DELETE("/:id", jwtHelper.RequireAuth(), handler.handle(handler.DeleteRole))
 		rolesGroup.GET("", jwtHelper.RequireAuth(), handler.handleWithData(handler.GetPaginatedRoles))
 	}
 
 	// Users
-	usersGroup := router.Group("/users")
+	usersGroup := router.Group("/users", deadlines.Report())
 	{
 		usersGroup.GET("/statistics", jwtHelper.RequireAuth(), handler.handleWithData(handler.GetUsersStatistics))
 	}
@@ -63,10 +88,10 @@ func (handler *IdentityHandler) handleWithData(handlerFunc func(*gin.Context) (a
 	return func(context *gin.Context) {
 		response, problem := handlerFunc(context)
 		if problem != nil {
-			context.JSON(problem.Status, problem)
+			problems.Write(context, problem)
 			return
 		}
-		context.JSON(http.StatusOK, response)
+		helpers.WriteCachedJSON(context, http.StatusOK, response)
 	}
 }
 
@@ -74,7 +99,7 @@ func (handler *IdentityHandler) handle(handlerFunc func(*gin.Context) *problems.
 	return func(context *gin.Context) {
 		problem := handlerFunc(context)
 		if problem != nil {
-			context.JSON(problem.Status, problem)
+			problems.Write(context, problem)
 			return
 		}
 		context.JSON(http.StatusOK, nil)
@@ -93,7 +118,7 @@ func (handler *IdentityHandler) CreateAccount(context *gin.Context) (any, *probl
 	if err := context.ShouldBindJSON(&form); err != nil {
 		return nil, problems.FromError(err)
 	}
-	return handler.identityService.CreateAccount(form)
+	return handler.identityService.CreateAccount(context.Request.Context(), form)
 }
 
 // VerifyAccount handles account verification initiation
@@ -109,7 +134,7 @@ func (handler *IdentityHandler) VerifyAccount(context *gin.Context) *problems.Pr
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.VerifyAccount(form)
+	return handler.identityService.VerifyAccount(context.Request.Context(), form)
 }
 
 // CompleteVerifyAccount handles account verification completion
@@ -125,7 +150,7 @@ func (handler *IdentityHandler) CompleteVerifyAccount(context *gin.Context) *pro
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.CompleteVerifyAccount(form)
+	return handler.identityService.CompleteVerifyAccount(context.Request.Context(), form)
 }
 
 // ChangeAccount handles account change initiation
@@ -145,7 +170,7 @@ func (handler *IdentityHandler) ChangeAccount(context *gin.Context) *problems.Pr
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.ChangeAccount(userId, form)
+	return handler.identityService.ChangeAccount(context.Request.Context(), userId, form)
 }
 
 // CompleteChangeAccount handles account change completion
@@ -165,11 +190,12 @@ func (handler *IdentityHandler) CompleteChangeAccount(context *gin.Context) *pro
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.CompleteChangeAccount(userId, form)
+	return handler.identityService.CompleteChangeAccount(context.Request.Context(), userId, form)
 }
 
 // DeleteCurrentAccount handles account deletion
 // @Summary Delete the current user account
+// @Description Schedules the account for erasure after a grace period. Signing in again before then cancels the erasure.
 // @Tags Account
 // @Accept json
 // @Produce json
@@ -179,7 +205,7 @@ func (handler *IdentityHandler) DeleteCurrentAccount(context *gin.Context) *prob
 	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
 	userId := claims["sub"].(string)
 
-	return handler.identityService.DeleteAccount(userId)
+	return handler.identityService.DeleteAccount(context.Request.Context(), userId)
 }
 
 // ResetPassword handles password reset initiation
@@ -195,7 +221,7 @@ func (handler *IdentityHandler) ResetPassword(context *gin.Context) *problems.Pr
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.ResetPassword(form)
+	return handler.identityService.ResetPassword(context.Request.Context(), form)
 }
 
 // CompleteResetPassword handles password reset completion
@@ -211,7 +237,7 @@ func (handler *IdentityHandler) CompleteResetPassword(context *gin.Context) *pro
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.CompleteResetPassword(form)
+	return handler.identityService.CompleteResetPassword(context.Request.Context(), form)
 }
 
 // ChangePassword handles password change
@@ -231,7 +257,7 @@ func (handler *IdentityHandler) ChangePassword(context *gin.Context) *problems.P
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.ChangePassword(userId, form)
+	return handler.identityService.ChangePassword(context.Request.Context(), userId, form)
 }
 
 // SignIn handles account sign-in
@@ -247,7 +273,7 @@ func (handler *IdentityHandler) SignIn(context *gin.Context) (any, *problems.Pro
 		return nil, problems.FromError(err)
 	}
 
-	return handler.identityService.SignIn(form)
+	return handler.identityService.SignIn(context.Request.Context(), form)
 }
 
 // SignInWithRefreshToken handles sign-in using a refresh token
@@ -263,7 +289,55 @@ func (handler *IdentityHandler) SignInWithRefreshToken(context *gin.Context) (an
 		return nil, problems.FromError(err)
 	}
 
-	return handler.identityService.SignInWithRefreshToken(form)
+	return handler.identityService.SignInWithRefreshToken(context.Request.Context(), form)
+}
+
+// SignInWithCode handles passwordless sign-in initiation
+// @Summary Send a sign-in code (email or phone) and, for email, a sign-in link
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param body body services.SignInWithCodeForm true "Sign-in code details"
+// @Router /account/signin/code [post]
+func (handler *IdentityHandler) SignInWithCode(context *gin.Context) *problems.Problem {
+	var form services.SignInWithCodeForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return problems.FromError(err)
+	}
+
+	return handler.identityService.SignInWithCode(context.Request.Context(), form)
+}
+
+// CompleteSignInWithCode handles passwordless sign-in completion
+// @Summary Sign in using a one-time code
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param body body services.CompleteSignInWithCodeForm true "Sign-in code completion details"
+// @Router /account/signin/code/complete [post]
+func (handler *IdentityHandler) CompleteSignInWithCode(context *gin.Context) (any, *problems.Problem) {
+	var form services.CompleteSignInWithCodeForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	return handler.identityService.CompleteSignInWithCode(context.Request.Context(), form)
+}
+
+// CompleteSignInWithLink handles sign-in using an emailed link
+// @Summary Sign in using a sign-in link token
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Param body body services.CompleteSignInWithLinkForm true "Sign-in link details"
+// @Router /account/signin/link/complete [post]
+func (handler *IdentityHandler) CompleteSignInWithLink(context *gin.Context) (any, *problems.Problem) {
+	var form services.CompleteSignInWithLinkForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	return handler.identityService.CompleteSignInWithLink(context.Request.Context(), form)
 }
 
 // SignOut handles account sign-out
@@ -282,7 +356,7 @@ func (handler *IdentityHandler) SignOut(context *gin.Context) *problems.Problem
 		return problems.FromError(err)
 	}
 
-	return handler.identityService.SignOut(userId, form)
+	return handler.identityService.SignOut(context.Request.Context(), userId, form)
 }
 
 // GetCurrentAccount retrieves info for the authenticated user
@@ -295,7 +369,185 @@ func (handler *IdentityHandler) SignOut(context *gin.Context) *problems.Problem
 func (handler *IdentityHandler) GetCurrentAccount(context *gin.Context) (any, *problems.Problem) {
 	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
 	userId := claims["sub"].(string)
-	return handler.identityService.GetAccountByUserId(userId)
+	return handler.identityService.GetAccountByUserId(context.Request.Context(), userId)
+}
+
+// PatchCurrentAccount partially updates the profile of the authenticated user
+// @Summary Partially update the current user account
+// @Description Accepts a JSON merge patch (RFC 7396). Only the fields in the patch are changed and validated.
+// @Tags Account
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param body body services.UpdateAccountForm true "Account merge patch"
+// @Security BearerAuth
+// @Router /account/current [patch]
+func (handler *IdentityHandler) PatchCurrentAccount(context *gin.Context) (any, *problems.Problem) {
+	patch, problem := helpers.ReadMergePatch(context)
+	if problem != nil {
+		return nil, problem
+	}
+
+	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
+	userId := claims["sub"].(string)
+	return handler.identityService.PatchAccount(context.Request.Context(), userId, patch)
+}
+
+// CreateApiKey creates a personal api key
+// @Summary Create a personal api key for the current user
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body services.CreateApiKeyForm true "Api key details"
+// @Router /account/apikeys [post]
+func (handler *IdentityHandler) CreateApiKey(context *gin.Context) (any, *problems.Problem) {
+	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
+	userId := claims["sub"].(string)
+
+	var form services.CreateApiKeyForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	return handler.identityService.CreateApiKey(context.Request.Context(), userId, form)
+}
+
+// GetApiKeys lists the current user's api keys
+// @Summary Get api keys of the current user
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Router /account/apikeys [get]
+func (handler *IdentityHandler) GetApiKeys(context *gin.Context) (any, *problems.Problem) {
+	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
+	userId := claims["sub"].(string)
+
+	return handler.identityService.GetApiKeys(context.Request.Context(), userId)
+}
+
+// RevokeApiKey revokes one of the current user's api keys
+// @Summary Revoke an api key of the current user
+// @Tags Account
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Api key Id"
+// @Router /account/apikeys/{id} [delete]
+func (handler *IdentityHandler) RevokeApiKey(context *gin.Context) *problems.Problem {
+	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
+	userId := claims["sub"].(string)
+
+	id := context.Param("id")
+	if id == "" {
+		return problems.NewProblem(http.StatusNotFound, "Api key not found.")
+	}
+
+	return handler.identityService.RevokeApiKey(context.Request.Context(), userId, id)
+}
+
+// CreateServiceAccount creates a new service account
+// @Summary Create a service account for integrations
+// @Tags Service Accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body services.CreateServiceAccountForm true "Service account details"
+// @Router /serviceaccounts [post]
+func (handler *IdentityHandler) CreateServiceAccount(context *gin.Context) (any, *problems.Problem) {
+	var form services.CreateServiceAccountForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	return handler.identityService.CreateServiceAccount(context.Request.Context(), form)
+}
+
+// GetServiceAccounts lists all service accounts
+// @Summary Get service accounts
+// @Tags Service Accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Router /serviceaccounts [get]
+func (handler *IdentityHandler) GetServiceAccounts(context *gin.Context) (any, *problems.Problem) {
+	return handler.identityService.GetServiceAccounts(context.Request.Context())
+}
+
+// DeleteServiceAccount deletes a service account and revokes its api keys
+// @Summary Delete a service account by Id
+// @Tags Service Accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account Id"
+// @Router /serviceaccounts/{id} [delete]
+func (handler *IdentityHandler) DeleteServiceAccount(context *gin.Context) *problems.Problem {
+	id := context.Param("id")
+	if id == "" {
+		return problems.NewProblem(http.StatusNotFound, "Service account not found.")
+	}
+
+	return handler.identityService.DeleteServiceAccount(context.Request.Context(), id)
+}
+
+// CreateServiceAccountApiKey creates an api key for a service account
+// @Summary Create an api key for a service account
+// @Tags Service Accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account Id"
+// @Param body body services.CreateApiKeyForm true "Api key details"
+// @Router /serviceaccounts/{id}/apikeys [post]
+func (handler *IdentityHandler) CreateServiceAccountApiKey(context *gin.Context) (any, *problems.Problem) {
+	id := context.Param("id")
+	if id == "" {
+		return nil, problems.NewProblem(http.StatusNotFound, "Service account not found.")
+	}
+
+	var form services.CreateApiKeyForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	return handler.identityService.CreateServiceAccountApiKey(context.Request.Context(), id, form)
+}
+
+// GetServiceAccountApiKeys lists the api keys of a service account
+// @Summary Get api keys of a service account
+// @Tags Service Accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account Id"
+// @Router /serviceaccounts/{id}/apikeys [get]
+func (handler *IdentityHandler) GetServiceAccountApiKeys(context *gin.Context) (any, *problems.Problem) {
+	id := context.Param("id")
+	if id == "" {
+		return nil, problems.NewProblem(http.StatusNotFound, "Service account not found.")
+	}
+
+	return handler.identityService.GetServiceAccountApiKeys(context.Request.Context(), id)
+}
+
+// RevokeServiceAccountApiKey revokes an api key of a service account
+// @Summary Revoke an api key of a service account
+// @Tags Service Accounts
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account Id"
+// @Param apiKeyId path string true "Api key Id"
+// @Router /serviceaccounts/{id}/apikeys/{apiKeyId} [delete]
+func (handler *IdentityHandler) RevokeServiceAccountApiKey(context *gin.Context) *problems.Problem {
+	id := context.Param("id")
+	apiKeyId := context.Param("apiKeyId")
+	if id == "" || apiKeyId == "" {
+		return problems.NewProblem(http.StatusNotFound, "Api key not found.")
+	}
+
+	return handler.identityService.RevokeServiceAccountApiKey(context.Request.Context(), id, apiKeyId)
 }
 
 // CreateRole creates a new role
@@ -312,7 +564,7 @@ func (handler *IdentityHandler) CreateRole(context *gin.Context) (any, *problems
 		return nil, problems.FromError(err)
 	}
 
-	return handler.identityService.CreateRole(form)
+	return handler.identityService.CreateRole(context.Request.Context(), form)
 }
 
 // UpdateRole updates an existing role
@@ -321,6 +573,7 @@ func (handler *IdentityHandler) CreateRole(context *gin.Context) (any, *problems
 // @Accept json
 // @Produce json
 // @Param id path string true "Role Id"
+// @Param If-Match header string false "ETag or version of the role the update is based on"
 // @Param body body services.UpdateRoleForm true "Role update form"
 // @Security BearerAuth
 // @Router /roles/{id} [put]
@@ -335,7 +588,43 @@ func (handler *IdentityHandler) UpdateRole(context *gin.Context) (any, *problems
 		return nil, problems.FromError(err)
 	}
 
-	return handler.identityService.UpdateRole(id, form)
+	version, problem := helpers.IfMatchVersion(context)
+	if problem != nil {
+		return nil, problem
+	}
+	form.ExpectedVersion = version
+
+	return handler.identityService.UpdateRole(context.Request.Context(), id, form)
+}
+
+// PatchRole partially updates an existing role
+// @Summary Partially update an existing role
+// @Description Accepts a JSON merge patch (RFC 7396). Only the fields in the patch are changed and validated, and fields set to null are cleared.
+// @Tags Roles
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Role Id"
+// @Param If-Match header string false "ETag or version of the role the update is based on"
+// @Param body body services.UpdateRoleForm true "Role merge patch"
+// @Security BearerAuth
+// @Router /roles/{id} [patch]
+func (handler *IdentityHandler) PatchRole(context *gin.Context) (any, *problems.Problem) {
+	id := context.Param("id")
+	if id == "" {
+		return nil, problems.NewProblem(http.StatusNotFound, "Role not found.")
+	}
+
+	patch, problem := helpers.ReadMergePatch(context)
+	if problem != nil {
+		return nil, problem
+	}
+
+	version, problem := helpers.IfMatchVersion(context)
+	if problem != nil {
+		return nil, problem
+	}
+
+	return handler.identityService.PatchRole(context.Request.Context(), id, patch, version)
 }
 
 // DeleteRole deletes a role by Id
@@ -352,7 +641,7 @@ func (handler *IdentityHandler) DeleteRole(context *gin.Context) *problems.Probl
 		return problems.NewProblem(http.StatusNotFound, "Role not found.")
 	}
 
-	return handler.identityService.DeleteRole(id)
+	return handler.identityService.DeleteRole(context.Request.Context(), id)
 }
 
 // GetPaginatedRoles retrieves paginated roles based on filters
@@ -369,7 +658,7 @@ func (handler *IdentityHandler) GetPaginatedRoles(context *gin.Context) (any, *p
 		return nil, problems.FromError(err)
 	}
 
-	return handler.identityService.GetPaginatedRoles(filter)
+	return handler.identityService.GetPaginatedRoles(context.Request.Context(), filter)
 }
 
 // GetRoleById retrieves a role by Id
@@ -386,7 +675,7 @@ func (handler *IdentityHandler) GetRoleById(context *gin.Context) (any, *problem
 		return nil, problems.NewProblem(http.StatusNotFound, "Role not found.")
 	}
 
-	return handler.identityService.GetRoleById(id)
+	return handler.identityService.GetRoleById(context.Request.Context(), id)
 }
 
 // GetUsersStatistics retrieves user statistics based on a date range
@@ -403,5 +692,5 @@ func (handler *IdentityHandler) GetUsersStatistics(context *gin.Context) (any, *
 		return nil, problems.FromError(err)
 	}
 
-	return handler.identityService.GetUsersStatistics(dateRange)
+	return handler.identityService.GetUsersStatistics(context.Request.Context(), dateRange)
 }
@@ -19,19 +19,24 @@ type IncidentHandler struct {
 }
 
 // NewIncidentHandler registers incident routes
-func NewIncidentHandler(router *gin.Engine, incidentService *services.IncidentService, jwtHelper *helpers.JwtHelper) *IncidentHandler {
+func NewIncidentHandler(router *gin.Engine, incidentService *services.IncidentService, jwtHelper *helpers.JwtHelper, rateLimiter *helpers.RateLimiter, deadlines *helpers.QueryDeadlines) *IncidentHandler {
 	handler := &IncidentHandler{incidentService, jwtHelper}
 
-	incidentGroup := router.Group("/incidents", jwtHelper.RequireAuth())
+	incidentGroup := router.Group("/incidents", jwtHelper.RequireAuth(), rateLimiter.Limit(helpers.RateLimitUser, helpers.RateLimitByUser), deadlines.Standard())
 	{
 		incidentGroup.GET("", handler.handleWithData(handler.GetPaginatedIncidents))
 		incidentGroup.GET("/:id", handler.handleWithData(handler.GetIncidentById))
-		incidentGroup.POST("", handler.handleWithData(handler.CreateIncident))
+		incidentGroup.POST("", rateLimiter.Limit(helpers.RateLimitIncidentCreate, helpers.RateLimitByUser), handler.handleWithData(handler.CreateIncident))
 		incidentGroup.PUT("/:id", handler.handleWithData(handler.UpdateIncident))
+		incidentGroup.PATCH("/:id", handler.handleWithData(handler.PatchIncident))
 		incidentGroup.DELETE("/:id", handler.handle(handler.DeleteIncident))
-		incidentGroup.GET("/statistics", handler.handleWithData(handler.GetIncidentStatistics))
-		incidentGroup.GET("/insights/severity", handler.handleWithData(handler.GetIncidentSeverityInsights))
-		incidentGroup.GET("/insights/category", handler.handleWithData(handler.GetIncidentCategoryInsights))
+	}
+
+	reportGroup := router.Group("/incidents", jwtHelper.RequireAuth(), rateLimiter.Limit(helpers.RateLimitUser, helpers.RateLimitByUser), deadlines.Report())
+	{
+		reportGroup.GET("/statistics", handler.handleWithData(handler.GetIncidentStatistics))
+		reportGroup.GET("/insights/severity", handler.handleWithData(handler.GetIncidentSeverityInsights))
+		reportGroup.GET("/insights/category", handler.handleWithData(handler.GetIncidentCategoryInsights))
 	}
 
 	return handler
@@ -41,10 +46,10 @@ func (handler *IncidentHandler) handleWithData(handlerFunc func(*gin.Context) (a
 	return func(context *gin.Context) {
 		response, problem := handlerFunc(context)
 		if problem != nil {
-			context.JSON(problem.Status, problem)
+			problems.Write(context, problem)
 			return
 		}
-		context.JSON(http.StatusOK, response)
+		helpers.WriteCachedJSON(context, http.StatusOK, response)
 	}
 }
 
@@ -52,7 +57,7 @@ func (handler *IncidentHandler) handle(handlerFunc func(*gin.Context) *problems.
 	return func(context *gin.Context) {
 		problem := handlerFunc(context)
 		if problem != nil {
-			context.JSON(problem.Status, problem)
+			problems.Write(context, problem)
 			return
 		}
 		context.JSON(http.StatusOK, nil)
@@ -76,7 +81,7 @@ func (handler *IncidentHandler) CreateIncident(context *gin.Context) (any, *prob
 	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
 	userId := claims["sub"].(string)
 
-	return handler.incidentService.CreateIncident(userId, form)
+	return handler.incidentService.CreateIncident(context.Request.Context(), userId, form)
 }
 
 // UpdateIncident updates an existing incident
@@ -85,6 +90,7 @@ func (handler *IncidentHandler) CreateIncident(context *gin.Context) (any, *prob
 // @Accept json
 // @Produce json
 // @Param id path string true "Incident Id"
+// @Param If-Match header string false "ETag or version of the incident the update is based on"
 // @Param body body services.UpdateIncidentForm true "Incident update form"
 // @Security BearerAuth
 // @Router /incidents/{id} [put]
@@ -99,7 +105,43 @@ func (handler *IncidentHandler) UpdateIncident(context *gin.Context) (any, *prob
 		return nil, problems.FromError(err)
 	}
 
-	return handler.incidentService.UpdateIncident(id, form)
+	version, problem := helpers.IfMatchVersion(context)
+	if problem != nil {
+		return nil, problem
+	}
+	form.ExpectedVersion = version
+
+	return handler.incidentService.UpdateIncident(context.Request.Context(), id, form)
+}
+
+// PatchIncident partially updates an existing incident
+// @Summary Partially update an existing incident
+// @Description Accepts a JSON merge patch (RFC 7396). Only the fields in the patch are changed and validated, and fields set to null are cleared.
+// @Tags Incidents
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "Incident Id"
+// @Param If-Match header string false "ETag or version of the incident the update is based on"
+// @Param body body services.UpdateIncidentForm true "Incident merge patch"
+// @Security BearerAuth
+// @Router /incidents/{id} [patch]
+func (handler *IncidentHandler) PatchIncident(context *gin.Context) (any, *problems.Problem) {
+	id := context.Param("id")
+	if id == "" {
+		return nil, problems.NewProblem(http.StatusNotFound, "Incident not found.")
+	}
+
+	patch, problem := helpers.ReadMergePatch(context)
+	if problem != nil {
+		return nil, problem
+	}
+
+	version, problem := helpers.IfMatchVersion(context)
+	if problem != nil {
+		return nil, problem
+	}
+
+	return handler.incidentService.PatchIncident(context.Request.Context(), id, patch, version)
 }
 
 // DeleteIncident deletes an incident by Id
@@ -116,7 +158,7 @@ func (handler *IncidentHandler) DeleteIncident(context *gin.Context) *problems.P
 		return problems.NewProblem(http.StatusNotFound, "Incident not found.")
 	}
 
-	return handler.incidentService.DeleteIncident(id)
+	return handler.incidentService.DeleteIncident(context.Request.Context(), id)
 }
 
 // GetPaginatedIncidents retrieves paginated incidents based on filters
@@ -133,7 +175,7 @@ func (handler *IncidentHandler) GetPaginatedIncidents(context *gin.Context) (any
 		return nil, problems.FromError(err)
 	}
 
-	return handler.incidentService.GetPaginatedIncidents(filter)
+	return handler.incidentService.GetPaginatedIncidents(context.Request.Context(), filter)
 }
 
 // GetIncidentById retrieves a single incident by Id
@@ -150,7 +192,7 @@ func (handler *IncidentHandler) GetIncidentById(context *gin.Context) (any, *pro
 		return nil, problems.NewProblem(http.StatusNotFound, "Incident not found.")
 	}
 
-	return handler.incidentService.GetIncidentById(id)
+	return handler.incidentService.GetIncidentById(context.Request.Context(), id)
 }
 
 // GetIncidentStatistics retrieves statistics for incidents
@@ -167,7 +209,7 @@ func (handler *IncidentHandler) GetIncidentStatistics(context *gin.Context) (any
 		return nil, problems.FromError(err)
 	}
 
-	return handler.incidentService.GetIncidentStatistics(dateRange)
+	return handler.incidentService.GetIncidentStatistics(context.Request.Context(), dateRange)
 }
 
 // GetIncidentSeverityInsights retrieves insights on incident severity
@@ -184,7 +226,7 @@ func (handler *IncidentHandler) GetIncidentSeverityInsights(context *gin.Context
 		return nil, problems.FromError(err)
 	}
 
-	return handler.incidentService.GetIncidentSeverityInsights(filter)
+	return handler.incidentService.GetIncidentSeverityInsights(context.Request.Context(), filter)
 }
 
 // GetIncidentCategoryInsights retrieves insights on incident categories
@@ -201,5 +243,5 @@ func (handler *IncidentHandler) GetIncidentCategoryInsights(context *gin.Context
 		return nil, problems.FromError(err)
 	}
 
-	return handler.incidentService.GetIncidentCategoryInsights(filter)
+	return handler.incidentService.GetIncidentCategoryInsights(context.Request.Context(), filter)
 }
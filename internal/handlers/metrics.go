@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/metrics"
+)
+
+// MetricsHandler handles the Prometheus scrape route
+type MetricsHandler struct {
+	metrics *metrics.Metrics
+}
+
+// NewMetricsHandler registers the Prometheus scrape route
+func NewMetricsHandler(router *gin.Engine, metrics *metrics.Metrics) *MetricsHandler {
+	handler := &MetricsHandler{metrics}
+
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	return handler
+}
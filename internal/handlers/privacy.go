@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/constants"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/services"
+)
+
+// PrivacyHandler handles personal data routes
+type PrivacyHandler struct {
+	privacyService *services.PrivacyService
+	jwtHelper      *helpers.JwtHelper
+}
+
+// NewPrivacyHandler registers personal data routes
+func NewPrivacyHandler(router *gin.Engine, privacyService *services.PrivacyService, jwtHelper *helpers.JwtHelper, deadlines *helpers.QueryDeadlines) *PrivacyHandler {
+	handler := &PrivacyHandler{privacyService, jwtHelper}
+
+	router.GET("/account/export", jwtHelper.RequireAuth(), deadlines.Report(), handler.ExportAccount)
+
+	return handler
+}
+
+// ExportAccount exports all personal data held about the current account
+// @Summary Export current account data
+// @Description Returns a ZIP archive of JSON files, or a single JSON document when format is json.
+// @Tags Account
+// @Produce application/zip
+// @Produce json
+// @Param format query string false "Export format" Enums(zip, json)
+// @Security BearerAuth
+// @Router /account/export [get]
+func (handler *PrivacyHandler) ExportAccount(context *gin.Context) {
+	userId := context.MustGet(constants.ContextClaimsKey).(map[string]any)["sub"].(string)
+
+	if context.Query("format") == "json" {
+		export, problem := handler.privacyService.ExportAccount(context.Request.Context(), userId)
+		if problem != nil {
+			problems.Write(context, problem)
+			return
+		}
+		context.JSON(http.StatusOK, export)
+		return
+	}
+
+	data, problem := handler.privacyService.ExportAccountArchive(context.Request.Context(), userId)
+	if problem != nil {
+		problems.Write(context, problem)
+		return
+	}
+
+	filename := fmt.Sprintf("konabra-export-%s.zip", time.Now().UTC().Format("20060102"))
+	context.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	context.Data(http.StatusOK, "application/zip", data)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/probes"
+)
+
+// ProbeHandler handles liveness and readiness routes
+type ProbeHandler struct {
+	prober *probes.Prober
+}
+
+// NewProbeHandler registers liveness and readiness routes
+func NewProbeHandler(router *gin.Engine, prober *probes.Prober) *ProbeHandler {
+	handler := &ProbeHandler{prober}
+
+	router.GET("/healthz", handler.Healthz)
+	router.GET("/readyz", handler.Readyz)
+
+	return handler
+}
+
+// Healthz reports whether the process is alive. It does not check dependencies
+// so that a database outage does not get every replica restarted.
+// @Summary Liveness probe
+// @Tags Health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func (handler *ProbeHandler) Healthz(context *gin.Context) {
+	context.JSON(http.StatusOK, gin.H{"status": probes.StatusOk})
+}
+
+// Readyz reports whether the database and SMTP server are reachable and the application accepts traffic
+// @Summary Readiness probe
+// @Tags Health
+// @Produce json
+// @Success 200 {object} probes.Status
+// @Failure 503 {object} probes.Status
+// @Router /readyz [get]
+func (handler *ProbeHandler) Readyz(context *gin.Context) {
+	status := handler.prober.Ready(context.Request.Context())
+	if !status.Ready {
+		context.JSON(http.StatusServiceUnavailable, status)
+		return
+	}
+	context.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/internal/problems"
+)
+
+// ProblemHandler documents the problem types returned by the api
+type ProblemHandler struct{}
+
+// NewProblemHandler registers the problem type documentation routes. The type
+// of every problem is a reference to one of these routes.
+func NewProblemHandler(router *gin.Engine) *ProblemHandler {
+	handler := &ProblemHandler{}
+
+	router.GET("/problems", handler.GetProblemTypes)
+	router.GET(problems.TypePath+":type", handler.GetProblemType)
+
+	return handler
+}
+
+// GetProblemTypes lists the problem types returned by the api
+// @Summary Get problem types
+// @Tags Problems
+// @Produce json
+// @Success 200 {array} problems.Type
+// @Router /problems [get]
+func (handler *ProblemHandler) GetProblemTypes(context *gin.Context) {
+	locale := locales.FromContext(context.Request.Context())
+
+	types := make([]problems.Type, 0, len(problems.Types))
+	for _, problemType := range problems.Types {
+		types = append(types, localizeProblemType(locale, problemType))
+	}
+	context.JSON(http.StatusOK, types)
+}
+
+// GetProblemType describes a problem type
+// @Summary Get problem type
+// @Tags Problems
+// @Produce json
+// @Param type path string true "Problem type slug"
+// @Success 200 {object} problems.Type
+// @Router /problems/{type} [get]
+func (handler *ProblemHandler) GetProblemType(context *gin.Context) {
+	problemType, ok := problems.TypeBySlug(context.Param("type"))
+	if !ok {
+		problems.Write(context, problems.NewProblem(http.StatusNotFound, "The requested resource was not found on this server."))
+		return
+	}
+	context.JSON(http.StatusOK, localizeProblemType(locales.FromContext(context.Request.Context()), problemType))
+}
+
+func localizeProblemType(locale string, problemType problems.Type) problems.Type {
+	problemType.Title = locales.Translate(locale, problemType.Title)
+	return problemType
+}
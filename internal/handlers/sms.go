@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/builds"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/services"
+	"go.uber.org/zap"
+)
+
+// smsSecretHeader carries the secret shared with the SMS provider
+const smsSecretHeader = "X-Sms-Secret"
+
+// SmsHandler handles the messages forwarded by the SMS provider
+type SmsHandler struct {
+	smsService *services.SmsService
+	config     *builds.Config
+}
+
+// NewSmsHandler registers the inbound SMS route when an SMS secret is configured
+func NewSmsHandler(router *gin.Engine, smsService *services.SmsService, config *builds.Config, rateLimiter *helpers.RateLimiter, deadlines *helpers.QueryDeadlines, logger *zap.Logger) *SmsHandler {
+	handler := &SmsHandler{smsService, config}
+
+	if config.SmsSecret == "" {
+		logger.Info("SMS channel is disabled, set SMS_SECRET to enable it")
+		return handler
+	}
+
+	// Callbacks arrive from the few addresses of the provider on behalf of every
+	// subscriber, so the per-address limit would soon reject all of them
+	rateLimiter.Exempt(helpers.RateLimitIp, "/sms", handler.hasSecret)
+	router.POST("/sms", handler.authenticate, deadlines.Standard(), handler.ReceiveSms)
+
+	return handler
+}
+
+// authenticate rejects messages that do not carry the shared secret, in the
+// header or, for providers that cannot send headers, in the query
+func (handler *SmsHandler) authenticate(context *gin.Context) {
+	if !handler.hasSecret(context) {
+		problems.Abort(context, problems.NewProblem(http.StatusUnauthorized, "The SMS secret is not valid."))
+	}
+}
+
+// hasSecret reports whether the request carries the secret shared with the provider
+func (handler *SmsHandler) hasSecret(context *gin.Context) bool {
+	secret := context.GetHeader(smsSecretHeader)
+	if secret == "" {
+		secret = context.Query("secret")
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(handler.config.SmsSecret)) == 1
+}
+
+// ReceiveSms handles a message sent to the reporting number
+// @Summary Receive an SMS
+// @Description Accepts the messages of SMS providers as a form or JSON. The sender, text and id are read from the first payload field present among SMS_FROM_FIELDS, SMS_TEXT_FIELDS and SMS_ID_FIELDS. The reply is sent to the sender by SMS and returned too, empty for messages already received.
+// @Tags Sms
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Param X-Sms-Secret header string false "Secret shared with the provider, or the secret query parameter"
+// @Param body body object true "Message in the format of the provider"
+// @Success 200 {object} services.SmsReplyModel
+// @Router /sms [post]
+func (handler *SmsHandler) ReceiveSms(context *gin.Context) {
+	payload, err := bindSmsPayload(context)
+	if err != nil {
+		problems.Write(context, problems.FromError(err))
+		return
+	}
+
+	form := services.InboundSmsForm{
+		Id:   pickSmsField(payload, handler.config.SmsIdFields),
+		From: pickSmsField(payload, handler.config.SmsFromFields),
+		Text: pickSmsField(payload, handler.config.SmsTextFields),
+	}
+
+	reply, problem := handler.smsService.ReceiveSms(context.Request.Context(), form)
+	if problem != nil {
+		problems.Write(context, problem)
+		return
+	}
+	if reply == nil {
+		reply = &services.SmsReplyModel{}
+	}
+
+	context.JSON(http.StatusOK, reply)
+}
+
+// bindSmsPayload reads the payload of a provider into a flat map, whatever its
+// content type
+func bindSmsPayload(context *gin.Context) (map[string]any, error) {
+	payload := map[string]any{}
+
+	if context.ContentType() == gin.MIMEJSON {
+		if err := context.ShouldBindJSON(&payload); err != nil {
+			return nil, err
+		}
+		return payload, nil
+	}
+
+	if err := context.Request.ParseForm(); err != nil {
+		return nil, err
+	}
+	for key, values := range context.Request.Form {
+		if len(values) > 0 {
+			payload[key] = values[0]
+		}
+	}
+	return payload, nil
+}
+
+// pickSmsField returns the value of the first field present in the payload
+// among a comma-separated list of field names
+func pickSmsField(payload map[string]any, fields string) string {
+	for _, field := range strings.Split(fields, ",") {
+		value, ok := payload[strings.TrimSpace(field)]
+		if !ok || value == nil {
+			continue
+		}
+		text := fmt.Sprint(value)
+		if number, isNumber := value.(float64); isNumber {
+			// Numeric ids and phone numbers would otherwise be printed in exponent form
+			text = strconv.FormatFloat(number, 'f', -1, 64)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/constants"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/services"
+)
+
+// SyncHandler handles the routes used by devices that report while offline
+type SyncHandler struct {
+	syncService *services.SyncService
+	jwtHelper   *helpers.JwtHelper
+}
+
+// NewSyncHandler registers sync routes
+func NewSyncHandler(router *gin.Engine, syncService *services.SyncService, jwtHelper *helpers.JwtHelper, rateLimiter *helpers.RateLimiter, deadlines *helpers.QueryDeadlines) *SyncHandler {
+	handler := &SyncHandler{syncService, jwtHelper}
+
+	syncGroup := router.Group("/sync", jwtHelper.RequireAuth(), rateLimiter.Limit(helpers.RateLimitUser, helpers.RateLimitByUser), deadlines.Standard())
+	{
+		syncGroup.GET("", handler.handleWithData(handler.GetChanges))
+		syncGroup.POST("", rateLimiter.Limit(helpers.RateLimitIncidentCreate, helpers.RateLimitByUser), handler.handleWithData(handler.Sync))
+	}
+
+	return handler
+}
+
+func (handler *SyncHandler) handleWithData(handlerFunc func(*gin.Context) (any, *problems.Problem)) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		response, problem := handlerFunc(context)
+		if problem != nil {
+			problems.Write(context, problem)
+			return
+		}
+		helpers.WriteCachedJSON(context, http.StatusOK, response)
+	}
+}
+
+// Sync applies a batch of incident reports and edits made offline
+// @Summary Sync offline reports and edits
+// @Description Items are applied in order and each gets its own result. Reports keep the id generated by the device and are dated by their capture time. An edit based on an older version of an incident is applied when it was captured after the latest change, otherwise its result is a conflict with the current incident.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Param body body services.SyncForm true "Batch of reports and edits"
+// @Security BearerAuth
+// @Router /sync [post]
+func (handler *SyncHandler) Sync(context *gin.Context) (any, *problems.Problem) {
+	var form services.SyncForm
+	if err := context.ShouldBindJSON(&form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	claims := context.MustGet(constants.ContextClaimsKey).(map[string]any)
+	userId := claims["sub"].(string)
+
+	return handler.syncService.Sync(context.Request.Context(), userId, form)
+}
+
+// GetChanges retrieves the incidents and categories changed since the last sync
+// @Summary Get changes since the last sync
+// @Description Deleted records are returned as tombstones. Read pages with after until nextCursor is empty, then pass until as since on the next sync.
+// @Tags Sync
+// @Accept json
+// @Produce json
+// @Param filter query services.SyncChangesFilter false "Changes filter"
+// @Security BearerAuth
+// @Router /sync [get]
+func (handler *SyncHandler) GetChanges(context *gin.Context) (any, *problems.Problem) {
+	var filter services.SyncChangesFilter
+	if err := context.ShouldBindQuery(&filter); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	return handler.syncService.GetChanges(context.Request.Context(), filter)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/builds"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/services"
+	"go.uber.org/zap"
+)
+
+// ussdSecretHeader carries the secret shared with the USSD aggregator
+const ussdSecretHeader = "X-Ussd-Secret"
+
+// UssdHandler handles the callbacks of the USSD aggregator
+type UssdHandler struct {
+	ussdService *services.UssdService
+	config      *builds.Config
+}
+
+// NewUssdHandler registers the USSD callback route when a USSD secret is configured
+func NewUssdHandler(router *gin.Engine, ussdService *services.UssdService, config *builds.Config, rateLimiter *helpers.RateLimiter, deadlines *helpers.QueryDeadlines, logger *zap.Logger) *UssdHandler {
+	handler := &UssdHandler{ussdService, config}
+
+	if config.UssdSecret == "" {
+		logger.Info("USSD channel is disabled, set USSD_SECRET to enable it")
+		return handler
+	}
+
+	// Callbacks arrive from the few addresses of the provider on behalf of every
+	// subscriber, so the per-address limit would soon reject all of them
+	rateLimiter.Exempt(helpers.RateLimitIp, "/ussd", handler.hasSecret)
+	router.POST("/ussd", handler.authenticate, deadlines.Standard(), handler.HandleSession)
+
+	return handler
+}
+
+// authenticate rejects callbacks that do not carry the shared secret, in the
+// header or, for aggregators that cannot send headers, in the query
+func (handler *UssdHandler) authenticate(context *gin.Context) {
+	if !handler.hasSecret(context) {
+		problems.Abort(context, problems.NewProblem(http.StatusUnauthorized, "The USSD secret is not valid."))
+	}
+}
+
+// hasSecret reports whether the request carries the secret shared with the provider
+func (handler *UssdHandler) hasSecret(context *gin.Context) bool {
+	secret := context.GetHeader(ussdSecretHeader)
+	if secret == "" {
+		secret = context.Query("secret")
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(handler.config.UssdSecret)) == 1
+}
+
+// HandleSession replies to a USSD callback with the next screen of the session
+// @Summary Handle a USSD callback
+// @Description Accepts the callback of USSD aggregators as a form or JSON. The reply is plain text starting with CON when the session continues, or END when it ends.
+// @Tags Ussd
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce plain
+// @Param X-Ussd-Secret header string false "Secret shared with the aggregator, or the secret query parameter"
+// @Param body body services.UssdForm true "USSD callback"
+// @Router /ussd [post]
+func (handler *UssdHandler) HandleSession(context *gin.Context) {
+	var form services.UssdForm
+	if err := context.ShouldBind(&form); err != nil {
+		problems.Write(context, problems.FromError(err))
+		return
+	}
+
+	screen, problem := handler.ussdService.HandleSession(context.Request.Context(), form)
+	if problem != nil {
+		problems.Write(context, problem)
+		return
+	}
+
+	prefix := "CON "
+	if screen.End {
+		prefix = "END "
+	}
+	context.String(http.StatusOK, prefix+screen.Message)
+}
@@ -0,0 +1,149 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/prince272/konabra/internal/constants"
+	"github.com/prince272/konabra/internal/logging"
+	models "github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/utils"
+)
+
+const (
+	ApiKeyHeader = "X-Api-Key"
+	ApiKeyPrefix = "kb_"
+
+	// apiKeyTouchInterval limits how often the last used time of a key is written
+	apiKeyTouchInterval = 1 * time.Minute
+)
+
+type ApiKeyHelper struct {
+	defaultDb *gorm.DB
+	deadlines *QueryDeadlines
+	logger    *zap.Logger
+}
+
+func NewApiKeyHelper(defaultDb *gorm.DB, deadlines *QueryDeadlines, logger *zap.Logger) *ApiKeyHelper {
+	return &ApiKeyHelper{
+		defaultDb: defaultDb,
+		deadlines: deadlines,
+		logger:    logger,
+	}
+}
+
+// GenerateApiKey creates a new random API key and returns it together with its
+// display prefix and hash. Only the hash should be stored.
+func GenerateApiKey() (key string, prefix string, hash string) {
+	key = utils.GenerateUniqueCode(ApiKeyPrefix, 40, utils.AlphanumericUniqueCode, "")
+	return key, key[:len(ApiKeyPrefix)+6], utils.HashToken(key)
+}
+
+// Authenticate accepts requests carrying an X-Api-Key header and populates the
+// same claims RequireAuth expects. Requests without the header are passed through.
+func (helper *ApiKeyHelper) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(ApiKeyHeader)
+		if key == "" {
+			return
+		}
+
+		// The route deadlines are applied after this middleware, so the key
+		// queries get the standard deadline of their own
+		ctx, cancel := helper.deadlines.StandardContext(c.Request.Context())
+		defer cancel()
+
+		apiKey, err := helper.verifyKey(ctx, key)
+		if err != nil {
+			logging.FromContext(ctx, helper.logger).Warn("Failed to verify api key", zap.Error(err))
+			problem := problems.NewProblem(http.StatusUnauthorized, "You are not authorized to perform this action.")
+			problems.Abort(c, problem)
+			return
+		}
+
+		if scope := requiredScope(c); scope == "" || !apiKey.HasScope(scope) {
+			logging.FromContext(ctx, helper.logger).Warn("Access denied for api key scope", zap.String("apiKeyId", apiKey.Id), zap.String("requiredScope", scope))
+			problem := problems.NewProblem(http.StatusForbidden, "You don't have the necessary permissions.")
+			problems.Abort(c, problem)
+			return
+		}
+
+		helper.touchKey(ctx, apiKey)
+		SetRequestUserId(c, apiKey.UserId)
+
+		c.Set(constants.ContextClaimsKey, map[string]any{
+			"sub":      apiKey.UserId,
+			"email":    apiKey.User.Email,
+			"roles":    apiKey.User.Roles(),
+			"scopes":   apiKey.ScopeList(),
+			"apiKeyId": apiKey.Id,
+		})
+	}
+}
+
+func (helper *ApiKeyHelper) verifyKey(ctx context.Context, key string) (*models.ApiKey, error) {
+	if !strings.HasPrefix(key, ApiKeyPrefix) {
+		return nil, errors.New("api key has an invalid format")
+	}
+
+	apiKey := &models.ApiKey{}
+	result := helper.defaultDb.WithContext(ctx).Model(&models.ApiKey{}).
+		Preload("User").
+		Preload("User.UserRoles").
+		Where("key_hash = ?", utils.HashToken(key)).
+		First(apiKey)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("api key not found")
+		}
+		return nil, result.Error
+	}
+
+	if apiKey.IsExpired() {
+		return nil, errors.New("api key has expired")
+	}
+
+	if apiKey.User == nil || apiKey.User.Status != models.UserStatusActive {
+		return nil, errors.New("api key owner is not active")
+	}
+
+	return apiKey, nil
+}
+
+func (helper *ApiKeyHelper) touchKey(ctx context.Context, apiKey *models.ApiKey) {
+	now := time.Now()
+	if apiKey.LastUsedAt != nil && now.Sub(*apiKey.LastUsedAt) < apiKeyTouchInterval {
+		return
+	}
+
+	if err := helper.defaultDb.WithContext(ctx).Model(&models.ApiKey{}).
+		Where("id = ?", apiKey.Id).
+		Update("last_used_at", now).Error; err != nil {
+		logging.FromContext(ctx, helper.logger).Error("Failed to update api key last used time", zap.Error(err))
+	}
+}
+
+// requiredScope derives the scope needed for a route from its first path
+// segment and method, e.g. GET /incidents/:id requires incidents:read.
+func requiredScope(c *gin.Context) string {
+	resource := strings.SplitN(strings.TrimPrefix(c.FullPath(), "/"), "/", 2)[0]
+	if resource == "" {
+		return ""
+	}
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return resource + ":read"
+	default:
+		return resource + ":write"
+	}
+}
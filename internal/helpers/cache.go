@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/problems"
+)
+
+// LastModifier is implemented by responses that know when their content last
+// changed. Lists do not implement it, since removing an item or shifting a page
+// leaves the newest UpdatedAt unchanged; they rely on the ETag of their body.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// Versioned is implemented by responses for a record with a version that is
+// incremented on every update. The version leads their ETag so that the ETag
+// can be sent back in If-Match to update the record.
+type Versioned interface {
+	ResourceVersion() int64
+}
+
+// WriteCachedJSON writes a JSON response tagged with an ETag computed from its
+// body, and with Last-Modified when the response knows it. A GET request whose
+// If-None-Match or If-Modified-Since shows the client already has the response
+// is answered with 304 Not Modified and no body.
+func WriteCachedJSON(c *gin.Context, status int, response any) {
+	if status != http.StatusOK {
+		c.JSON(status, response)
+		return
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		problems.Write(c, problems.FromError(err))
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := base64.RawURLEncoding.EncodeToString(sum[:16])
+	if versioned, ok := response.(Versioned); ok {
+		etag = strconv.FormatInt(versioned.ResourceVersion(), 10) + "-" + etag
+	}
+	etag = `"` + etag + `"`
+	c.Header("ETag", etag)
+
+	// Responses to updates carry the ETag of the new version but are not cached
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.Data(status, "application/json; charset=utf-8", body)
+		return
+	}
+	c.Header("Cache-Control", "private, no-cache")
+
+	var lastModified time.Time
+	if modifier, ok := response.(LastModifier); ok {
+		lastModified = modifier.LastModified().UTC().Truncate(time.Second)
+	}
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	if notModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+
+	c.Data(status, "application/json; charset=utf-8", body)
+}
+
+// notModified reports whether the client's copy is current. If-Modified-Since
+// is only considered when the request has no If-None-Match, as RFC 9110 requires.
+func notModified(request *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(request.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
+
+// IfMatchVersion returns the record version named by the If-Match header of an
+// update, or nil when the header is missing or is "*". The header holds the
+// ETag of a Versioned response, or just the version.
+func IfMatchVersion(c *gin.Context) (*int64, *problems.Problem) {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil, nil
+	}
+
+	etag := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+	versionText, _, _ := strings.Cut(etag, "-")
+	version, err := strconv.ParseInt(versionText, 10, 64)
+	if err != nil || version <= 0 {
+		return nil, problems.NewProblem(http.StatusBadRequest, "The If-Match header is not valid.")
+	}
+	return &version, nil
+}
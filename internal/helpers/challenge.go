@@ -0,0 +1,148 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prince272/konabra/utils"
+)
+
+var (
+	ErrChallengeInvalid  = errors.New("challenge code is invalid or has expired")
+	ErrChallengeLocked   = errors.New("challenge is locked after too many failed attempts")
+	ErrChallengeCooldown = errors.New("challenge was issued too recently")
+)
+
+// ChallengePolicy controls the lifetime and limits of a verification challenge
+type ChallengePolicy struct {
+	TTL         time.Duration // How long an issued code stays valid
+	MaxAttempts int           // Failed attempts allowed before the subject is locked out
+	Cooldown    time.Duration // Minimum time between two issued codes
+	Lockout     time.Duration // How long the subject is locked out after too many failed attempts
+	Digits      int           // Number of digits in the code
+}
+
+type challenge struct {
+	codeHash string
+}
+
+// challengeAttempts counts the failed attempts of a subject across the codes
+// issued to it, so that asking for a new code does not grant new guesses
+type challengeAttempts struct {
+	count int
+}
+
+// ChallengeStore issues single-use verification codes and keeps their state,
+// so codes survive slow delivery channels but cannot be replayed or guessed.
+type ChallengeStore struct {
+	state *State
+	mu    sync.Mutex
+}
+
+func NewChallengeStore(state *State) *ChallengeStore {
+	return &ChallengeStore{state: state}
+}
+
+// Issue creates a new code for the purpose and subject, replacing any pending one
+func (store *ChallengeStore) Issue(purpose, subject string, policy ChallengePolicy) (string, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.state.HasKey(store.lockoutKey(purpose, subject)) {
+		return "", ErrChallengeLocked
+	}
+
+	if policy.Cooldown > 0 && !store.state.AddItem(store.cooldownKey(purpose, subject), true, policy.Cooldown) {
+		return "", ErrChallengeCooldown
+	}
+
+	digits := policy.Digits
+	if digits <= 0 {
+		digits = 6
+	}
+
+	code := utils.GenerateUniqueCode("", digits, utils.NumericUniqueCode, "")
+	store.state.SetItem(store.challengeKey(purpose, subject), &challenge{codeHash: utils.HashToken(code)}, policy.TTL)
+
+	return code, nil
+}
+
+// Verify checks the code and invalidates the challenge when it matches
+func (store *ChallengeStore) Verify(purpose, subject, code string, policy ChallengePolicy) error {
+	return store.verify(purpose, subject, code, policy, true)
+}
+
+// Check verifies the code like Verify but keeps the challenge open on success
+func (store *ChallengeStore) Check(purpose, subject, code string, policy ChallengePolicy) error {
+	return store.verify(purpose, subject, code, policy, false)
+}
+
+// Invalidate removes any pending challenge for the purpose and subject
+func (store *ChallengeStore) Invalidate(purpose, subject string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.state.RemoveItem(store.challengeKey(purpose, subject))
+}
+
+func (store *ChallengeStore) verify(purpose, subject, code string, policy ChallengePolicy, consume bool) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.state.HasKey(store.lockoutKey(purpose, subject)) {
+		return ErrChallengeLocked
+	}
+
+	key := store.challengeKey(purpose, subject)
+	current, ok := store.state.PeekItem(key).(*challenge)
+	if !ok {
+		return ErrChallengeInvalid
+	}
+
+	attemptsKey := store.attemptsKey(purpose, subject)
+	if hmac.Equal([]byte(current.codeHash), []byte(utils.HashToken(code))) {
+		if consume {
+			store.state.RemoveItem(key)
+		}
+		store.state.RemoveItem(attemptsKey)
+		return nil
+	}
+
+	attempts, ok := store.state.PeekItem(attemptsKey).(*challengeAttempts)
+	if !ok {
+		attempts = &challengeAttempts{}
+	}
+	attempts.count++
+
+	if policy.MaxAttempts > 0 && attempts.count >= policy.MaxAttempts {
+		store.state.RemoveItem(key)
+		store.state.RemoveItem(attemptsKey)
+		store.state.SetItem(store.lockoutKey(purpose, subject), true, policy.Lockout)
+		return ErrChallengeLocked
+	}
+
+	// The count is kept across reissued codes, until a period as long as a code
+	// or a lockout lasts passes without failures
+	store.state.SetItem(attemptsKey, attempts, max(policy.TTL, policy.Lockout))
+
+	return ErrChallengeInvalid
+}
+
+func (store *ChallengeStore) challengeKey(purpose, subject string) string {
+	return fmt.Sprintf("challenge:%v:%v", purpose, subject)
+}
+
+func (store *ChallengeStore) cooldownKey(purpose, subject string) string {
+	return fmt.Sprintf("challenge:cooldown:%v:%v", purpose, subject)
+}
+
+func (store *ChallengeStore) attemptsKey(purpose, subject string) string {
+	return fmt.Sprintf("challenge:attempts:%v:%v", purpose, subject)
+}
+
+func (store *ChallengeStore) lockoutKey(purpose, subject string) string {
+	return fmt.Sprintf("challenge:lockout:%v:%v", purpose, subject)
+}
@@ -0,0 +1,25 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prince272/konabra/utils"
+)
+
+// CodeStore keeps track of stateless codes and tokens that have already been
+// redeemed so they cannot be replayed within their validity window.
+type CodeStore struct {
+	state *State
+}
+
+func NewCodeStore(state *State) *CodeStore {
+	return &CodeStore{state: state}
+}
+
+// Consume marks the code as used for the given purpose and subject. It returns
+// false if the code has already been consumed within its validity window.
+func (store *CodeStore) Consume(purpose, subject, code string, validity time.Duration) bool {
+	key := fmt.Sprintf("code:consumed:%v:%v:%v", purpose, subject, utils.HashToken(code))
+	return store.state.AddItem(key, true, validity)
+}
@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QueryDeadlines bounds how long a request may spend waiting on the database.
+// The deadline is carried by the request context, so queries started with it
+// are cancelled once it passes or when the client disconnects.
+type QueryDeadlines struct {
+	standard time.Duration
+	report   time.Duration
+}
+
+func NewQueryDeadlines(standard, report time.Duration) *QueryDeadlines {
+	return &QueryDeadlines{standard, report}
+}
+
+// Standard applies the deadline for ordinary reads and writes
+func (deadlines *QueryDeadlines) Standard() gin.HandlerFunc {
+	return withDeadline(deadlines.standard)
+}
+
+// Report applies the longer deadline for statistics, insights and exports
+func (deadlines *QueryDeadlines) Report() gin.HandlerFunc {
+	return withDeadline(deadlines.report)
+}
+
+// StandardContext bounds work done outside the routes, such as the middleware
+// that runs before the route deadlines are applied
+func (deadlines *QueryDeadlines) StandardContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, deadlines.standard)
+}
+
+func withDeadline(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
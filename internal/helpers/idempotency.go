@@ -0,0 +1,343 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/prince272/konabra/internal/logging"
+	models "github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed" // Set to true on responses replayed for a key
+)
+
+const (
+	IdempotencyStoreMemory   = "memory"   // Keys are kept by each instance
+	IdempotencyStoreDatabase = "database" // Keys are shared by every instance through the database
+)
+
+// idempotencyKeyMaxLength is the length of the longest key accepted
+const idempotencyKeyMaxLength = 255
+
+// idempotencySweepInterval is how often expired keys are removed from a store
+const idempotencySweepInterval = time.Minute
+
+// idempotencyAbandonedAfter is how long a key can stay reserved. A request
+// still running after this long is assumed to have died with its instance.
+const idempotencyAbandonedAfter = 5 * time.Minute
+
+// IdempotentResponse is the response stored for an idempotency key. A zero
+// status means the first request with the key is still being processed.
+type IdempotentResponse struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// IdempotencyStore keeps the responses sent for idempotency keys
+type IdempotencyStore interface {
+	// Begin reserves the key for a request. It returns nil when the key was
+	// free, or what is stored for the key when it is taken.
+	Begin(ctx context.Context, key string, fingerprint string, retention time.Duration) (*IdempotentResponse, error)
+	// Complete stores the response sent for a reserved key
+	Complete(ctx context.Context, key string, response IdempotentResponse) error
+	// Release frees a reserved key so that the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+type memoryIdempotencyEntry struct {
+	response  IdempotentResponse
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryIdempotencyStore keeps the keys in memory. Retries reaching another
+// instance of the api are not recognized.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]*memoryIdempotencyEntry{}, lastSweep: time.Now()}
+}
+
+func (store *MemoryIdempotencyStore) Begin(ctx context.Context, key string, fingerprint string, retention time.Duration) (*IdempotentResponse, error) {
+	now := time.Now()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if now.Sub(store.lastSweep) >= idempotencySweepInterval {
+		for entryKey, entry := range store.entries {
+			if now.After(entry.expiresAt) {
+				delete(store.entries, entryKey)
+			}
+		}
+		store.lastSweep = now
+	}
+
+	if entry, ok := store.entries[key]; ok && now.Before(entry.expiresAt) && !entry.abandoned(now) {
+		response := entry.response
+		return &response, nil
+	}
+
+	store.entries[key] = &memoryIdempotencyEntry{
+		response:  IdempotentResponse{Fingerprint: fingerprint},
+		createdAt: now,
+		expiresAt: now.Add(retention),
+	}
+	return nil, nil
+}
+
+func (store *MemoryIdempotencyStore) Complete(ctx context.Context, key string, response IdempotentResponse) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if entry, ok := store.entries[key]; ok {
+		entry.response = response
+	}
+	return nil
+}
+
+func (store *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.entries, key)
+	return nil
+}
+
+func (entry *memoryIdempotencyEntry) abandoned(now time.Time) bool {
+	return entry.response.Status == 0 && now.Sub(entry.createdAt) >= idempotencyAbandonedAfter
+}
+
+// DatabaseIdempotencyStore keeps the keys in the database so that a retry is
+// recognized by every instance of the api
+type DatabaseIdempotencyStore struct {
+	defaultDb *gorm.DB
+	logger    *zap.Logger
+	lastSweep atomic.Int64
+}
+
+func NewDatabaseIdempotencyStore(defaultDb *gorm.DB, logger *zap.Logger) *DatabaseIdempotencyStore {
+	store := &DatabaseIdempotencyStore{defaultDb: defaultDb, logger: logger}
+	store.lastSweep.Store(time.Now().UnixNano())
+	return store
+}
+
+func (store *DatabaseIdempotencyStore) Begin(ctx context.Context, key string, fingerprint string, retention time.Duration) (*IdempotentResponse, error) {
+	now := time.Now()
+	store.sweep(now)
+
+	db := store.defaultDb.WithContext(ctx)
+
+	// Expired keys and keys of requests that never finished can be taken again
+	if err := db.Where("key = ? AND (expires_at < ? OR (status = 0 AND created_at < ?))", key, now, now.Add(-idempotencyAbandonedAfter)).
+		Delete(&models.IdempotencyRecord{}).Error; err != nil {
+		return nil, err
+	}
+
+	record := &models.IdempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: now, ExpiresAt: now.Add(retention)}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	if err := db.Where(&models.IdempotencyRecord{Key: key}).First(record).Error; err != nil {
+		return nil, err
+	}
+	return &IdempotentResponse{
+		Fingerprint: record.Fingerprint,
+		Status:      record.Status,
+		ContentType: record.ContentType,
+		Body:        record.Body,
+	}, nil
+}
+
+func (store *DatabaseIdempotencyStore) Complete(ctx context.Context, key string, response IdempotentResponse) error {
+	return store.defaultDb.WithContext(ctx).Model(&models.IdempotencyRecord{}).
+		Where("key = ?", key).
+		Updates(map[string]any{"status": response.Status, "content_type": response.ContentType, "body": response.Body}).Error
+}
+
+func (store *DatabaseIdempotencyStore) Release(ctx context.Context, key string) error {
+	return store.defaultDb.WithContext(ctx).Where("key = ?", key).Delete(&models.IdempotencyRecord{}).Error
+}
+
+// sweep deletes expired keys at most once per sweep interval
+func (store *DatabaseIdempotencyStore) sweep(now time.Time) {
+	lastSweep := store.lastSweep.Load()
+	if now.Sub(time.Unix(0, lastSweep)) < idempotencySweepInterval || !store.lastSweep.CompareAndSwap(lastSweep, now.UnixNano()) {
+		return
+	}
+
+	if err := store.defaultDb.Where("expires_at < ?", now).Delete(&models.IdempotencyRecord{}).Error; err != nil {
+		store.logger.Warn("Failed to delete expired idempotency keys", zap.Error(err))
+	}
+}
+
+// Idempotency makes POST requests safe to retry. The response to the first
+// request sent with an Idempotency-Key header is stored and sent again for
+// retries with the same key, instead of running the request twice.
+type Idempotency struct {
+	store     IdempotencyStore
+	retention time.Duration
+	logger    *zap.Logger
+}
+
+func NewIdempotency(store IdempotencyStore, retention time.Duration, logger *zap.Logger) *Idempotency {
+	return &Idempotency{store, retention, logger}
+}
+
+// Middleware honours the Idempotency-Key header on POST requests. Keys are
+// scoped to the credentials of the request, or to the client address when it
+// has none. A retry that arrives while the first request is still running gets
+// 409 Conflict, and reusing a key for a different request gets 422.
+func (idempotency *Idempotency) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			return
+		}
+		if len(key) > idempotencyKeyMaxLength {
+			problems.Abort(c, problems.NewProblem(http.StatusBadRequest, "The Idempotency-Key header is not valid."))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problems.Abort(c, problems.FromError(err))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		log := logging.FromContext(c.Request.Context(), idempotency.logger)
+		storeKey := idempotencyScope(c) + ":" + key
+		fingerprint := idempotencyHash(c.Request.Method, c.Request.URL.Path, string(body))
+
+		stored, err := idempotency.store.Begin(c.Request.Context(), storeKey, fingerprint, idempotency.retention)
+		if err != nil {
+			// Fail open so that an unavailable store does not take the api down
+			log.Error("Failed to read idempotency key", zap.Error(err))
+			return
+		}
+
+		switch {
+		case stored == nil:
+		case stored.Fingerprint != fingerprint:
+			problems.Abort(c, problems.New(problems.TypeIdempotencyKeyReused, "The idempotency key was already used for a different request."))
+			return
+		case stored.Status == 0:
+			c.Header("Retry-After", "1")
+			problems.Abort(c, problems.NewProblem(http.StatusConflict, "A request with this idempotency key is still being processed."))
+			return
+		default:
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(stored.Status, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		// The client may be gone by the time the request completes, which is
+		// when the stored response matters most
+		ctx := context.WithoutCancel(c.Request.Context())
+		release := func() {
+			if err := idempotency.store.Release(ctx, storeKey); err != nil {
+				log.Error("Failed to release idempotency key", zap.Error(err))
+			}
+		}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				release()
+				panic(recovered)
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		status := c.Writer.Status()
+		if retryable(status) {
+			release()
+			return
+		}
+
+		response := IdempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		}
+		if err := idempotency.store.Complete(ctx, storeKey, response); err != nil {
+			log.Error("Failed to store idempotent response", zap.Error(err))
+		}
+	}
+}
+
+// retryable reports whether a response leaves the request free to be retried
+// with the same key, rather than being sent again to retries
+func retryable(status int) bool {
+	return status >= http.StatusInternalServerError ||
+		status == http.StatusTooManyRequests ||
+		status == http.StatusRequestTimeout ||
+		status == problems.StatusClientClosedRequest
+}
+
+// idempotencyScope identifies who a key belongs to, so that clients cannot
+// see each other's responses by guessing keys
+func idempotencyScope(c *gin.Context) string {
+	if authorization := c.GetHeader("Authorization"); authorization != "" {
+		return "auth:" + idempotencyHash(authorization)
+	}
+	if apiKey := c.GetHeader(ApiKeyHeader); apiKey != "" {
+		return "apikey:" + idempotencyHash(apiKey)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func idempotencyHash(values ...string) string {
+	digest := sha256.New()
+	for _, value := range values {
+		digest.Write([]byte(value))
+		digest.Write([]byte{0})
+	}
+	return hex.EncodeToString(digest.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (writer *recordingWriter) Write(data []byte) (int, error) {
+	writer.body.Write(data)
+	return writer.ResponseWriter.Write(data)
+}
+
+func (writer *recordingWriter) WriteString(data string) (int, error) {
+	writer.body.WriteString(data)
+	return writer.ResponseWriter.WriteString(data)
+}
@@ -349,11 +349,23 @@ func (helper *JwtHelper) VerifyRefreshToken(tokenString string) (map[string]any,
 
 func (helper *JwtHelper) RequireAuth(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Claims may already be set by another authenticator such as an api key
+		if value, exists := c.Get(constants.ContextClaimsKey); exists {
+			if claims, ok := value.(map[string]any); ok {
+				if len(roles) > 0 && !helper.hasRequiredRole(claims, roles) {
+					helper.logger.Warn("Access denied for roles", zap.Strings("requiredRoles", roles))
+					problem := problems.NewProblem(http.StatusForbidden, "You don't have the necessary permissions.")
+					problems.Abort(c, problem)
+				}
+				return
+			}
+		}
+
 		token, err := helper.extractBearerToken(c)
 		if err != nil {
 			helper.logger.Warn("Failed to extract token", zap.Error(err))
 			problem := problems.NewProblem(http.StatusUnauthorized, "You are not authorized to perform this action.")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, problem)
+			problems.Abort(c, problem)
 			return
 		}
 
@@ -361,17 +373,21 @@ func (helper *JwtHelper) RequireAuth(roles ...string) gin.HandlerFunc {
 		if err != nil {
 			helper.logger.Warn("Failed to verify token", zap.Error(err))
 			problem := problems.NewProblem(http.StatusUnauthorized, "You are not authorized to perform this action.")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, problem)
+			problems.Abort(c, problem)
 			return
 		}
 
 		if len(roles) > 0 && !helper.hasRequiredRole(claims, roles) {
 			helper.logger.Warn("Access denied for roles", zap.Strings("requiredRoles", roles))
 			problem := problems.NewProblem(http.StatusForbidden, "You don't have the necessary permissions.")
-			c.AbortWithStatusJSON(http.StatusForbidden, problem)
+			problems.Abort(c, problem)
 			return
 		}
 
+		if sub, ok := claims["sub"].(string); ok {
+			SetRequestUserId(c, sub)
+		}
+
 		c.Set(constants.ContextClaimsKey, claims)
 	}
 }
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type shutdownHook struct {
+	name     string
+	function func(ctx context.Context) error
+}
+
+// Lifecycle collects the shutdown hooks of long-lived components such as
+// background workers and connection pools
+type Lifecycle struct {
+	hooks []shutdownHook
+	mu    sync.Mutex
+	done  bool
+}
+
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{}
+}
+
+// OnShutdown registers a hook to run on shutdown. Hooks run in the reverse
+// order of registration so that components stop before their dependencies.
+func (lifecycle *Lifecycle) OnShutdown(name string, function func(ctx context.Context) error) {
+	lifecycle.mu.Lock()
+	defer lifecycle.mu.Unlock()
+	lifecycle.hooks = append(lifecycle.hooks, shutdownHook{name, function})
+}
+
+// Shutdown runs every hook once, even when some fail, and returns their joined errors
+func (lifecycle *Lifecycle) Shutdown(ctx context.Context) error {
+	lifecycle.mu.Lock()
+	if lifecycle.done {
+		lifecycle.mu.Unlock()
+		return nil
+	}
+	lifecycle.done = true
+	hooks := lifecycle.hooks
+	lifecycle.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i].function(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", hooks[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
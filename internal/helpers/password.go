@@ -0,0 +1,127 @@
+package helpers
+
+import (
+	"bufio"
+	_ "embed"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/pkg/humanize"
+)
+
+//go:embed data/common-passwords.txt
+var commonPasswordsData string
+
+var (
+	commonPasswords        = loadCommonPasswords(commonPasswordsData)
+	passwordUpperPattern   = regexp.MustCompile(`[A-Z]`)
+	passwordLowerPattern   = regexp.MustCompile(`[a-z]`)
+	passwordDigitPattern   = regexp.MustCompile(`[0-9]`)
+	passwordSpecialPattern = regexp.MustCompile(`[^a-zA-Z0-9]`)
+	passwordSuffixPattern  = regexp.MustCompile(`[^a-z]+$`)
+)
+
+// PasswordPolicy describes the rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength  int // Minimum number of characters
+	MaxLength  int // Maximum number of characters
+	MinClasses int // Minimum number of character classes (upper, lower, digit, special)
+	MaxRepeats int // Maximum number of identical consecutive characters, 0 disables the check
+}
+
+// Check returns a message in the given locale describing the first rule the
+// password violates, or an empty string when the password satisfies the policy
+func (policy PasswordPolicy) Check(locale, field, password string) string {
+	fieldName := humanize.Humanize(field, humanize.SentenceCase)
+	length := utf8.RuneCountInString(password)
+
+	if length < policy.MinLength {
+		return locales.Sprintf(locale, "%v must be at least %d characters long.", fieldName, policy.MinLength)
+	}
+
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		return locales.Sprintf(locale, "%v must be at most %d characters long.", fieldName, policy.MaxLength)
+	}
+
+	classes := 0
+	for _, pattern := range []*regexp.Regexp{passwordUpperPattern, passwordLowerPattern, passwordDigitPattern, passwordSpecialPattern} {
+		if pattern.MatchString(password) {
+			classes++
+		}
+	}
+
+	if classes < policy.MinClasses {
+		return locales.Sprintf(locale, "%v must include at least %d of the following: uppercase letter, lowercase letter, number and special character.", fieldName, policy.MinClasses)
+	}
+
+	if policy.MaxRepeats > 0 && maxConsecutiveRepeats(password) > policy.MaxRepeats {
+		return locales.Sprintf(locale, "%v must not repeat the same character more than %d times in a row.", fieldName, policy.MaxRepeats)
+	}
+
+	if IsCommonPassword(password) {
+		return locales.Sprintf(locale, "%v is too common or has appeared in a data breach.", fieldName)
+	}
+
+	return ""
+}
+
+// IsCommonPassword reports whether the password, or the password without its
+// trailing digits and symbols, appears in the bundled compromised password list
+func IsCommonPassword(password string) bool {
+	normalized := strings.ToLower(password)
+	if _, ok := commonPasswords[normalized]; ok {
+		return true
+	}
+
+	if stem := passwordSuffixPattern.ReplaceAllString(normalized, ""); stem != normalized && stem != "" {
+		_, ok := commonPasswords[stem]
+		return ok
+	}
+
+	return false
+}
+
+func (policy PasswordPolicy) validate(fl validator.FieldLevel) bool {
+	return policy.Check(locales.English, fl.FieldName(), fl.Field().String()) == ""
+}
+
+func (policy PasswordPolicy) message(locale string, fieldError validator.FieldError) string {
+	value, _ := fieldError.Value().(string)
+	if message := policy.Check(locale, fieldError.Field(), value); message != "" {
+		return message
+	}
+	return locales.Sprintf(locale, "%v is not valid.", humanize.Humanize(fieldError.Field(), humanize.SentenceCase))
+}
+
+func maxConsecutiveRepeats(value string) int {
+	longest, current := 0, 0
+	var previous rune = -1
+	for _, r := range value {
+		if r == previous {
+			current++
+		} else {
+			current = 1
+			previous = r
+		}
+		if current > longest {
+			longest = current
+		}
+	}
+	return longest
+}
+
+func loadCommonPasswords(data string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+	return passwords
+}
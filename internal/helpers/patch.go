@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/problems"
+)
+
+// MergePatchContentType is the media type of JSON merge patches, see RFC 7396
+const MergePatchContentType = "application/merge-patch+json"
+
+// ReadMergePatch reads the JSON merge patch sent as the body of a PATCH request.
+// Bodies sent as application/json are accepted too, for clients that cannot set
+// the media type.
+func ReadMergePatch(c *gin.Context) (map[string]any, *problems.Problem) {
+	if contentType := c.ContentType(); contentType != MergePatchContentType && contentType != "application/json" {
+		return nil, problems.NewProblem(http.StatusUnsupportedMediaType, "The request body must be a JSON merge patch.")
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	var patch map[string]any
+	if err := json.Unmarshal(body, &patch); err != nil {
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			return nil, problems.FromError(err)
+		}
+		return nil, problems.NewProblem(http.StatusBadRequest, "The merge patch must be a JSON object.")
+	}
+	if patch == nil {
+		return nil, problems.NewProblem(http.StatusBadRequest, "The merge patch must be a JSON object.")
+	}
+	return patch, nil
+}
+
+// ApplyMergePatch applies a JSON merge patch to a form that holds the current
+// values of a record. Members set to null are removed, which leaves the matching
+// fields with their zero value, and objects are merged member by member.
+func ApplyMergePatch(form any, patch map[string]any) error {
+	data, err := json.Marshal(form)
+	if err != nil {
+		return err
+	}
+
+	var document map[string]any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(mergePatch(document, patch))
+	if err != nil {
+		return err
+	}
+
+	target := reflect.ValueOf(form).Elem()
+	target.SetZero()
+	return json.Unmarshal(data, form)
+}
+
+func mergePatch(target map[string]any, patch map[string]any) map[string]any {
+	if target == nil {
+		target = map[string]any{}
+	}
+	for name, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(target, name)
+		case map[string]any:
+			current, _ := target[name].(map[string]any)
+			target[name] = mergePatch(current, value)
+		default:
+			target[name] = value
+		}
+	}
+	return target
+}
+
+// ValidatePatch validates the fields of a patched form that were named by the
+// patch, so that values the client did not touch are kept as they are
+func (helper *Validator) ValidatePatch(form any, patch map[string]any) error {
+	formType := reflect.TypeOf(form)
+	for formType.Kind() == reflect.Pointer {
+		formType = formType.Elem()
+	}
+
+	fields := patchedFields(formType, "", patch)
+	if len(fields) == 0 {
+		return nil
+	}
+	return helper.validate.StructPartial(form, fields...)
+}
+
+// patchedFields returns the paths, relative to the form, of the fields named by
+// the patch, looking into embedded structs as JSON does. Partial validation
+// matches fields by their Go names, while patches name them by their JSON names.
+func patchedFields(structType reflect.Type, prefix string, patch map[string]any) []string {
+	var fields []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, patchedFields(field.Type, prefix+field.Name+".", patch)...)
+			continue
+		}
+		if _, ok := patch[problems.FieldName(field)]; ok {
+			fields = append(fields, prefix+field.Name)
+		}
+	}
+	return fields
+}
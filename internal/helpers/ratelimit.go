@@ -0,0 +1,298 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/metrics"
+	models "github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+)
+
+const (
+	RateLimitIp             = "ip"              // Every request, by client address
+	RateLimitUser           = "user"            // Authenticated requests, by user
+	RateLimitSignIn         = "signin"          // Sign-in and account creation, by client address
+	RateLimitCode           = "code"            // Requests that send a one-time code, by client address
+	RateLimitIncidentCreate = "incident-create" // Incident reports, by user
+)
+
+const (
+	RateLimitStoreMemory   = "memory"   // Counters are kept by each instance
+	RateLimitStoreDatabase = "database" // Counters are shared by every instance through the database
+)
+
+// rateLimitSweepInterval is how often idle buckets are removed from a store
+const rateLimitSweepInterval = time.Minute
+
+// rateLimitRetention is how long an idle bucket is kept in the database. A
+// bucket that has been idle for longer than its period is full and can be dropped.
+const rateLimitRetention = 24 * time.Hour
+
+// rateLimitRemainingKey holds the lowest remaining count reported by the
+// rate limits applied to the request so that the headers describe the closest limit
+const rateLimitRemainingKey = "rateLimitRemaining"
+
+// RateLimit allows a number of requests per period, refilled continuously
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseRateLimit parses a rate limit written as "<requests>/<period>", such as
+// "10/1m". An empty value, "0" or "off" disables the limit.
+func ParseRateLimit(value string) (RateLimit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" || value == "off" {
+		return RateLimit{}, nil
+	}
+
+	requests, period, found := strings.Cut(value, "/")
+	if !found {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<period>", value)
+	}
+
+	limit := RateLimit{}
+	var err error
+	if limit.Requests, err = strconv.Atoi(requests); err != nil || limit.Requests < 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, requests must be a positive number", value)
+	}
+	if limit.Period, err = time.ParseDuration(period); err != nil || limit.Period <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, period must be a positive duration", value)
+	}
+	return limit, nil
+}
+
+// Enabled reports whether the limit restricts anything
+func (limit RateLimit) Enabled() bool {
+	return limit.Requests > 0 && limit.Period > 0
+}
+
+// rate returns the number of tokens added to the bucket per second
+func (limit RateLimit) rate() float64 {
+	return float64(limit.Requests) / limit.Period.Seconds()
+}
+
+// take refills a bucket holding the given tokens since it was last updated and
+// takes a token from it when one is available. It returns the tokens left.
+func (limit RateLimit) take(tokens float64, updatedAt time.Time, now time.Time) (float64, RateLimitResult) {
+	rate := limit.rate()
+	tokens = math.Min(float64(limit.Requests), tokens+now.Sub(updatedAt).Seconds()*rate)
+
+	result := RateLimitResult{Allowed: tokens >= 1, Limit: limit.Requests}
+	if result.Allowed {
+		tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = time.Duration((float64(limit.Requests) - tokens) / rate * float64(time.Second))
+	return tokens, result
+}
+
+// RateLimitResult describes the state of a bucket after a request was counted
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Time until the bucket is full again
+	RetryAfter time.Duration // Time until the next request is allowed, when rejected
+}
+
+// RateLimitStore keeps the token buckets of the rate limits
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+type memoryRateLimitBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	period    time.Duration
+}
+
+// MemoryRateLimitStore keeps the buckets in memory. Each instance of the api
+// counts requests on its own.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryRateLimitBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryRateLimitBucket{}, lastSweep: time.Now()}
+}
+
+func (store *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if now.Sub(store.lastSweep) >= rateLimitSweepInterval {
+		for bucketKey, bucket := range store.buckets {
+			if now.Sub(bucket.updatedAt) >= bucket.period {
+				delete(store.buckets, bucketKey)
+			}
+		}
+		store.lastSweep = now
+	}
+
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &memoryRateLimitBucket{tokens: float64(limit.Requests), updatedAt: now}
+		store.buckets[key] = bucket
+	}
+
+	var result RateLimitResult
+	bucket.tokens, result = limit.take(bucket.tokens, bucket.updatedAt, now)
+	bucket.updatedAt = now
+	bucket.period = limit.Period
+	return result, nil
+}
+
+// DatabaseRateLimitStore keeps the buckets in the database so that every
+// instance of the api shares the same counters
+type DatabaseRateLimitStore struct {
+	defaultDb *gorm.DB
+	logger    *zap.Logger
+	lastSweep atomic.Int64
+}
+
+func NewDatabaseRateLimitStore(defaultDb *gorm.DB, logger *zap.Logger) *DatabaseRateLimitStore {
+	store := &DatabaseRateLimitStore{defaultDb: defaultDb, logger: logger}
+	store.lastSweep.Store(time.Now().UnixNano())
+	return store
+}
+
+func (store *DatabaseRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+	store.sweep(now)
+
+	var result RateLimitResult
+	err := store.defaultDb.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		bucket := &models.RateLimitBucket{Key: key, Tokens: float64(limit.Requests), UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(bucket).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&models.RateLimitBucket{Key: key}).First(bucket).Error; err != nil {
+			return err
+		}
+
+		var tokens float64
+		tokens, result = limit.take(bucket.Tokens, bucket.UpdatedAt, now)
+		return tx.Model(bucket).Updates(map[string]any{"tokens": tokens, "updated_at": now}).Error
+	})
+
+	return result, err
+}
+
+// sweep deletes idle buckets at most once per sweep interval
+func (store *DatabaseRateLimitStore) sweep(now time.Time) {
+	lastSweep := store.lastSweep.Load()
+	if now.Sub(time.Unix(0, lastSweep)) < rateLimitSweepInterval || !store.lastSweep.CompareAndSwap(lastSweep, now.UnixNano()) {
+		return
+	}
+
+	if err := store.defaultDb.Where("updated_at < ?", now.Add(-rateLimitRetention)).Delete(&models.RateLimitBucket{}).Error; err != nil {
+		store.logger.Warn("Failed to delete idle rate limit buckets", zap.Error(err))
+	}
+}
+
+// RateLimitKey returns the key identifying who a request is counted against
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimitByIp counts requests against the client address
+func RateLimitByIp(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByUser counts requests against the authenticated user, or against
+// the client address when the request is anonymous
+func RateLimitByUser(c *gin.Context) string {
+	if userId := GetRequestInfo(c.Request.Context()).UserId; userId != "" {
+		return "user:" + userId
+	}
+	return RateLimitByIp(c)
+}
+
+// RateLimiter rejects requests that exceed the configured policies
+type RateLimiter struct {
+	store      RateLimitStore
+	policies   map[string]RateLimit
+	exemptions sync.Map // Conditions under which a route skips a policy, keyed by policy and route
+	metrics    *metrics.Metrics
+	logger     *zap.Logger
+}
+
+func NewRateLimiter(store RateLimitStore, policies map[string]RateLimit, metrics *metrics.Metrics, logger *zap.Logger) *RateLimiter {
+	return &RateLimiter{store: store, policies: policies, metrics: metrics, logger: logger}
+}
+
+// Exempt lets requests to a route skip a policy applied to every route when
+// the condition holds. It suits webhooks authenticated by a shared secret,
+// whose callers relay the requests of many people from a few addresses.
+// Requests failing the condition are still counted.
+func (limiter *RateLimiter) Exempt(policy string, route string, condition func(c *gin.Context) bool) {
+	limiter.exemptions.Store(policy+" "+route, condition)
+}
+
+// Limit applies the named policy to the request, counting it against the
+// given key. Requests over the limit are rejected with 429 Too Many Requests.
+// Unknown or disabled policies let every request through.
+func (limiter *RateLimiter) Limit(policy string, key RateLimitKey) gin.HandlerFunc {
+	limit := limiter.policies[policy]
+	if !limit.Enabled() {
+		return func(c *gin.Context) {}
+	}
+
+	return func(c *gin.Context) {
+		if condition, ok := limiter.exemptions.Load(policy + " " + c.FullPath()); ok && condition.(func(c *gin.Context) bool)(c) {
+			return
+		}
+
+		result, err := limiter.store.Take(c.Request.Context(), policy+":"+key(c), limit)
+		if err != nil {
+			// Fail open so that an unavailable store does not take the api down
+			logging.FromContext(c.Request.Context(), limiter.logger).Error("Failed to apply rate limit", zap.String("policy", policy), zap.Error(err))
+			return
+		}
+
+		setRateLimitHeaders(c, limit, result)
+
+		if !result.Allowed {
+			limiter.metrics.RateLimited.WithLabelValues(policy).Inc()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			problem := problems.NewProblem(http.StatusTooManyRequests, "Too many requests. Please try again later.")
+			problems.Abort(c, problem)
+		}
+	}
+}
+
+// setRateLimitHeaders describes the limit closest to being exhausted using the
+// RateLimit header fields
+func setRateLimitHeaders(c *gin.Context, limit RateLimit, result RateLimitResult) {
+	if remaining, ok := c.Get(rateLimitRemainingKey); ok && remaining.(int) < result.Remaining && result.Allowed {
+		return
+	}
+	c.Set(rateLimitRemainingKey, result.Remaining)
+
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Period.Seconds())))
+}
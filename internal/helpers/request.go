@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prince272/konabra/internal/logging"
+	"go.uber.org/zap"
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo describes who made a request and from where
+type RequestInfo struct {
+	UserId    string
+	IpAddress string
+	UserAgent string
+}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// GetRequestInfo returns the request info stored in the context, if any
+func GetRequestInfo(ctx context.Context) RequestInfo {
+	if ctx == nil {
+		return RequestInfo{}
+	}
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// CaptureRequestInfo stores the client address and user agent in the request context
+func CaptureRequestInfo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(WithRequestInfo(c.Request.Context(), RequestInfo{
+			IpAddress: c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}))
+	}
+}
+
+// SetRequestUserId records the authenticated user in the request context and
+// adds it to the request logger
+func SetRequestUserId(c *gin.Context, userId string) {
+	ctx := c.Request.Context()
+	info := GetRequestInfo(ctx)
+	info.UserId = userId
+	c.Request = c.Request.WithContext(WithRequestInfo(ctx, info))
+	logging.AddFields(c, zap.String("userId", userId))
+}
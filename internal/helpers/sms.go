@@ -0,0 +1,87 @@
+package helpers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prince272/konabra/internal/logging"
+	"go.uber.org/zap"
+)
+
+var (
+	SmsSenderLog  = "log"  // Messages are written to the log instead of being sent
+	SmsSenderHttp = "http" // Messages are posted to an SMS gateway
+)
+
+// smsSendTimeout limits how long a gateway can take to accept a message
+const smsSendTimeout = 15 * time.Second
+
+// SmsSender sends text messages to phone numbers
+type SmsSender interface {
+	Send(ctx context.Context, to string, message string) error
+}
+
+// LogSmsSender writes messages to the log, for development and for
+// deployments without a gateway
+type LogSmsSender struct {
+	logger *zap.Logger
+}
+
+func NewLogSmsSender(logger *zap.Logger) *LogSmsSender {
+	return &LogSmsSender{logger}
+}
+
+func (sender *LogSmsSender) Send(ctx context.Context, to string, message string) error {
+	logging.FromContext(ctx, sender.logger).Info("SMS not sent, no gateway is configured", zap.String("to", to), zap.String("message", message))
+	return nil
+}
+
+// HttpSmsSenderOptions describes the SMS gateway messages are posted to
+type HttpSmsSenderOptions struct {
+	Url      string
+	Token    string // Sent as a bearer token when set
+	SenderId string // Name or number the messages appear to come from
+}
+
+// HttpSmsSender posts every message to a gateway as a JSON object with the
+// members to, from and message. Gateways with another format can be reached
+// through a small adapter.
+type HttpSmsSender struct {
+	client  *http.Client
+	options HttpSmsSenderOptions
+}
+
+func NewHttpSmsSender(options HttpSmsSenderOptions) *HttpSmsSender {
+	return &HttpSmsSender{&http.Client{Timeout: smsSendTimeout}, options}
+}
+
+func (sender *HttpSmsSender) Send(ctx context.Context, to string, message string) error {
+	body, err := json.Marshal(map[string]string{"to": to, "from": sender.options.SenderId, "message": message})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sender.options.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if sender.options.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+sender.options.Token)
+	}
+
+	response, err := sender.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to send SMS: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("failed to send SMS: the gateway answered %v", response.Status)
+	}
+	return nil
+}
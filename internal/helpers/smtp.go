@@ -1,13 +1,18 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"strconv"
 
 	"github.com/wneessen/go-mail"
 )
 
 type Smtp struct {
-	client *mail.Client
+	client  *mail.Client
+	address string
+	from    string
 }
 
 type SmtpOptions struct {
@@ -15,10 +20,17 @@ type SmtpOptions struct {
 	Port     int
 	Username string
 	Password string
+	From     string // Address messages are sent from, the username when empty
 }
 
 func NewSmtp(options SmtpOptions) (*Smtp, error) {
+	port := options.Port
+	if port <= 0 {
+		port = mail.DefaultPort
+	}
+
 	client, err := mail.NewClient(options.Host,
+		mail.WithPort(port),
 		mail.WithSMTPAuth(mail.SMTPAuthPlain),
 		mail.WithUsername(options.Username),
 		mail.WithPassword(options.Password))
@@ -27,11 +39,42 @@ func NewSmtp(options SmtpOptions) (*Smtp, error) {
 		return nil, fmt.Errorf("failed to create SMTP client: %w", err)
 	}
 
+	from := options.From
+	if from == "" {
+		from = options.Username
+	}
+
 	return &Smtp{
-		client: client,
+		client:  client,
+		address: net.JoinHostPort(options.Host, strconv.Itoa(port)),
+		from:    from,
 	}, nil
 }
 
-func (m *Smtp) Send(to string, subject string, body string) error {
+// Ping checks that the SMTP server accepts TCP connections
+func (m *Smtp) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Send emails a plain text message
+func (m *Smtp) Send(ctx context.Context, to string, subject string, body string) error {
+	message := mail.NewMsg()
+	if err := message.From(m.from); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	if err := message.To(to); err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+	message.Subject(subject)
+	message.SetBodyString(mail.TypeTextPlain, body)
+
+	if err := m.client.DialAndSendWithContext(ctx, message); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
 	return nil
 }
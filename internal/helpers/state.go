@@ -11,18 +11,31 @@ type Item struct {
 }
 
 type State struct {
-	items map[string]Item
-	mu    sync.RWMutex
+	items    map[string]Item
+	mu       sync.RWMutex
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
 func NewState() *State {
 	s := &State{
-		items: make(map[string]Item),
+		items:   make(map[string]Item),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
 	}
 	go s.cleanupExpired()
 	return s
 }
 
+// Close stops the background cleanup of expired items
+func (s *State) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.stopped
+}
+
 func (s *State) SetItem(key string, value any, expiration time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -65,6 +78,30 @@ func (s *State) PopItem(key string) any {
 	return item.value
 }
 
+// AddItem stores the value only if the key is absent or expired and reports
+// whether the value was stored.
+func (s *State) AddItem(key string, value any, expiration time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, found := s.items[key]
+	if found && (item.expiration == 0 || time.Now().UnixNano() <= item.expiration) {
+		return false
+	}
+
+	var exp int64
+	if expiration > 0 {
+		exp = time.Now().Add(expiration).UnixNano()
+	}
+
+	s.items[key] = Item{
+		value:      value,
+		expiration: exp,
+	}
+
+	return true
+}
+
 func (s *State) HasKey(key string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -94,8 +131,17 @@ func (s *State) Clear() {
 }
 
 func (s *State) cleanupExpired() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
 	for {
-		time.Sleep(1 * time.Minute)
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
 
 		s.mu.Lock()
 		now := time.Now().UnixNano()
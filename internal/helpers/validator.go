@@ -3,27 +3,32 @@ package helpers
 import (
 	"fmt"
 	"regexp"
-	"unicode/utf8"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/nyaruka/phonenumbers"
+	"github.com/prince272/konabra/internal/problems"
 )
 
 type Validator struct {
-	validate *validator.Validate
+	validate       *validator.Validate
+	passwordPolicy PasswordPolicy
 }
 
-func NewValidator() (*Validator, error) {
+func NewValidator(passwordPolicy PasswordPolicy) (*Validator, error) {
 	validate := validator.New()
+	validate.RegisterTagNameFunc(problems.FieldName)
 	if err := validate.RegisterValidation("username", ValidateUsername); err != nil {
 		return nil, fmt.Errorf("failed to register username validator: %w", err)
 	}
 
-	if err := validate.RegisterValidation("password", ValidatePassword); err != nil {
+	if err := validate.RegisterValidation("password", passwordPolicy.validate); err != nil {
 		return nil, fmt.Errorf("failed to register password validator: %w", err)
 	}
+	problems.RegisterFieldMessage("password", passwordPolicy.message)
+
 	return &Validator{
-		validate: validate,
+		validate:       validate,
+		passwordPolicy: passwordPolicy,
 	}, nil
 }
 
@@ -31,24 +36,9 @@ func (helper *Validator) ValidateStruct(s any) error {
 	return helper.validate.Struct(s)
 }
 
-// ValidatePassword checks password strength
-func ValidatePassword(fl validator.FieldLevel) bool {
-	password := fl.Field().String()
-	length := utf8.RuneCountInString(password)
-
-	if length < 6 || length > 256 {
-		return false
-	}
-
-	upper := regexp.MustCompile(`[A-Z]`)
-	lower := regexp.MustCompile(`[a-z]`)
-	digit := regexp.MustCompile(`[0-9]`)
-	special := regexp.MustCompile(`[^a-zA-Z0-9]`)
-
-	return upper.MatchString(password) &&
-		lower.MatchString(password) &&
-		digit.MatchString(password) &&
-		special.MatchString(password)
+// PasswordPolicy returns the policy enforced by the "password" validation tag
+func (helper *Validator) PasswordPolicy() PasswordPolicy {
+	return helper.passwordPolicy
 }
 
 // ValidateUsername determines whether input is a valid phone or email
@@ -66,6 +56,20 @@ func IsPhoneNumber(input string) bool {
 	return phonenumbers.IsValidNumber(num)
 }
 
+// NormalizePhoneNumber returns a phone number in E.164 form. Numbers without a
+// country code are read as numbers of the default region, such as "GH", and
+// numbers sent without their leading plus sign are accepted too.
+func NormalizePhoneNumber(input string, defaultRegion string) (string, bool) {
+	num, err := phonenumbers.Parse(input, defaultRegion)
+	if err != nil || !phonenumbers.IsValidNumber(num) {
+		num, err = phonenumbers.Parse("+"+input, "")
+		if err != nil || !phonenumbers.IsValidNumber(num) {
+			return "", false
+		}
+	}
+	return phonenumbers.Format(num, phonenumbers.E164), true
+}
+
 // Helper: Check if input is email
 func IsEmail(input string) bool {
 	emailPattern := regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/services"
+	"go.uber.org/zap"
+)
+
+// erasureInterval is how often accounts scheduled for erasure are checked
+const erasureInterval = time.Hour
+
+// ErasureJob periodically erases accounts whose erasure grace period has ended
+type ErasureJob struct {
+	privacyService *services.PrivacyService
+	logger         *zap.Logger
+	stop           chan struct{}
+	stopped        chan struct{}
+}
+
+// NewErasureJob creates the job, starts it in the background and stops it on shutdown
+func NewErasureJob(privacyService *services.PrivacyService, lifecycle *helpers.Lifecycle, logger *zap.Logger) *ErasureJob {
+	job := &ErasureJob{privacyService, logger, make(chan struct{}), make(chan struct{})}
+	go job.run()
+
+	lifecycle.OnShutdown("erasure job", job.Stop)
+	return job
+}
+
+// Stop waits for the current run to finish and stops the job
+func (job *ErasureJob) Stop(ctx context.Context) error {
+	close(job.stop)
+
+	select {
+	case <-job.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (job *ErasureJob) run() {
+	defer close(job.stopped)
+
+	ticker := time.NewTicker(erasureInterval)
+	defer ticker.Stop()
+
+	for {
+		job.eraseScheduledAccounts()
+
+		select {
+		case <-job.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (job *ErasureJob) eraseScheduledAccounts() {
+	defer func() {
+		if r := recover(); r != nil {
+			job.logger.Error("Account erasure panicked: ", zap.Any("panic", r))
+		}
+	}()
+
+	erased, problem := job.privacyService.EraseScheduledAccounts(context.Background())
+	if problem != nil {
+		job.logger.Error("Error erasing scheduled accounts: ", zap.String("message", problem.Detail))
+	}
+
+	if erased > 0 {
+		job.logger.Info("Erased scheduled accounts", zap.Int("count", erased))
+	}
+}
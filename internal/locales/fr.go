@@ -0,0 +1,149 @@
+package locales
+
+var french = map[string]string{
+	// Problem titles
+	"Validation failed":      "La validation a échoué",
+	"Bad request":            "Requête invalide",
+	"Unauthorized":           "Non authentifié",
+	"Forbidden":              "Accès refusé",
+	"Not found":              "Introuvable",
+	"Conflict":               "Conflit",
+	"Idempotency key reused": "Clé d'idempotence réutilisée",
+	"Precondition failed":    "Précondition non remplie",
+	"Too many requests":      "Trop de requêtes",
+	"Client closed request":  "Requête annulée par le client",
+	"Internal server error":  "Erreur interne du serveur",
+	"Service unavailable":    "Service indisponible",
+	"Gateway timeout":        "Délai d'attente dépassé",
+
+	// General problems
+	"One or more validation errors occurred.":                                             "Une ou plusieurs erreurs de validation se sont produites.",
+	"An internal server error has occurred.":                                              "Une erreur interne du serveur s'est produite.",
+	"The request body is not valid JSON.":                                                 "Le corps de la requête n'est pas un JSON valide.",
+	"The If-Match header is not valid.":                                                   "L'en-tête If-Match n'est pas valide.",
+	"The resource was changed by someone else. Review the current version and try again.": "La ressource a été modifiée par quelqu'un d'autre. Consultez la version actuelle et réessayez.",
+	"A value in the request body has the wrong type.":                                     "Une valeur du corps de la requête n'a pas le bon type.",
+	"The request body must be a JSON merge patch.":                                        "Le corps de la requête doit être un JSON merge patch.",
+	"The merge patch must be a JSON object.":                                              "Le merge patch doit être un objet JSON.",
+	"The idempotency key was already used for a different request.":                       "La clé d'idempotence a déjà été utilisée pour une autre requête.",
+	"A request with this idempotency key is still being processed.":                       "Une requête avec cette clé d'idempotence est toujours en cours de traitement.",
+	"The Idempotency-Key header is not valid.":                                            "L'en-tête Idempotency-Key n'est pas valide.",
+	"The page cursor is not valid.":                                                       "Le curseur de page n'est pas valide.",
+	"The datetime format is not valid.":                                                   "Le format de la date et de l'heure n'est pas valide.",
+	"The request took too long to complete. Please try again later.":                      "La requête a pris trop de temps. Veuillez réessayer plus tard.",
+	"The request was cancelled by the client.":                                            "La requête a été annulée par le client.",
+	"The requested resource was not found.":                                               "La ressource demandée est introuvable.",
+	"The requested resource was not found on this server.":                                "La ressource demandée est introuvable sur ce serveur.",
+	"The resource conflicts with an existing one.":                                        "La ressource est en conflit avec une ressource existante.",
+	"The service is temporarily unavailable. Please try again.":                           "Le service est temporairement indisponible. Veuillez réessayer.",
+	"Too many requests. Please try again later.":                                          "Trop de requêtes. Veuillez réessayer plus tard.",
+	"You are not authorized to perform this action.":                                      "Vous n'êtes pas autorisé à effectuer cette action.",
+	"You don't have the necessary permissions.":                                           "Vous n'avez pas les autorisations nécessaires.",
+
+	// Field validation
+	"%v is required.":                             "%v est obligatoire.",
+	"%v must be a valid email address.":           "%v doit être une adresse e-mail valide.",
+	"%v must be a valid phone number.":            "%v doit être un numéro de téléphone valide.",
+	"%v must be greater than or equal to %v.":     "%v doit être supérieur ou égal à %v.",
+	"%v must be less than or equal to %v.":        "%v doit être inférieur ou égal à %v.",
+	"%v does not meet the password requirements.": "%v ne respecte pas les exigences du mot de passe.",
+	"%v is not valid.":                            "%v n'est pas valide.",
+	"%v must be at least %d characters long.":     "%v doit contenir au moins %d caractères.",
+	"%v must be at most %d characters long.":      "%v doit contenir au plus %d caractères.",
+	"%v must include at least %d of the following: uppercase letter, lowercase letter, number and special character.": "%v doit contenir au moins %d des éléments suivants : lettre majuscule, lettre minuscule, chiffre et caractère spécial.",
+	"%v must not repeat the same character more than %d times in a row.":                                              "%v ne doit pas répéter le même caractère plus de %d fois de suite.",
+	"%v is too common or has appeared in a data breach.":                                                              "%v est trop courant ou est apparu dans une fuite de données.",
+
+	// Accounts
+	"%v already exists.":                                               "%v existe déjà.",
+	"%v does not exist.":                                               "%v n'existe pas.",
+	"%v is already verified.":                                          "%v est déjà vérifié.",
+	"%v is already associated with your account.":                      "%v est déjà associé à votre compte.",
+	"Password must not match any of your last %d passwords.":           "Le mot de passe ne doit correspondre à aucun de vos %d derniers mots de passe.",
+	"Username is not a valid email or phone number.":                   "Le nom d'utilisateur n'est pas une adresse e-mail ou un numéro de téléphone valide.",
+	"Password is incorrect.":                                           "Le mot de passe est incorrect.",
+	"Old password is incorrect.":                                       "L'ancien mot de passe est incorrect.",
+	"Refresh token is invalid.":                                        "Le jeton d'actualisation n'est pas valide.",
+	"User not found.":                                                  "Utilisateur introuvable.",
+	"User account is not active.":                                      "Le compte utilisateur n'est pas actif.",
+	"Verification code is invalid or has expired.":                     "Le code de vérification n'est pas valide ou a expiré.",
+	"A code was sent recently. Please wait before requesting another.": "Un code a été envoyé récemment. Veuillez patienter avant d'en demander un autre.",
+	"Too many failed attempts. Please try again later.":                "Trop de tentatives échouées. Veuillez réessayer plus tard.",
+	"Sign-in link is invalid or has expired.":                          "Le lien de connexion n'est pas valide ou a expiré.",
+	"Sign-in link has already been used.":                              "Le lien de connexion a déjà été utilisé.",
+	"Role not found.":                                                  "Rôle introuvable.",
+	"Role name already exists.":                                        "Ce nom de rôle existe déjà.",
+	"Role name already exists for another role.":                       "Ce nom de rôle existe déjà pour un autre rôle.",
+	"Role '%v' does not exist.":                                        "Le rôle '%v' n'existe pas.",
+	"Service account not found.":                                       "Compte de service introuvable.",
+	"Api key not found.":                                               "Clé d'API introuvable.",
+	"Scope '%v' is not valid.":                                         "La portée '%v' n'est pas valide.",
+	"Expiry date must be in the future.":                               "La date d'expiration doit être dans le futur.",
+
+	// Categories
+	"Category not found.":                                                           "Catégorie introuvable.",
+	"Category is archived.":                                                         "La catégorie est archivée.",
+	"Category name already exists.":                                                 "Ce nom de catégorie existe déjà.",
+	"Category name already exists for another category.":                            "Ce nom de catégorie existe déjà pour une autre catégorie.",
+	"Category cannot be its own parent.":                                            "Une catégorie ne peut pas être son propre parent.",
+	"Category has subcategories. Move or delete them first.":                        "La catégorie contient des sous-catégories. Déplacez-les ou supprimez-les d'abord.",
+	"Category with subcategories cannot be moved under another category.":           "Une catégorie contenant des sous-catégories ne peut pas être déplacée sous une autre catégorie.",
+	"Category has %d incidents. Move them to another category or force the delete.": "La catégorie contient %d incidents. Déplacez-les vers une autre catégorie ou forcez la suppression.",
+	"Category %v is listed more than once.":                                         "La catégorie %v est listée plus d'une fois.",
+	"Category does not accept extra fields.":                                        "La catégorie n'accepte pas de champs supplémentaires.",
+	"Incidents cannot be moved to the category being deleted.":                      "Les incidents ne peuvent pas être déplacés vers la catégorie en cours de suppression.",
+	"One or more categories were not found.":                                        "Une ou plusieurs catégories sont introuvables.",
+	"Parent category not found.":                                                    "Catégorie parente introuvable.",
+	"Parent category is archived.":                                                  "La catégorie parente est archivée.",
+	"Parent category is archived. Unarchive it first.":                              "La catégorie parente est archivée. Désarchivez-la d'abord.",
+	"Parent category must be a top-level category.":                                 "La catégorie parente doit être une catégorie de premier niveau.",
+
+	// Incidents
+	"Incident not found.":                                "Incident introuvable.",
+	"The client id is already used by another incident.": "L'identifiant client est déjà utilisé par un autre incident.",
+
+	// USSD
+	"Phone number is not valid.":                          "Le numéro de téléphone n'est pas valide.",
+	"The USSD secret is not valid.":                       "Le secret USSD n'est pas valide.",
+	"The service is unavailable. Please try again later.": "Le service est indisponible. Veuillez réessayer plus tard.",
+	"No categories are available for reporting.":          "Aucune catégorie n'est disponible pour un signalement.",
+	"Choose a category:":                                  "Choisissez une catégorie :",
+	"%v. More":                                            "%v. Plus",
+	"%v. Back":                                            "%v. Retour",
+	"Invalid choice.":                                     "Choix invalide.",
+	"Choose the severity:":                                "Choisissez la gravité :",
+	"Low":                                                 "Faible",
+	"Medium":                                              "Moyenne",
+	"High":                                                "Élevée",
+	"Where did it happen? Type a short location:":            "Où cela s'est-il passé ? Saisissez un lieu court :",
+	"Type a short location, such as a town or landmark:":     "Saisissez un lieu court, comme une ville ou un repère :",
+	"Your report could not be sent. Please try again later.": "Votre signalement n'a pas pu être envoyé. Veuillez réessayer plus tard.",
+	"Thank you. Your report %v has been received.":           "Merci. Votre signalement %v a été reçu.",
+	// SMS
+	"The SMS secret is not valid.":                                   "Le secret SMS n'est pas valide.",
+	"%v is reserved for SMS commands.":                               "%v est réservé aux commandes SMS.",
+	"Keyword %v is already used by category %v.":                     "Le mot-clé %v est déjà utilisé par la catégorie %v.",
+	"Unknown keyword %v.":                                            "Mot-clé %v inconnu.",
+	"Add where it happened, e.g. %v Kasoa toll booth.":               "Ajoutez où cela s'est passé, par ex. %v péage de Kasoa.",
+	"Send STATUS and the code of your report, e.g. STATUS INC12345.": "Envoyez STATUS et le code de votre signalement, par ex. STATUS INC12345.",
+	"No report %v was found for your number.":                        "Aucun signalement %v n'a été trouvé pour votre numéro.",
+	"Report %v: %v.":                                                 "Signalement %v : %v.",
+	"Pending":                                                        "En attente",
+	"Being investigated":                                             "En cours d'examen",
+	"Resolved":                                                       "Résolu",
+	"Closed as a false alarm":                                        "Clos comme fausse alerte",
+	"Keywords: %v.":                                                  "Mots-clés : %v.",
+	"Send a keyword and where it happened, e.g. %v Kasoa toll booth. Add HIGH or LOW for the severity.": "Envoyez un mot-clé et le lieu, par ex. %v péage de Kasoa. Ajoutez HIGH ou LOW pour la gravité.",
+	"Thank you. Your report %v has been received. Send STATUS %v to follow it up.":                      "Merci. Votre signalement %v a été reçu. Envoyez STATUS %v pour le suivre.",
+	// Codes
+	"Your sign-in code is %v.": "Votre code de connexion est %v.",
+	"Your sign-in code is %v. You can also sign in with this link: %v": "Votre code de connexion est %v. Vous pouvez aussi vous connecter avec ce lien : %v",
+	"Your verification code is %v.":                                    "Votre code de vérification est %v.",
+	"Your password reset code is %v.":                                  "Votre code de réinitialisation du mot de passe est %v.",
+	"Sign in":                                                          "Connexion",
+	"Verify your account":                                              "Vérifiez votre compte",
+	"Confirm your new account":                                         "Confirmez votre nouveau compte",
+	"Reset your password":                                              "Réinitialisez votre mot de passe",
+	"The code could not be sent. Please try again later.":              "Le code n'a pas pu être envoyé. Veuillez réessayer plus tard.",
+	"%v of %v accounts due for erasure could not be erased.":           "%v des %v comptes à effacer n'ont pas pu être effacés.",
+}
@@ -0,0 +1,109 @@
+// Package locales negotiates the language of a request from its Accept-Language
+// header and translates the messages the api sends back to its users.
+package locales
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	English = "en"
+	French  = "fr"
+	Twi     = "tw"
+)
+
+// Supported lists the locales messages are translated into. The first one is
+// used when the client accepts none of them.
+var Supported = []string{English, French, Twi}
+
+// aliases maps language tags that share a translation with a supported locale
+var aliases = map[string]string{
+	"ak":  Twi, // Akan, of which Twi is the most widely spoken form
+	"twi": Twi,
+}
+
+// translations holds the messages of every locale except English, keyed by the
+// English message or format string they translate
+var translations = map[string]map[string]string{
+	French: french,
+	Twi:    twi,
+}
+
+type localeKey struct{}
+
+// WithLocale returns a copy of the context carrying the locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// FromContext returns the locale carried by the context, or English when there is none
+func FromContext(ctx context.Context) string {
+	if ctx != nil {
+		if locale, ok := ctx.Value(localeKey{}).(string); ok {
+			return locale
+		}
+	}
+	return English
+}
+
+// Negotiate returns the supported locale that best matches an Accept-Language
+// header, such as "fr-CI, tw;q=0.8, en;q=0.5". Region subtags are ignored.
+func Negotiate(acceptLanguage string) string {
+	best, bestQuality := Supported[0], 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if alias, ok := aliases[primary]; ok {
+			primary = alias
+		}
+
+		if quality > bestQuality && slices.Contains(Supported, primary) {
+			best, bestQuality = primary, quality
+		}
+	}
+	return best
+}
+
+// Middleware stores the locale negotiated from the Accept-Language header in
+// the request context
+func Middleware() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		locale := Negotiate(context.GetHeader("Accept-Language"))
+		context.Request = context.Request.WithContext(WithLocale(context.Request.Context(), locale))
+		context.Header("Content-Language", locale)
+		context.Writer.Header().Add("Vary", "Accept-Language")
+	}
+}
+
+// Translate returns the message in the given locale, or the message itself
+// when no translation exists
+func Translate(locale string, message string) string {
+	if translated, ok := translations[locale][message]; ok {
+		return translated
+	}
+	return message
+}
+
+// Sprintf formats a message after translating its format string
+func Sprintf(locale string, format string, args ...any) string {
+	return fmt.Sprintf(Translate(locale, format), args...)
+}
@@ -0,0 +1,149 @@
+package locales
+
+var twi = map[string]string{
+	// Problem titles
+	"Validation failed":      "Nsɛm a wode mae no nfata",
+	"Bad request":            "Abisadeɛ no nfata",
+	"Unauthorized":           "Wonnya ho kwan",
+	"Forbidden":              "Wɔmma wo kwan",
+	"Not found":              "Yɛanhu",
+	"Conflict":               "Ntawntawdie",
+	"Idempotency key reused": "Wɔasan de idempotency key no adi dwuma",
+	"Precondition failed":    "Ahwehwɛdeɛ a edi kan no nni mu",
+	"Too many requests":      "Abisadeɛ no abu so",
+	"Client closed request":  "Wɔtwaa abisadeɛ no mu",
+	"Internal server error":  "Ɔhaw bi wɔ server no mu",
+	"Service unavailable":    "Dwumadie no nni hɔ seesei",
+	"Gateway timeout":        "Bere no asa",
+
+	// General problems
+	"One or more validation errors occurred.":                                             "Mfomsoɔ bi wɔ nsɛm a wode mae no mu.",
+	"An internal server error has occurred.":                                              "Ɔhaw bi asi wɔ server no mu.",
+	"The request body is not valid JSON.":                                                 "Abisadeɛ no mu nsɛm no nyɛ JSON a ɛfata.",
+	"The If-Match header is not valid.":                                                   "If-Match header no nfata.",
+	"The resource was changed by someone else. Review the current version and try again.": "Obi foforɔ asesa adeɛ yi. Hwɛ deɛ ɛwɔ hɔ seesei na san bɔ mmɔden.",
+	"A value in the request body has the wrong type.":                                     "Nsɛm bi a ɛwɔ abisadeɛ no mu nyɛ ɔkwan a ɛfata.",
+	"The request body must be a JSON merge patch.":                                        "Ɛsɛ sɛ abisadeɛ no mu nsɛm yɛ JSON merge patch.",
+	"The merge patch must be a JSON object.":                                              "Ɛsɛ sɛ merge patch no yɛ JSON object.",
+	"The idempotency key was already used for a different request.":                       "Wɔde idempotency key yi adi dwuma dada wɔ abisadeɛ foforɔ ho.",
+	"A request with this idempotency key is still being processed.":                       "Abisadeɛ a ɛwɔ idempotency key yi da so reyɛ adwuma.",
+	"The Idempotency-Key header is not valid.":                                            "Idempotency-Key header no nfata.",
+	"The page cursor is not valid.":                                                       "Krataafa nkyerɛnneɛ no nfata.",
+	"The datetime format is not valid.":                                                   "Da ne bere a wode mae no nhyehyɛeɛ nfata.",
+	"The request took too long to complete. Please try again later.":                      "Abisadeɛ no dii bere tenten dodo. Yɛsrɛ wo, san bɔ mmɔden akyiri yi.",
+	"The request was cancelled by the client.":                                            "Wɔtwaa abisadeɛ no mu ansa na ɛrewie.",
+	"The requested resource was not found.":                                               "Yɛanhu adeɛ a wohwehwɛ no.",
+	"The requested resource was not found on this server.":                                "Yɛanhu adeɛ a wohwehwɛ no wɔ server yi so.",
+	"The resource conflicts with an existing one.":                                        "Adeɛ yi ne deɛ ɛwɔ hɔ dada no di ntawntaw.",
+	"The service is temporarily unavailable. Please try again.":                           "Dwumadie no nni hɔ seesei. Yɛsrɛ wo, san bɔ mmɔden.",
+	"Too many requests. Please try again later.":                                          "Abisadeɛ no abu so. Yɛsrɛ wo, san bɔ mmɔden akyiri yi.",
+	"You are not authorized to perform this action.":                                      "Wonnya kwan sɛ wobɛyɛ yei.",
+	"You don't have the necessary permissions.":                                           "Wonni tumi a ɛho hia no.",
+
+	// Field validation
+	"%v is required.":                             "Ɛsɛ sɛ wode %v ka ho.",
+	"%v must be a valid email address.":           "Ɛsɛ sɛ %v yɛ email address a ɛfata.",
+	"%v must be a valid phone number.":            "Ɛsɛ sɛ %v yɛ fon nɔma a ɛfata.",
+	"%v must be greater than or equal to %v.":     "Ɛsɛ sɛ %v boro %v anaa ɛne no yɛ pɛ.",
+	"%v must be less than or equal to %v.":        "Ɛsɛ sɛ %v sua sene %v anaa ɛne no yɛ pɛ.",
+	"%v does not meet the password requirements.": "%v nni password ahwehwɛdeɛ no so.",
+	"%v is not valid.":                            "%v nfata.",
+	"%v must be at least %d characters long.":     "Ɛsɛ sɛ %v nkyerɛwdeɛ dodoɔ yɛ %d anaa ɛboro saa.",
+	"%v must be at most %d characters long.":      "Ɛnsɛ sɛ %v nkyerɛwdeɛ dodoɔ boro %d.",
+	"%v must include at least %d of the following: uppercase letter, lowercase letter, number and special character.": "Ɛsɛ sɛ %v kura yeinom mu %d: nkyerɛwdeɛ kɛseɛ, nkyerɛwdeɛ ketewa, nɔma ne agyiraeɛ soronko.",
+	"%v must not repeat the same character more than %d times in a row.":                                              "Ɛnsɛ sɛ %v san kyerɛw nkyerɛwdeɛ korɔ no mpɛn boro %d toatoa so.",
+	"%v is too common or has appeared in a data breach.":                                                              "%v yɛ deɛ nnipa pii de di dwuma, anaa ada adi wɔ data a awia mu.",
+
+	// Accounts
+	"%v already exists.":                                               "%v wɔ hɔ dada.",
+	"%v does not exist.":                                               "%v nni hɔ.",
+	"%v is already verified.":                                          "Wɔahwɛ %v mu dada.",
+	"%v is already associated with your account.":                      "%v ka wo akawnt no ho dada.",
+	"Password must not match any of your last %d passwords.":           "Ɛnsɛ sɛ password no ne wo password %d a edi akyire no mu biara yɛ pɛ.",
+	"Username is not a valid email or phone number.":                   "Username no nyɛ email anaa fon nɔma a ɛfata.",
+	"Password is incorrect.":                                           "Password no nteɛ.",
+	"Old password is incorrect.":                                       "Password dada no nteɛ.",
+	"Refresh token is invalid.":                                        "Refresh token no nfata.",
+	"User not found.":                                                  "Yɛanhu ɔdwumayɛni no.",
+	"User account is not active.":                                      "Akawnt no nyɛ adwuma seesei.",
+	"Verification code is invalid or has expired.":                     "Nɔma a wode bɛhwɛ mu no nfata anaa ne bere atwam.",
+	"A code was sent recently. Please wait before requesting another.": "Yɛde nɔma bi kɔmaa wo nnansa yi. Yɛsrɛ wo, twɛn kakra ansa na woabisa foforɔ.",
+	"Too many failed attempts. Please try again later.":                "Mmɔden a entumi anyɛ yie no abu so. Yɛsrɛ wo, san bɔ mmɔden akyiri yi.",
+	"Sign-in link is invalid or has expired.":                          "Link a wode bɛkɔ mu no nfata anaa ne bere atwam.",
+	"Sign-in link has already been used.":                              "Wɔde link a wode bɛkɔ mu no adi dwuma dada.",
+	"Role not found.":                                                  "Yɛanhu dwumadie no.",
+	"Role name already exists.":                                        "Dwumadie din no wɔ hɔ dada.",
+	"Role name already exists for another role.":                       "Dwumadie foforɔ de din no redi dwuma dada.",
+	"Role '%v' does not exist.":                                        "Dwumadie '%v' nni hɔ.",
+	"Service account not found.":                                       "Yɛanhu service akawnt no.",
+	"Api key not found.":                                               "Yɛanhu api key no.",
+	"Scope '%v' is not valid.":                                         "Scope '%v' nfata.",
+	"Expiry date must be in the future.":                               "Ɛsɛ sɛ da a ɛbɛtwam no yɛ daakye.",
+
+	// Categories
+	"Category not found.":                                                           "Yɛanhu nkyekyɛmu no.",
+	"Category is archived.":                                                         "Wɔde nkyekyɛmu no asie.",
+	"Category name already exists.":                                                 "Nkyekyɛmu din no wɔ hɔ dada.",
+	"Category name already exists for another category.":                            "Nkyekyɛmu foforɔ de din no redi dwuma dada.",
+	"Category cannot be its own parent.":                                            "Nkyekyɛmu rentumi nyɛ n'ankasa ne wura.",
+	"Category has subcategories. Move or delete them first.":                        "Nkyekyɛmu no wɔ nkyekyɛmu nketewa. Tu wɔn anaa pepa wɔn kane.",
+	"Category with subcategories cannot be moved under another category.":           "Nkyekyɛmu a ɛwɔ nkyekyɛmu nketewa no rentumi nkɔ nkyekyɛmu foforɔ ase.",
+	"Category has %d incidents. Move them to another category or force the delete.": "Nkyekyɛmu no wɔ asɛm %d. Tu wɔn kɔ nkyekyɛmu foforɔ mu anaa hyɛ ma wɔmpepa.",
+	"Category %v is listed more than once.":                                         "Nkyekyɛmu %v aba mprɛnu anaa ɛboro saa.",
+	"Category does not accept extra fields.":                                        "Nkyekyɛmu no nnye nsɛm foforɔ a ɛka ho.",
+	"Incidents cannot be moved to the category being deleted.":                      "Wɔrentumi mfa nsɛm no nkɔ nkyekyɛmu a wɔrepepa no mu.",
+	"One or more categories were not found.":                                        "Yɛanhu nkyekyɛmu no bi.",
+	"Parent category not found.":                                                    "Yɛanhu nkyekyɛmu kɛseɛ no.",
+	"Parent category is archived.":                                                  "Wɔde nkyekyɛmu kɛseɛ no asie.",
+	"Parent category is archived. Unarchive it first.":                              "Wɔde nkyekyɛmu kɛseɛ no asie. Yi firi hɔ kane.",
+	"Parent category must be a top-level category.":                                 "Ɛsɛ sɛ nkyekyɛmu kɛseɛ no yɛ nkyekyɛmu a ɛwɔ soro.",
+
+	// Incidents
+	"Incident not found.":                                "Yɛanhu asɛm a esii no.",
+	"The client id is already used by another incident.": "Asɛm foforɔ de client id no redi dwuma dada.",
+
+	// USSD
+	"Phone number is not valid.":                          "Fon nɔma no nfata.",
+	"The USSD secret is not valid.":                       "USSD secret no nfata.",
+	"The service is unavailable. Please try again later.": "Dwumadie no nni hɔ seesei. Yɛsrɛ wo, san bɔ mmɔden akyiri yi.",
+	"No categories are available for reporting.":          "Nkyekyɛmu biara nni hɔ a wobɛtumi de abɔ amanneɛ.",
+	"Choose a category:":                                  "Yi nkyekyɛmu bi:",
+	"%v. More":                                            "%v. Nkaeɛ",
+	"%v. Back":                                            "%v. San kɔ akyi",
+	"Invalid choice.":                                     "Nea woayi no nfata.",
+	"Choose the severity:":                                "Yi sɛnea ɛyɛ den fa:",
+	"Low":                                                 "Ɛnyɛ den",
+	"Medium":                                              "Ɛyɛ den kakra",
+	"High":                                                "Ɛyɛ den paa",
+	"Where did it happen? Type a short location:":            "Ɛhe na ɛsii? Kyerɛw beaeɛ no tiawa:",
+	"Type a short location, such as a town or landmark:":     "Kyerɛw beaeɛ no tiawa, te sɛ kurom anaa agyiraeɛ bi:",
+	"Your report could not be sent. Please try again later.": "Yɛantumi amfa wo amanneɛbɔ no amma. Yɛsrɛ wo, san bɔ mmɔden akyiri yi.",
+	"Thank you. Your report %v has been received.":           "Yɛda wo ase. Yɛanya wo amanneɛbɔ %v.",
+	// SMS
+	"The SMS secret is not valid.":                                   "SMS secret no nfata.",
+	"%v is reserved for SMS commands.":                               "Yɛde %v ama SMS ahyɛdeɛ.",
+	"Keyword %v is already used by category %v.":                     "Nkyekyɛmu %[2]v de asɛmfua %[1]v redi dwuma dada.",
+	"Unknown keyword %v.":                                            "Yɛnnim asɛmfua %v.",
+	"Add where it happened, e.g. %v Kasoa toll booth.":               "Ka baabi a ɛsii ho, te sɛ %v Kasoa toll booth.",
+	"Send STATUS and the code of your report, e.g. STATUS INC12345.": "Fa STATUS ne wo amanneɛbɔ no kood brɛ yɛn, te sɛ STATUS INC12345.",
+	"No report %v was found for your number.":                        "Yɛanhu amanneɛbɔ %v biara wɔ wo nɔma no so.",
+	"Report %v: %v.":                                                 "Amanneɛbɔ %v: %v.",
+	"Pending":                                                        "Ɛretwɛn",
+	"Being investigated":                                             "Yɛrehwehwɛ mu",
+	"Resolved":                                                       "Yɛadi ho dwuma",
+	"Closed as a false alarm":                                        "Yɛato mu sɛ ɛnyɛ nokware",
+	"Keywords: %v.":                                                  "Nsɛmfua: %v.",
+	"Send a keyword and where it happened, e.g. %v Kasoa toll booth. Add HIGH or LOW for the severity.": "Fa asɛmfua bi ne baabi a ɛsii brɛ yɛn, te sɛ %v Kasoa toll booth. Fa HIGH anaa LOW ka ho de kyerɛ sɛnea ɛyɛ den fa.",
+	"Thank you. Your report %v has been received. Send STATUS %v to follow it up.":                      "Yɛda wo ase. Yɛanya wo amanneɛbɔ %v. Fa STATUS %v brɛ yɛn na woahu nea ɛrekɔ so.",
+	// Codes
+	"Your sign-in code is %v.": "Wo kood a wode bɛkɔ mu ne %v.",
+	"Your sign-in code is %v. You can also sign in with this link: %v": "Wo kood a wode bɛkɔ mu ne %v. Wobɛtumi nso de link yi akɔ mu: %v",
+	"Your verification code is %v.":                                    "Wo kood a yɛde hwɛ wo ho ne %v.",
+	"Your password reset code is %v.":                                  "Wo kood a wode bɛsesa wo password ne %v.",
+	"Sign in":                                                          "Kɔ mu",
+	"Verify your account":                                              "Hwɛ wo akawnt no mu",
+	"Confirm your new account":                                         "Si wo akawnt foforɔ no so dua",
+	"Reset your password":                                              "Sesa wo password",
+	"The code could not be sent. Please try again later.":              "Yɛantumi amfa kood no amma. Yɛsrɛ wo, san bɔ mmɔden akyiri yi.",
+	"%v of %v accounts due for erasure could not be erased.":           "Yɛantumi amfi akawnt %[1]v a ɛwɔ akawnt %[2]v a ɛsɛ sɛ yɛyi fi hɔ no mu ampopa.",
+}
@@ -0,0 +1,130 @@
+// Package logging carries a request-scoped logger through context.Context so
+// that log entries can be correlated with the request and trace that caused them.
+package logging
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/prince272/konabra/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestIdHeader is the header used to pass the request id in and out of the api
+const RequestIdHeader = "X-Request-Id"
+
+// requestIdPattern limits incoming request ids to values that are safe to log and echo back
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type loggerKey struct{}
+
+type requestIdKey struct{}
+
+// WithLogger returns a copy of the context carrying the logger
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by the context, or the fallback when there is none
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+			return logger
+		}
+	}
+	return fallback
+}
+
+// WithRequestId returns a copy of the context carrying the request id
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestId returns the id of the request the context belongs to, if any
+func RequestId(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// AddFields adds fields to the logger of the request, for values that are only
+// known once the request has been partly handled, such as the authenticated user
+func AddFields(context *gin.Context, fields ...zap.Field) {
+	ctx := context.Request.Context()
+	if logger, ok := ctx.Value(loggerKey{}).(*zap.Logger); ok {
+		context.Request = context.Request.WithContext(WithLogger(ctx, logger.With(fields...)))
+	}
+}
+
+// Middleware assigns every request an id, honouring the X-Request-Id header
+// sent by the client, and attaches a child logger carrying the request id,
+// route and trace ids to the request context. Once the request has been
+// handled an access log entry is written. It must run after the tracing middleware.
+func Middleware(logger *zap.Logger) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		ctx := context.Request.Context()
+
+		requestId := context.GetHeader(RequestIdHeader)
+		if !requestIdPattern.MatchString(requestId) {
+			requestId = uuid.New().String()
+		}
+		context.Header(RequestIdHeader, requestId)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request_id", requestId))
+
+		route := context.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		fields := []zap.Field{zap.String("requestId", requestId), zap.String("route", route)}
+		if traceId := tracing.TraceId(ctx); traceId != "" {
+			fields = append(fields, zap.String("traceId", traceId), zap.String("spanId", tracing.SpanId(ctx)))
+		}
+
+		ctx = WithRequestId(ctx, requestId)
+		context.Request = context.Request.WithContext(WithLogger(ctx, logger.With(fields...)))
+		context.Next()
+
+		// Read the logger back so that fields added while handling the request are logged
+		requestLogger := FromContext(context.Request.Context(), logger)
+
+		status := context.Writer.Status()
+		level := zapcore.InfoLevel
+		switch {
+		case status >= 500:
+			level = zapcore.ErrorLevel
+		case status >= 400:
+			level = zapcore.WarnLevel
+		case isProbe(context.Request.URL.Path):
+			level = zapcore.DebugLevel
+		}
+
+		requestLogger.Log(level, "Request completed",
+			zap.String("method", context.Request.Method),
+			zap.String("path", context.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.Int("size", context.Writer.Size()),
+			zap.String("ip", context.ClientIP()),
+			zap.String("userAgent", context.Request.UserAgent()),
+		)
+	}
+}
+
+// isProbe reports whether the path is polled by infrastructure rather than clients
+func isProbe(path string) bool {
+	switch path {
+	case "/healthz", "/readyz", "/metrics":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces the value of sensitive fields in log entries
+const Redacted = "[REDACTED]"
+
+// DevOnlyField is the field one-time codes are logged under in development, so
+// that flows can be completed without an SMTP server or SMS gateway. It is left
+// as is by the redaction, and must only be logged when the environment is development.
+const DevOnlyField = "devOnlyMessage"
+
+// sensitiveKeys are field names whose values are never written to the logs
+var sensitiveKeys = map[string]bool{
+	"code":  true,
+	"otp":   true,
+	"link":  true,
+	"key":   true,
+	"pin":   true,
+	"jwt":   true,
+	"hash":  true,
+	"nonce": true,
+}
+
+// sensitiveParts are substrings that mark a field name as sensitive
+var sensitiveParts = []string{"password", "token", "secret", "apikey", "authorization", "cookie"}
+
+// IsSensitive reports whether values logged under the key must be redacted
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, part := range sensitiveParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+type redactingCore struct {
+	zapcore.Core
+}
+
+// NewRedactingCore wraps the core so that the values of sensitive fields,
+// such as passwords, one-time codes and tokens, are replaced before being written
+func NewRedactingCore(core zapcore.Core) zapcore.Core {
+	return &redactingCore{core}
+}
+
+func (core *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{core.Core.With(redact(fields))}
+}
+
+func (core *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+	return checked
+}
+
+func (core *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return core.Core.Write(entry, redact(fields))
+}
+
+func redact(fields []zapcore.Field) []zapcore.Field {
+	var redacted []zapcore.Field
+	for i, field := range fields {
+		if !IsSensitive(field.Key) {
+			continue
+		}
+		if redacted == nil {
+			redacted = make([]zapcore.Field, len(fields))
+			copy(redacted, fields)
+		}
+		redacted[i] = zap.String(field.Key, Redacted)
+	}
+	if redacted == nil {
+		return fields
+	}
+	return redacted
+}
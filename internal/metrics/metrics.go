@@ -0,0 +1,187 @@
+// Package metrics exposes Prometheus metrics for HTTP requests, database
+// queries and domain events.
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "konabra"
+
+// unmatchedRoute labels requests that did not match any route so that
+// arbitrary paths do not create new time series
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	HttpRequestDuration  *prometheus.HistogramVec
+	HttpRequestsInFlight prometheus.Gauge
+	DbQueryDuration      *prometheus.HistogramVec
+	IncidentsCreated     *prometheus.CounterVec
+	SignIns              *prometheus.CounterVec
+	SignInFailures       *prometheus.CounterVec
+	OtpsSent             *prometheus.CounterVec
+	RateLimited          *prometheus.CounterVec
+}
+
+func NewMetrics() (*Metrics, error) {
+	metrics := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		HttpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by method, route template and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+
+		HttpRequestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests being served.",
+		}),
+
+		DbQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Duration of database statements by operation and table.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation", "table"}),
+
+		IncidentsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "incidents_created_total",
+			Help:      "Number of incidents reported by category and severity.",
+		}, []string{"category", "severity"}),
+
+		SignIns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sign_ins_total",
+			Help:      "Number of successful sign-ins by method.",
+		}, []string{"method"}),
+
+		SignInFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sign_in_failures_total",
+			Help:      "Number of failed sign-ins by method.",
+		}, []string{"method"}),
+
+		OtpsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "otps_sent_total",
+			Help:      "Number of one-time codes issued by purpose.",
+		}, []string{"purpose"}),
+
+		RateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_total",
+			Help:      "Number of requests rejected by a rate limit, by policy.",
+		}, []string{"policy"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		metrics.HttpRequestDuration,
+		metrics.HttpRequestsInFlight,
+		metrics.DbQueryDuration,
+		metrics.IncidentsCreated,
+		metrics.SignIns,
+		metrics.SignInFailures,
+		metrics.OtpsSent,
+		metrics.RateLimited,
+	} {
+		if err := metrics.registry.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (metrics *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{Registry: metrics.registry})
+}
+
+// Middleware records the duration of every request labelled by its route template
+func (metrics *Metrics) Middleware() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		metrics.HttpRequestsInFlight.Inc()
+		defer metrics.HttpRequestsInFlight.Dec()
+
+		context.Next()
+
+		route := context.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		metrics.HttpRequestDuration.
+			WithLabelValues(context.Request.Method, route, strconv.Itoa(context.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// RegisterDBStats exports the connection pool statistics of the database under the given name
+func (metrics *Metrics) RegisterDBStats(db *sql.DB, name string) error {
+	return metrics.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+const startTimeKey = "metrics:start_time"
+
+// InstrumentDB registers GORM callbacks that time every statement
+func (metrics *Metrics) InstrumentDB(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(startTimeKey, time.Now())
+	}
+
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			value, ok := tx.InstanceGet(startTimeKey)
+			if !ok {
+				return
+			}
+
+			start, ok := value.(time.Time)
+			if !ok {
+				return
+			}
+
+			table := tx.Statement.Table
+			if table == "" {
+				table = "unknown"
+			}
+
+			metrics.DbQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("metrics:before_create", before),
+		callbacks.Create().After("gorm:create").Register("metrics:after_create", after("create")),
+		callbacks.Query().Before("gorm:query").Register("metrics:before_query", before),
+		callbacks.Query().After("gorm:query").Register("metrics:after_query", after("query")),
+		callbacks.Update().Before("gorm:update").Register("metrics:before_update", before),
+		callbacks.Update().After("gorm:update").Register("metrics:after_update", after("update")),
+		callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", before),
+		callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete")),
+		callbacks.Row().Before("gorm:row").Register("metrics:before_row", before),
+		callbacks.Row().After("gorm:row").Register("metrics:after_row", after("row")),
+		callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", before),
+		callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw")),
+	)
+}
@@ -0,0 +1,445 @@
+// Package migrations applies the versioned SQL migrations embedded in the
+// sql directory. Each migration is a pair of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql.
+package migrations
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prince272/konabra/internal/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey identifies the advisory lock held while migrations are applied or
+// reverted, so replicas starting together apply them one at a time
+const lockKey int64 = 0x6b6f6e61627261 // "konabra"
+
+// Models are the models whose tables are created by the migrations. Check
+// compares them with the database schema.
+var Models = []any{
+	&models.User{},
+	&models.Role{},
+	&models.JwtToken{},
+	&models.ApiKey{},
+	&models.PasswordHistory{},
+	&models.Category{},
+	&models.Incident{},
+	&models.IncidentActivity{},
+	&models.AuditEvent{},
+	&models.RateLimitBucket{},
+	&models.IdempotencyRecord{},
+}
+
+// Migration is a versioned schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+// SchemaMigration is a row of the table tracking applied migrations
+type SchemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	logger     *zap.Logger
+	migrations []Migration
+}
+
+func NewMigrator(db *gorm.DB, logger *zap.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db, logger, migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionText, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		version, err := strconv.ParseInt(versionText, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", fileName)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join("sql", fileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %q: %w", fileName, err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, migration.Name, name)
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func (migrator *Migrator) ensureTable(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// applied returns the applied migrations by version, none when the tracking table does not exist yet
+func (migrator *Migrator) applied(db *gorm.DB) (map[int64]SchemaMigration, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return map[int64]SchemaMigration{}, nil
+	}
+
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// withLock runs the function on a single connection holding the migration advisory lock
+func (migrator *Migrator) withLock(function func(db *gorm.DB) error) error {
+	return migrator.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", lockKey).Error; err != nil {
+				migrator.logger.Error("Error releasing migration lock: ", zap.Error(err))
+			}
+		}()
+
+		return function(conn)
+	})
+}
+
+// Up applies every pending migration in order and returns the ones applied
+func (migrator *Migrator) Up() ([]Migration, error) {
+	var done []Migration
+	err := migrator.withLock(func(db *gorm.DB) error {
+		var err error
+		done, err = migrator.up(db)
+		return err
+	})
+	return done, err
+}
+
+func (migrator *Migrator) up(db *gorm.DB) ([]Migration, error) {
+	if err := migrator.ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	applied, err := migrator.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range migrator.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		migrator.logger.Info("Applied migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts the given number of most recently applied migrations and returns the ones reverted
+func (migrator *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+	err := migrator.withLock(func(db *gorm.DB) error {
+		var err error
+		done, err = migrator.down(db, steps)
+		return err
+	})
+	return done, err
+}
+
+func (migrator *Migrator) down(db *gorm.DB, steps int) ([]Migration, error) {
+	if err := migrator.ensureTable(db); err != nil {
+		return nil, err
+	}
+
+	applied, err := migrator.applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(migrator.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrator.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if migration.Down == "" {
+			return done, fmt.Errorf("migration %d_%s cannot be reverted", migration.Version, migration.Name)
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		migrator.logger.Info("Reverted migration", zap.Int64("version", migration.Version), zap.String("name", migration.Name))
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Status lists every known migration along with when it was applied
+func (migrator *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := migrator.applied(migrator.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrator.migrations))
+	for _, migration := range migrator.migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Verify returns an error when migrations are pending. Applied migrations that
+// this build does not know about are only logged, since they are expected
+// while a newer release is being rolled out.
+func (migrator *Migrator) Verify() error {
+	applied, err := migrator.applied(migrator.db)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, migration := range migrator.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, fmt.Sprintf("%04d_%s", migration.Version, migration.Name))
+		}
+		delete(applied, migration.Version)
+	}
+
+	for _, row := range applied {
+		migrator.logger.Warn("Database has a migration unknown to this build", zap.Int64("version", row.Version), zap.String("name", row.Name))
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is out of date, pending migrations: %s", strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+// typeAliases maps the type names used by models to the names reported by Postgres
+var typeAliases = map[string]string{
+	"boolean":          "bool",
+	"smallint":         "int2",
+	"integer":          "int4",
+	"bigint":           "int8",
+	"decimal":          "numeric",
+	"real":             "float4",
+	"double precision": "float8",
+	"varchar":          "varchar",
+	"timestamp":        "timestamp",
+}
+
+var typeSizePattern = regexp.MustCompile(`\(.*\)`)
+
+func normalizeType(name string) string {
+	name = strings.TrimSpace(typeSizePattern.ReplaceAllString(strings.ToLower(name), ""))
+	if alias, ok := typeAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// Check compares the models with the tables, columns, column types and indexes
+// in the database and returns every difference found. It is meant to run in CI
+// against a database migrated with Up.
+func (migrator *Migrator) Check(values ...any) ([]string, error) {
+	var differences []string
+	dbMigrator := migrator.db.Migrator()
+	checkedTables := make(map[string]bool)
+
+	checkColumns := func(table string, dbNames []string, dataTypes map[string]string) error {
+		if checkedTables[table] {
+			return nil
+		}
+		checkedTables[table] = true
+
+		if !dbMigrator.HasTable(table) {
+			differences = append(differences, fmt.Sprintf("table %s is missing", table))
+			return nil
+		}
+
+		columnTypes, err := dbMigrator.ColumnTypes(table)
+		if err != nil {
+			return fmt.Errorf("failed to read columns of %s: %w", table, err)
+		}
+
+		columns := make(map[string]string, len(columnTypes))
+		for _, columnType := range columnTypes {
+			columns[columnType.Name()] = columnType.DatabaseTypeName()
+		}
+
+		for _, dbName := range dbNames {
+			databaseType, ok := columns[dbName]
+			if !ok {
+				differences = append(differences, fmt.Sprintf("column %s.%s is missing", table, dbName))
+				continue
+			}
+			delete(columns, dbName)
+
+			if dataType := dataTypes[dbName]; dataType != "" && normalizeType(dataType) != normalizeType(databaseType) {
+				differences = append(differences, fmt.Sprintf("column %s.%s is %s but the model expects %s", table, dbName, databaseType, dataType))
+			}
+		}
+
+		for dbName := range columns {
+			differences = append(differences, fmt.Sprintf("column %s.%s is not mapped by any model", table, dbName))
+		}
+
+		return nil
+	}
+
+	for _, value := range values {
+		statement := &gorm.Statement{DB: migrator.db}
+		if err := statement.Parse(value); err != nil {
+			return nil, fmt.Errorf("failed to parse model: %w", err)
+		}
+		modelSchema := statement.Schema
+
+		dataTypes := make(map[string]string, len(modelSchema.DBNames))
+		for _, dbName := range modelSchema.DBNames {
+			dataTypes[dbName] = migrator.db.Dialector.DataTypeOf(modelSchema.FieldsByDBName[dbName])
+		}
+
+		if err := checkColumns(modelSchema.Table, modelSchema.DBNames, dataTypes); err != nil {
+			return nil, err
+		}
+
+		if dbMigrator.HasTable(modelSchema.Table) {
+			for _, index := range modelSchema.ParseIndexes() {
+				if !dbMigrator.HasIndex(value, index.Name) {
+					differences = append(differences, fmt.Sprintf("index %s on %s is missing", index.Name, modelSchema.Table))
+				}
+			}
+		}
+
+		for _, relationship := range modelSchema.Relationships.Relations {
+			if joinTable := relationship.JoinTable; joinTable != nil {
+				if err := checkColumns(joinTable.Table, joinTable.DBNames, nil); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	sort.Strings(differences)
+	return differences, nil
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "incident_activities";
+DROP TABLE IF EXISTS "incidents";
+DROP TABLE IF EXISTS "categories";
+DROP TABLE IF EXISTS "jwt_tokens";
+DROP TABLE IF EXISTS "user_roles";
+DROP TABLE IF EXISTS "roles";
+DROP TABLE IF EXISTS "users";
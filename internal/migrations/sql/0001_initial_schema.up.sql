@@ -0,0 +1,99 @@
+-- Initial schema. Uses IF NOT EXISTS so databases created by the former
+-- AutoMigrate setup can adopt versioned migrations without changes.
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" text,
+    "first_name" text,
+    "last_name" text,
+    "user_name" text,
+    "email" text,
+    "email_verified" boolean,
+    "phone_number" text,
+    "phone_number_verified" boolean,
+    "security_stamp" text,
+    "password_hash" text,
+    "has_password" boolean,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "last_active_at" timestamptz,
+    "last_password_changed_at" timestamptz,
+    "deleted_at" timestamptz,
+    "status" text DEFAULT 'active',
+    "status_reason" text,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "roles" (
+    "id" text,
+    "name" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "order" bigint,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_roles_deleted_at" ON "roles" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "user_roles" (
+    "user_id" text,
+    "role_id" text,
+    PRIMARY KEY ("user_id", "role_id"),
+    CONSTRAINT "fk_user_roles_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_user_roles_role" FOREIGN KEY ("role_id") REFERENCES "roles"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "jwt_tokens" (
+    "id" text,
+    "subject" text,
+    "token_type" text,
+    "issued_at" timestamptz,
+    "access_token_hash" text,
+    "access_token_expires_at" timestamptz,
+    "refresh_token_hash" text,
+    "refresh_token_expires_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "categories" (
+    "id" text,
+    "name" text,
+    "slug" text,
+    "description" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "order" bigint,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_categories_deleted_at" ON "categories" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "incidents" (
+    "category_id" text,
+    "id" text,
+    "code" text,
+    "summary" text,
+    "severity" text,
+    "status" text,
+    "updated_at" timestamptz,
+    "reported_at" timestamptz,
+    "reported_by_id" text,
+    "resolved_at" timestamptz,
+    "deleted_at" timestamptz,
+    "latitude" decimal,
+    "longitude" decimal,
+    "location" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_incidents_category" FOREIGN KEY ("category_id") REFERENCES "categories"("id"),
+    CONSTRAINT "fk_incidents_reported_by" FOREIGN KEY ("reported_by_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_incidents_deleted_at" ON "incidents" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "incident_activities" (
+    "id" text,
+    "incident_id" text,
+    "message" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_incidents_activities" FOREIGN KEY ("incident_id") REFERENCES "incidents"("id")
+);
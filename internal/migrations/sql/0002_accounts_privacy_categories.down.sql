@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS "audit_events";
+
+ALTER TABLE "incidents" DROP COLUMN IF EXISTS "fields";
+
+ALTER TABLE "categories" DROP CONSTRAINT IF EXISTS "fk_categories_children";
+DROP INDEX IF EXISTS "idx_categories_parent_id";
+DROP INDEX IF EXISTS "idx_categories_archived_at";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "archived_at";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "schema";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "color";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "icon";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "parent_id";
+
+DROP TABLE IF EXISTS "password_histories";
+DROP TABLE IF EXISTS "api_keys";
+
+DROP INDEX IF EXISTS "idx_users_erasure_scheduled_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "erasure_scheduled_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "is_service_account";
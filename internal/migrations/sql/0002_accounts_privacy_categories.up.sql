@@ -0,0 +1,69 @@
+-- Account security, privacy and category hierarchy. Columns and tables are
+-- created only when missing because databases that ran the former AutoMigrate
+-- setup may already have them.
+
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "is_service_account" boolean;
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "erasure_scheduled_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_users_erasure_scheduled_at" ON "users" ("erasure_scheduled_at");
+
+CREATE TABLE IF NOT EXISTS "api_keys" (
+    "id" text,
+    "name" text,
+    "prefix" text,
+    "key_hash" text,
+    "scopes" text,
+    "user_id" text,
+    "expires_at" timestamptz,
+    "last_used_at" timestamptz,
+    "created_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_api_keys_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_key_hash" ON "api_keys" ("key_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_deleted_at" ON "api_keys" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_api_keys_user_id" ON "api_keys" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "password_histories" (
+    "id" text,
+    "user_id" text,
+    "password_hash" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_password_histories_created_at" ON "password_histories" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_password_histories_user_id" ON "password_histories" ("user_id");
+
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "parent_id" text;
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "icon" text;
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "color" text;
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "schema" jsonb DEFAULT '{}';
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "archived_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_categories_archived_at" ON "categories" ("archived_at");
+CREATE INDEX IF NOT EXISTS "idx_categories_parent_id" ON "categories" ("parent_id");
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_categories_children') THEN
+        ALTER TABLE "categories" ADD CONSTRAINT "fk_categories_children" FOREIGN KEY ("parent_id") REFERENCES "categories"("id");
+    END IF;
+END $$;
+
+ALTER TABLE "incidents" ADD COLUMN IF NOT EXISTS "fields" jsonb DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS "audit_events" (
+    "id" text,
+    "actor_id" text,
+    "action" text,
+    "target_type" text,
+    "target_id" text,
+    "ip_address" text,
+    "user_agent" text,
+    "changes" jsonb DEFAULT '{}',
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_events_actor_id" ON "audit_events" ("actor_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_created_at" ON "audit_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_target" ON "audit_events" ("target_type", "target_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_action" ON "audit_events" ("action");
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS "rate_limit_buckets" (
+    "key" text,
+    "tokens" decimal,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("key")
+);
+CREATE INDEX IF NOT EXISTS "idx_rate_limit_buckets_updated_at" ON "rate_limit_buckets" ("updated_at");
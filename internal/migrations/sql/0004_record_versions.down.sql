@@ -0,0 +1,3 @@
+ALTER TABLE "roles" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "categories" DROP COLUMN IF EXISTS "version";
+ALTER TABLE "incidents" DROP COLUMN IF EXISTS "version";
@@ -0,0 +1,3 @@
+ALTER TABLE "incidents" ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
+ALTER TABLE "roles" ADD COLUMN IF NOT EXISTS "version" bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS "idempotency_records" (
+    "key" text,
+    "fingerprint" text,
+    "status" bigint,
+    "content_type" text,
+    "body" bytea,
+    "created_at" timestamptz,
+    "expires_at" timestamptz,
+    PRIMARY KEY ("key")
+);
+CREATE INDEX IF NOT EXISTS "idx_idempotency_records_expires_at" ON "idempotency_records" ("expires_at");
@@ -0,0 +1 @@
+ALTER TABLE "categories" ADD COLUMN IF NOT EXISTS "keywords" jsonb DEFAULT '[]';
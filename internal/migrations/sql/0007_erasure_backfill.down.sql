@@ -0,0 +1,3 @@
+UPDATE "users"
+SET "erasure_scheduled_at" = NULL
+WHERE "deleted_at" IS NOT NULL;
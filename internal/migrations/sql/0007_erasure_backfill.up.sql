@@ -0,0 +1,8 @@
+-- Accounts deleted before erasure was scheduled were only soft-deleted, which
+-- kept their personal data and held on to their email address and phone number.
+-- They are scheduled for erasure 30 days after their deletion, the default
+-- grace period, so that the erasure job frees them.
+
+UPDATE "users"
+SET "erasure_scheduled_at" = "deleted_at" + INTERVAL '30 days'
+WHERE "deleted_at" IS NOT NULL AND "erasure_scheduled_at" IS NULL;
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ApiKey struct {
+	Id         string         `gorm:"primaryKey" json:"id"`
+	Name       string         `json:"name"`
+	Prefix     string         `json:"prefix"`
+	KeyHash    string         `gorm:"uniqueIndex" json:"keyHash"`
+	Scopes     string         `json:"scopes"` // Comma-separated list of scopes
+	UserId     string         `gorm:"index" json:"userId"`
+	User       *User          `json:"user"`
+	ExpiresAt  *time.Time     `json:"expiresAt"`
+	LastUsedAt *time.Time     `json:"lastUsedAt"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	DeletedAt  gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deletedAt"`
+}
+
+func (apiKey *ApiKey) ScopeList() []string {
+	if apiKey.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(apiKey.Scopes, ",")
+}
+
+func (apiKey *ApiKey) HasScope(scope string) bool {
+	return slices.Contains(apiKey.ScopeList(), scope)
+}
+
+func (apiKey *ApiKey) IsExpired() bool {
+	return apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now())
+}
+
+const (
+	ScopeIncidentsRead   = "incidents:read"
+	ScopeIncidentsWrite  = "incidents:write"
+	ScopeCategoriesRead  = "categories:read"
+	ScopeCategoriesWrite = "categories:write"
+	ScopeRolesRead       = "roles:read"
+	ScopeRolesWrite      = "roles:write"
+	ScopeUsersRead       = "users:read"
+)
+
+var ScopeAll = []string{
+	ScopeIncidentsRead,
+	ScopeIncidentsWrite,
+	ScopeCategoriesRead,
+	ScopeCategoriesWrite,
+	ScopeRolesRead,
+	ScopeRolesWrite,
+	ScopeUsersRead,
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// AuditEvent is an append-only record of a security or administrative action
+type AuditEvent struct {
+	Id         string    `gorm:"primaryKey" json:"id"`
+	ActorId    string    `gorm:"index" json:"actorId"`
+	Action     string    `gorm:"index" json:"action"`
+	TargetType string    `gorm:"index:idx_audit_events_target" json:"targetType"`
+	TargetId   string    `gorm:"index:idx_audit_events_target" json:"targetId"`
+	IpAddress  string    `json:"ipAddress"`
+	UserAgent  string    `json:"userAgent"`
+	Changes    string    `gorm:"type:jsonb;default:'{}'" json:"changes"`
+	CreatedAt  time.Time `gorm:"index" json:"createdAt"`
+}
+
+const (
+	AuditActionAccountCreated          = "account.created"
+	AuditActionAccountSignedIn         = "account.signedIn"
+	AuditActionAccountSignInFailed     = "account.signInFailed"
+	AuditActionAccountSignedOut        = "account.signedOut"
+	AuditActionAccountChanged          = "account.changed"
+	AuditActionAccountVerified         = "account.verified"
+	AuditActionAccountDeleted          = "account.deleted"
+	AuditActionAccountErasureCancelled = "account.erasureCancelled"
+	AuditActionAccountErased           = "account.erased"
+	AuditActionAccountExported         = "account.exported"
+	AuditActionPasswordChanged         = "password.changed"
+	AuditActionPasswordReset           = "password.reset"
+	AuditActionApiKeyCreated           = "apiKey.created"
+	AuditActionApiKeyRevoked           = "apiKey.revoked"
+	AuditActionServiceAccountCreated   = "serviceAccount.created"
+	AuditActionServiceAccountDeleted   = "serviceAccount.deleted"
+	AuditActionRoleCreated             = "role.created"
+	AuditActionRoleUpdated             = "role.updated"
+	AuditActionRoleDeleted             = "role.deleted"
+	AuditActionCategoryCreated         = "category.created"
+	AuditActionCategoryUpdated         = "category.updated"
+	AuditActionCategoryDeleted         = "category.deleted"
+	AuditActionCategoryArchived        = "category.archived"
+	AuditActionCategoryUnarchived      = "category.unarchived"
+	AuditActionCategoryReordered       = "category.reordered"
+	AuditActionIncidentCreated         = "incident.created"
+	AuditActionIncidentUpdated         = "incident.updated"
+	AuditActionIncidentDeleted         = "incident.deleted"
+)
+
+// AuditSecurityActions are the actions shown to users as their security activity
+var AuditSecurityActions = []string{
+	AuditActionAccountCreated,
+	AuditActionAccountSignedIn,
+	AuditActionAccountSignInFailed,
+	AuditActionAccountSignedOut,
+	AuditActionAccountChanged,
+	AuditActionAccountVerified,
+	AuditActionAccountDeleted,
+	AuditActionAccountErasureCancelled,
+	AuditActionAccountExported,
+	AuditActionPasswordChanged,
+	AuditActionPasswordReset,
+	AuditActionApiKeyCreated,
+	AuditActionApiKeyRevoked,
+}
+
+const (
+	AuditTargetUser     = "user"
+	AuditTargetRole     = "role"
+	AuditTargetApiKey   = "apiKey"
+	AuditTargetCategory = "category"
+	AuditTargetIncident = "incident"
+)
@@ -8,11 +8,20 @@ import (
 
 type Category struct {
 	Id          string         `gorm:"primaryKey" json:"id"`
+	ParentId    *string        `gorm:"index" json:"parentId"`
+	Parent      *Category      `gorm:"foreignKey:ParentId" json:"parent"`
+	Children    []*Category    `gorm:"foreignKey:ParentId" json:"children"`
 	Name        string         `json:"name"`
 	Slug        string         `json:"slug"`
 	Description string         `json:"description"`
+	Icon        string         `json:"icon"`                                    // Icon key used for map pins
+	Color       string         `json:"color"`                                   // Hex colour used for map pins, e.g. #FF8800
+	Schema      JSONMap        `gorm:"type:jsonb;default:'{}'" json:"schema"`   // JSON schema of the extra fields reported with an incident
+	Keywords    JSONList       `gorm:"type:jsonb;default:'[]'" json:"keywords"` // Upper-case words that file an SMS report under the category, e.g. ACC
 	CreatedAt   time.Time      `json:"createdAt"`
 	UpdatedAt   time.Time      `json:"updatedAt"`
+	Version     int64          `gorm:"not null;default:1" json:"version"` // Incremented on every update, see ErrStale
+	ArchivedAt  *time.Time     `gorm:"index" json:"archivedAt"`           // Archived categories are hidden from reporters but kept for history
 	DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deletedAt"`
 	Order       int64          `json:"order"`
 }
@@ -0,0 +1,14 @@
+package models
+
+import "errors"
+
+// Errors returned by the repositories. They are wrapped together with the
+// underlying database error, so they must be checked with errors.Is.
+var (
+	ErrNotFound    = errors.New("not found")               // The record does not exist
+	ErrConflict    = errors.New("conflict")                // A unique or foreign key constraint was violated
+	ErrUnavailable = errors.New("temporarily unavailable") // The database could not serve the request, it can be retried
+	ErrStale       = errors.New("stale")                   // The record was changed by someone else since it was read
+
+	ErrInvalidCursor = errors.New("invalid cursor") // A page cursor could not be read or belongs to another sort
+)
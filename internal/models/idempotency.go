@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// IdempotencyRecord is the response stored for an idempotency key when keys
+// are kept in the database so that every instance of the api sees them
+type IdempotencyRecord struct {
+	Key         string    `gorm:"primaryKey" json:"key"`
+	Fingerprint string    `json:"fingerprint"` // Hash of the method, path and body of the first request
+	Status      int       `json:"status"`      // Zero while the first request is being processed
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `gorm:"index" json:"expiresAt"`
+}
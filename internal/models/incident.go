@@ -23,14 +23,16 @@ type Incident struct {
 	Severity     IncidentSeverity    `json:"severity"`
 	Status       IncidentStatus      `json:"status"`
 	UpdatedAt    time.Time           `json:"updatedAt"`
+	Version      int64               `gorm:"not null;default:1" json:"version"` // Incremented on every update, see ErrStale
 	ReportedAt   time.Time           `json:"reportedAt"`
 	ReportedBy   *User               `json:"reportedBy"`
-	ReportedById string              `json:"reportedById"`
+	ReportedById *string             `json:"reportedById"` // Nil once the reporter's account has been erased
 	ResolvedAt   *time.Time          `json:"resolvedAt"`
 	DeletedAt    gorm.DeletedAt      `gorm:"column:deleted_at;index" json:"deletedAt"`
 	Latitude     float64             `json:"latitude"`
 	Longitude    float64             `json:"longitude"`
 	Location     string              `json:"location"`
+	Fields       JSONMap             `gorm:"type:jsonb;default:'{}'" json:"fields"` // Extra fields described by the category schema
 	Activities   []*IncidentActivity `gorm:"foreignKey:IncidentId;" json:"activities"`
 }
 
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JSONMap is a JSON object stored in a jsonb column
+type JSONMap map[string]any
+
+func (value JSONMap) Value() (driver.Value, error) {
+	if value == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (value *JSONMap) Scan(source any) error {
+	var data []byte
+	switch source := source.(type) {
+	case nil:
+		*value = JSONMap{}
+		return nil
+	case []byte:
+		data = source
+	case string:
+		data = []byte(source)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONMap", source)
+	}
+
+	result := JSONMap{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*value = result
+	return nil
+}
+
+// JSONList is a list of strings stored in a jsonb column
+type JSONList []string
+
+func (value JSONList) Value() (driver.Value, error) {
+	if value == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (value *JSONList) Scan(source any) error {
+	var data []byte
+	switch source := source.(type) {
+	case nil:
+		*value = JSONList{}
+		return nil
+	case []byte:
+		data = source
+	case string:
+		data = []byte(source)
+	default:
+		return fmt.Errorf("cannot scan %T into JSONList", source)
+	}
+
+	result := JSONList{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*value = result
+	return nil
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PasswordHistory keeps the hashes of passwords a user has previously set
+type PasswordHistory struct {
+	Id           string    `gorm:"primaryKey" json:"id"`
+	UserId       string    `gorm:"index" json:"userId"`
+	PasswordHash string    `json:"passwordHash"`
+	CreatedAt    time.Time `gorm:"index" json:"createdAt"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the shared state of a token bucket used when rate limits
+// are kept in the database so that every instance of the api sees the same counters
+type RateLimitBucket struct {
+	Key       string    `gorm:"primaryKey" json:"key"`
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `gorm:"index" json:"updatedAt"`
+}
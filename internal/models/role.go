@@ -11,6 +11,7 @@ type Role struct {
 	Name      string         `json:"name"`
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
+	Version   int64          `gorm:"not null;default:1" json:"version"` // Incremented on every update, see ErrStale
 	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deletedAt"`
 	Order     int            `json:"order"`
 	Users     []*User        `gorm:"many2many:user_roles;" json:"users"`
@@ -35,6 +35,8 @@ type User struct {
 	DeletedAt             gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deletedAt"`
 	Status                UserStatus     `json:"status" gorm:"default:'active'"`
 	StatusReason          string         `json:"statusReason"`
+	IsServiceAccount      bool           `json:"isServiceAccount"`
+	ErasureScheduledAt    *time.Time     `gorm:"index" json:"erasureScheduledAt"`
 }
 
 func (user *User) FullName() string {
@@ -0,0 +1,95 @@
+// Package probes reports the liveness and readiness of the application to
+// load balancers and orchestrators.
+package probes
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Status is the result of a readiness check
+type Status struct {
+	Ready  bool              `json:"ready"`
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+const (
+	StatusOk       = "ok"
+	StatusDraining = "draining"
+	StatusFailing  = "failing"
+)
+
+type Prober struct {
+	checks   []namedCheck
+	timeout  time.Duration
+	draining atomic.Bool
+	mu       sync.RWMutex
+}
+
+// NewProber creates a prober that gives each check up to the timeout to finish
+func NewProber(timeout time.Duration) *Prober {
+	return &Prober{timeout: timeout}
+}
+
+// AddCheck registers a dependency that must be healthy for the application to be ready
+func (prober *Prober) AddCheck(name string, check Check) {
+	prober.mu.Lock()
+	defer prober.mu.Unlock()
+	prober.checks = append(prober.checks, namedCheck{name, check})
+}
+
+// SetDraining marks the application as shutting down so that it stops receiving new traffic
+func (prober *Prober) SetDraining() {
+	prober.draining.Store(true)
+}
+
+// Ready runs every check concurrently and reports whether all of them passed
+func (prober *Prober) Ready(ctx context.Context) Status {
+	prober.mu.RLock()
+	checks := prober.checks
+	prober.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, prober.timeout)
+	defer cancel()
+
+	results := make([]string, len(checks))
+	var wait sync.WaitGroup
+	for i, check := range checks {
+		wait.Add(1)
+		go func(i int, check namedCheck) {
+			defer wait.Done()
+			results[i] = StatusOk
+			if err := check.check(ctx); err != nil {
+				results[i] = err.Error()
+			}
+		}(i, check)
+	}
+	wait.Wait()
+
+	status := Status{Ready: true, Status: StatusOk, Checks: make(map[string]string, len(checks))}
+	for i, check := range checks {
+		status.Checks[check.name] = results[i]
+		if results[i] != StatusOk {
+			status.Ready = false
+			status.Status = StatusFailing
+		}
+	}
+
+	if prober.draining.Load() {
+		status.Ready = false
+		status.Status = StatusDraining
+	}
+
+	return status
+}
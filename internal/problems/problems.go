@@ -1,128 +1,277 @@
 package problems
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"net/http"
+	"errors"
+	"reflect"
 	"regexp"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/models"
 	humanize "github.com/prince272/konabra/pkg/humanize"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ContentType is the media type problems are served with
+const ContentType = "application/problem+json"
+
+// Problem describes an error returned by the api as RFC 9457 problem details
 type Problem struct {
-	Type    string            `json:"type,omitempty"` // A URI reference to the problem type
-	Message string            `json:"message"`        // Short summary of the problem
-	Status  int               `json:"status"`         // HTTP status code
-	Errors  map[string]string `json:"errors"`         // Field validation errors
-	Reason  string            `json:"reason"`         // Reason for the error
+	Type     string            `json:"type"`               // A URI reference to the documentation of the problem type
+	Title    string            `json:"title"`              // Short summary of the problem type
+	Status   int               `json:"status"`             // HTTP status code
+	Detail   string            `json:"detail"`             // Explanation specific to this occurrence of the problem
+	Instance string            `json:"instance,omitempty"` // Id of the request the problem occurred in
+	Errors   map[string]string `json:"errors"`             // Field validation errors, keyed by the JSON pointer of the field
+	TraceId  string            `json:"traceId,omitempty"`  // Id of the trace of the request, for support requests
+	Current  any               `json:"current,omitempty"`  // Current representation of the resource, for precondition failures
+
+	validationErrors validator.ValidationErrors // Rendered again in the language of the request
+}
+
+// WithContext localizes the problem in the language of the request and sets
+// its instance and trace id from the request id and span in the context
+func (problem *Problem) WithContext(ctx context.Context) *Problem {
+	locale := locales.FromContext(ctx)
+	problem.Title = locales.Translate(locale, problem.Title)
+	problem.Detail = locales.Translate(locale, problem.Detail)
+	if problem.validationErrors != nil {
+		problem.Errors = getProcessValidationErrors(locale, problem.validationErrors)
+	} else {
+		for field, message := range problem.Errors {
+			problem.Errors[field] = locales.Translate(locale, message)
+		}
+	}
+
+	problem.Instance = logging.RequestId(ctx)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		problem.TraceId = spanContext.TraceID().String()
+	}
+	return problem
+}
+
+// unavailableRetryAfter is the number of seconds clients are asked to wait
+// before retrying a request that failed because a dependency was unavailable
+const unavailableRetryAfter = "5"
+
+// Write sends the problem as the response to the request
+func Write(c *gin.Context, problem *Problem) {
+	c.Header("Content-Type", ContentType)
+	if problem.Type == TypeUnavailable.URI() && c.Writer.Header().Get("Retry-After") == "" {
+		c.Header("Retry-After", unavailableRetryAfter)
+	}
+	c.JSON(problem.Status, problem.WithContext(c.Request.Context()))
 }
 
-func NewProblem(status int, message string) *Problem {
+// Abort sends the problem as the response and stops the remaining handlers of the request
+func Abort(c *gin.Context, problem *Problem) {
+	c.Abort()
+	Write(c, problem)
+}
+
+// New returns a problem of the given type
+func New(problemType Type, detail string) *Problem {
 	return &Problem{
-		Type:    buildTypeURL(status),
-		Message: message,
-		Status:  status,
-		Errors:  map[string]string{},
-		Reason:  getReasonPhrase(status),
+		Type:   problemType.URI(),
+		Title:  problemType.Title,
+		Status: problemType.Status,
+		Detail: detail,
+		Errors: map[string]string{},
 	}
 }
 
+// NewProblem returns a problem of the type registered for the status
+func NewProblem(status int, detail string) *Problem {
+	return New(typeForStatus(status), detail)
+}
+
+// NewValidationProblem returns a validation problem. Fields are named by JSON
+// pointers or by dot-separated paths, such as "fields.severity".
 func NewValidationProblem(errors map[string]string) *Problem {
-	status := http.StatusBadRequest
-	return &Problem{
-		Type:    buildTypeURL(status),
-		Message: "One or more validation errors occurred.",
-		Status:  status,
-		Errors:  errors,
-		Reason:  getReasonPhrase(status),
+	problem := New(TypeValidation, "One or more validation errors occurred.")
+	for field, message := range errors {
+		problem.Errors[fieldPointer(field)] = message
 	}
+	return problem
 }
 
+// NewPreconditionFailedProblem returns the problem for an update based on a
+// version of the resource that is no longer current
+func NewPreconditionFailedProblem(current any) *Problem {
+	problem := New(TypePreconditionFailed, "The resource was changed by someone else. Review the current version and try again.")
+	problem.Current = current
+	return problem
+}
+
+// StatusClientClosedRequest is used when the client went away before the request completed
+const StatusClientClosedRequest = 499
+
 func FromError(err error) *Problem {
-	var errors map[string]string
+	var syntaxError *json.SyntaxError
+	var parseError *time.ParseError
+	var typeError *json.UnmarshalTypeError
+
 	if errs, ok := err.(validator.ValidationErrors); ok {
-		errors = getProcessValidationErrors(errs)
-		return NewValidationProblem(errors)
-	} else if _, ok := err.(*json.SyntaxError); ok {
-		status := http.StatusBadRequest
-		return &Problem{
-			Type:    buildTypeURL(status),
-			Message: "The request body is not valid JSON.",
-			Status:  status,
-			Errors:  map[string]string{},
-			Reason:  getReasonPhrase(status),
-		}
-	} else if ok := err.(*time.ParseError); ok != nil {
-		status := http.StatusBadRequest
-		return &Problem{
-			Type:    buildTypeURL(status),
-			Message: "The datetime format is not valid.",
-			Status:  status,
-			Errors:  map[string]string{},
-			Reason:  getReasonPhrase(status),
-		}
+		problem := New(TypeValidation, "One or more validation errors occurred.")
+		problem.Errors = getProcessValidationErrors(locales.English, errs)
+		problem.validationErrors = errs
+		return problem
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		return New(TypeTimeout, "The request took too long to complete. Please try again later.")
+	} else if errors.Is(err, context.Canceled) {
+		return New(TypeClientClosedRequest, "The request was cancelled by the client.")
+	} else if errors.Is(err, models.ErrNotFound) {
+		return New(TypeNotFound, "The requested resource was not found.")
+	} else if errors.Is(err, models.ErrConflict) {
+		return New(TypeConflict, "The resource conflicts with an existing one.")
+	} else if errors.Is(err, models.ErrStale) {
+		return New(TypePreconditionFailed, "The resource was changed by someone else. Review the current version and try again.")
+	} else if errors.Is(err, models.ErrUnavailable) {
+		return New(TypeUnavailable, "The service is temporarily unavailable. Please try again.")
+	} else if errors.Is(err, models.ErrInvalidCursor) {
+		return New(TypeMalformedRequest, "The page cursor is not valid.")
+	} else if errors.As(err, &syntaxError) {
+		return New(TypeMalformedRequest, "The request body is not valid JSON.")
+	} else if errors.As(err, &typeError) {
+		return New(TypeMalformedRequest, "A value in the request body has the wrong type.")
+	} else if errors.As(err, &parseError) {
+		return New(TypeMalformedRequest, "The datetime format is not valid.")
 	} else {
-		status := http.StatusInternalServerError
-		return &Problem{
-			Type:    buildTypeURL(status),
-			Message: "An internal server error has occurred.",
-			Status:  status,
-			Errors:  map[string]string{},
-			Reason:  getReasonPhrase(status),
-		}
+		return New(TypeInternal, "An internal server error has occurred.")
 	}
 }
 
-func (problem *Problem) WithReason(reason string) *Problem {
-	problem.Reason = reason
-	return problem
+var (
+	fieldMessagesMu sync.RWMutex
+	fieldMessages   = map[string]func(locale string, fieldError validator.FieldError) string{}
+)
+
+// RegisterFieldMessage overrides the error message produced for a validation tag
+func RegisterFieldMessage(tag string, message func(locale string, fieldError validator.FieldError) string) {
+	fieldMessagesMu.Lock()
+	defer fieldMessagesMu.Unlock()
+	fieldMessages[tag] = message
 }
 
-func getProcessValidationErrors(errs validator.ValidationErrors) map[string]string {
+func getProcessValidationErrors(locale string, errs validator.ValidationErrors) map[string]string {
 	errors := make(map[string]string)
 	for _, fieldError := range errs {
 		var errorMessage string
 		fieldName := humanize.Humanize(fieldError.Field(), humanize.SentenceCase)
-		fieldValue := fieldError.Value().(string)
+		fieldValue, _ := fieldError.Value().(string)
+		errorField := validationPointer(fieldError)
+
+		fieldMessagesMu.RLock()
+		fieldMessage, ok := fieldMessages[fieldError.Tag()]
+		fieldMessagesMu.RUnlock()
+
+		if ok {
+			errors[errorField] = fieldMessage(locale, fieldError)
+			continue
+		}
 
 		switch fieldError.Tag() {
 		case "required":
-			errorMessage = fmt.Sprintf("%v is required.", fieldName)
+			errorMessage = locales.Sprintf(locale, "%v is required.", fieldName)
 		case "email":
-			errorMessage = fmt.Sprintf("%v must be a valid email address.", fieldName)
+			errorMessage = locales.Sprintf(locale, "%v must be a valid email address.", fieldName)
 		case "gte":
-			errorMessage = fmt.Sprintf("%v must be greater than or equal to %v.", fieldName, fieldError.Param())
+			errorMessage = locales.Sprintf(locale, "%v must be greater than or equal to %v.", fieldName, fieldError.Param())
 		case "lte":
-			errorMessage = fmt.Sprintf("%v must be less than or equal to %v.", fieldName, fieldError.Param())
+			errorMessage = locales.Sprintf(locale, "%v must be less than or equal to %v.", fieldName, fieldError.Param())
 		case "password":
-			errorMessage = fmt.Sprintf("%v must be 6-256 characters long and include uppercase, lowercase, number, and special character.", fieldError.Field())
+			errorMessage = locales.Sprintf(locale, "%v does not meet the password requirements.", fieldName)
 		case "username":
 			if maybePhoneNumber(fieldValue) {
-				errorMessage = fmt.Sprintf("%v must be a valid phone number.", fieldName)
+				errorMessage = locales.Sprintf(locale, "%v must be a valid phone number.", fieldName)
 			} else {
-				errorMessage = fmt.Sprintf("%v must be a valid email address.", fieldName)
+				errorMessage = locales.Sprintf(locale, "%v must be a valid email address.", fieldName)
 			}
 		default:
-			errorMessage = fmt.Sprintf("%v is not valid.", fieldName)
+			errorMessage = locales.Sprintf(locale, "%v is not valid.", fieldName)
 		}
 
-		errorField := humanize.Camelize(fieldError.Field())
 		errors[errorField] = errorMessage
 	}
 	return errors
 }
 
+// validationPointer returns the JSON pointer of the field that failed
+// validation. The namespace "SignUpForm.Items[0].Name" becomes "/items/0/name".
+func validationPointer(fieldError validator.FieldError) string {
+	segments := strings.Split(fieldError.Namespace(), ".")
+	if len(segments) > 1 {
+		segments = segments[1:] // Leave out the name of the validated struct
+	}
+
+	tokens := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, embeddedPrefix) {
+			continue
+		}
+		name, rest, indexed := strings.Cut(segment, "[")
+		tokens = append(tokens, humanize.Camelize(name))
+		for indexed {
+			var index string
+			index, rest, _ = strings.Cut(rest, "]")
+			tokens = append(tokens, index)
+			_, rest, indexed = strings.Cut(rest, "[")
+		}
+	}
+	return pointer(tokens...)
+}
+
+// embeddedPrefix marks the embedded structs in validation namespaces
+const embeddedPrefix = "~"
+
+// FieldName names a struct field in validation errors after its JSON name, so
+// that messages and pointers use the names clients send. Embedded structs, whose
+// fields JSON moves into the parent, are marked to be left out of pointers.
+func FieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch {
+	case field.Anonymous && name == "":
+		return embeddedPrefix + field.Name
+	case name == "" || name == "-":
+		return field.Name
+	default:
+		return name
+	}
+}
+
+// fieldPointer turns a dot-separated field path into a JSON pointer. Paths that
+// already are JSON pointers are returned as they are.
+func fieldPointer(field string) string {
+	if strings.HasPrefix(field, "/") {
+		return field
+	}
+	return pointer(strings.Split(field, ".")...)
+}
+
+// pointer builds a JSON pointer from its reference tokens, as described in RFC 6901
+func pointer(tokens ...string) string {
+	var builder strings.Builder
+	for _, token := range tokens {
+		builder.WriteString("/")
+		builder.WriteString(pointerEscaper.Replace(token))
+	}
+	return builder.String()
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
 func maybePhoneNumber(input string) bool {
 	phonePattern := regexp.MustCompile(`^[-+0-9() ]+$`)
 	return phonePattern.MatchString(input)
 }
 
-func buildTypeURL(status int) string {
-	return fmt.Sprintf("https://httpstatuses.com/%d", status)
-}
-
 func getReasonPhrase(statusCode int) string {
 	if statusCode >= 100 && statusCode < 600 {
 		group := statusCode / 100
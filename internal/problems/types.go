@@ -0,0 +1,148 @@
+package problems
+
+import (
+	"net/http"
+	"slices"
+)
+
+// TypePath is the path the problem types are documented under. The type of a
+// problem is a URI reference to its documentation, such as "/problems/not-found".
+const TypePath = "/problems/"
+
+// Type describes a kind of problem. Its slug is stable and can be relied on by
+// clients, while titles and details are localized.
+type Type struct {
+	Slug        string `json:"slug"`
+	Status      int    `json:"status"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// URI returns the URI reference identifying the problem type
+func (problemType Type) URI() string {
+	if problemType.Slug == "" {
+		return "about:blank"
+	}
+	return TypePath + problemType.Slug
+}
+
+var (
+	TypeValidation = Type{
+		Slug:        "validation-error",
+		Status:      http.StatusBadRequest,
+		Title:       "Validation failed",
+		Description: "One or more fields of the request are not valid. The errors member maps the JSON pointer of each field to a message describing what is wrong with it.",
+	}
+	TypeMalformedRequest = Type{
+		Slug:        "malformed-request",
+		Status:      http.StatusBadRequest,
+		Title:       "Bad request",
+		Description: "The request could not be read, for example because its body is not valid JSON or a value has the wrong format.",
+	}
+	TypeUnauthorized = Type{
+		Slug:        "unauthorized",
+		Status:      http.StatusUnauthorized,
+		Title:       "Unauthorized",
+		Description: "The request is not authenticated, or its credentials are invalid or have expired. Sign in again or refresh the access token.",
+	}
+	TypeForbidden = Type{
+		Slug:        "forbidden",
+		Status:      http.StatusForbidden,
+		Title:       "Forbidden",
+		Description: "The authenticated user or api key is not allowed to perform the action.",
+	}
+	TypeNotFound = Type{
+		Slug:        "not-found",
+		Status:      http.StatusNotFound,
+		Title:       "Not found",
+		Description: "The requested resource does not exist or has been deleted.",
+	}
+	TypeConflict = Type{
+		Slug:        "conflict",
+		Status:      http.StatusConflict,
+		Title:       "Conflict",
+		Description: "The request conflicts with the current state of the resource, such as a duplicate name or records that still depend on it.",
+	}
+	TypeIdempotencyKeyReused = Type{
+		Slug:        "idempotency-key-reused",
+		Status:      http.StatusUnprocessableEntity,
+		Title:       "Idempotency key reused",
+		Description: "The Idempotency-Key header names a key that was already used for a request with another method, path or body. Use a new key for every distinct request.",
+	}
+	TypePreconditionFailed = Type{
+		Slug:        "precondition-failed",
+		Status:      http.StatusPreconditionFailed,
+		Title:       "Precondition failed",
+		Description: "The resource was changed since the version named in the If-Match header was read. The current member holds the current representation, so the changes can be merged and sent again with its version.",
+	}
+	TypeTooManyRequests = Type{
+		Slug:        "too-many-requests",
+		Status:      http.StatusTooManyRequests,
+		Title:       "Too many requests",
+		Description: "A rate limit was exceeded. The Retry-After header tells how many seconds to wait before trying again.",
+	}
+	TypeClientClosedRequest = Type{
+		Slug:        "client-closed-request",
+		Status:      StatusClientClosedRequest,
+		Title:       "Client closed request",
+		Description: "The client went away before the request completed. The response is only recorded in the logs.",
+	}
+	TypeInternal = Type{
+		Slug:        "internal-error",
+		Status:      http.StatusInternalServerError,
+		Title:       "Internal server error",
+		Description: "An unexpected error occurred. Quote the instance and trace id of the problem when reporting it.",
+	}
+	TypeUnavailable = Type{
+		Slug:        "unavailable",
+		Status:      http.StatusServiceUnavailable,
+		Title:       "Service unavailable",
+		Description: "A dependency of the api, such as the database, is temporarily unavailable. The request can be retried.",
+	}
+	TypeTimeout = Type{
+		Slug:        "timeout",
+		Status:      http.StatusGatewayTimeout,
+		Title:       "Gateway timeout",
+		Description: "The request took longer than its deadline. The request can be retried, with narrower filters for reports.",
+	}
+)
+
+// Types is the catalogue of the documented problem types
+var Types = []Type{
+	TypeValidation,
+	TypeMalformedRequest,
+	TypeUnauthorized,
+	TypeForbidden,
+	TypeNotFound,
+	TypeConflict,
+	TypeIdempotencyKeyReused,
+	TypePreconditionFailed,
+	TypeTooManyRequests,
+	TypeClientClosedRequest,
+	TypeInternal,
+	TypeUnavailable,
+	TypeTimeout,
+}
+
+// TypeBySlug returns the documented problem type with the given slug
+func TypeBySlug(slug string) (Type, bool) {
+	index := slices.IndexFunc(Types, func(problemType Type) bool { return problemType.Slug == slug })
+	if index < 0 {
+		return Type{}, false
+	}
+	return Types[index], true
+}
+
+// typeForStatus returns the problem type used for a status. Statuses without
+// a documented type use "about:blank" and the reason phrase as title.
+func typeForStatus(status int) Type {
+	if status == http.StatusBadRequest {
+		return TypeMalformedRequest
+	}
+
+	index := slices.IndexFunc(Types, func(problemType Type) bool { return problemType.Status == status })
+	if index < 0 {
+		return Type{Status: status, Title: getReasonPhrase(status)}
+	}
+	return Types[index]
+}
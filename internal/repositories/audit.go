@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prince272/konabra/internal/builds"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/pkg/period"
+	"go.uber.org/zap"
+)
+
+type AuditRepository struct {
+	defaultDB *builds.DefaultDB
+	logger    *zap.Logger
+}
+
+type AuditEventFilter struct {
+	period.DateRange
+	Order      string `json:"order" form:"order"` // "asc" or "desc"
+	ActorId    string `json:"actorId" form:"actorId"`
+	Action     string `json:"action" form:"action"`
+	TargetType string `json:"targetType" form:"targetType"`
+	TargetId   string `json:"targetId" form:"targetId"`
+	IpAddress  string `json:"ipAddress" form:"ipAddress"`
+}
+
+type AuditEventPaginatedFilter struct {
+	AuditEventFilter
+	Offset int `json:"offset" form:"offset"`
+	Limit  int `json:"limit" form:"limit"`
+}
+
+func NewAuditRepository(defaultDB *builds.DefaultDB, logger *zap.Logger) *AuditRepository {
+	return &AuditRepository{defaultDB, logger}
+}
+
+// CreateAuditEvent appends an event to the audit log. Audit events are never updated or deleted.
+func (repository *AuditRepository) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	event.CreatedAt = time.Now()
+	return translateError(repository.defaultDB.WithContext(ctx).Create(event).Error)
+}
+
+func (repository *AuditRepository) GetPaginatedAuditEvents(ctx context.Context, filter AuditEventPaginatedFilter) (items []models.AuditEvent, count int64, err error) {
+	query := repository.defaultDB.WithContext(ctx).Model(&models.AuditEvent{})
+
+	if filter.ActorId != "" {
+		query = query.Where("actor_id = ?", filter.ActorId)
+	}
+
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+
+	if filter.TargetId != "" {
+		query = query.Where("target_id = ?", filter.TargetId)
+	}
+
+	if filter.IpAddress != "" {
+		query = query.Where("ip_address = ?", filter.IpAddress)
+	}
+
+	if !filter.StartDate.IsZero() {
+		query = query.Where("created_at >= ?", filter.StartDate)
+	}
+
+	if !filter.EndDate.IsZero() {
+		query = query.Where("created_at <= ?", filter.EndDate)
+	}
+
+	sortOrder := "DESC"
+	if strings.ToLower(filter.Order) == "asc" {
+		sortOrder = "ASC"
+	}
+
+	query = query.Order(fmt.Sprintf("created_at %s", sortOrder))
+
+	if countResult := query.Count(&count); countResult.Error != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", translateError(countResult.Error))
+	}
+
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+
+	query = query.Offset(filter.Offset).Limit(filter.Limit)
+
+	if result := query.Find(&items); result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to fetch audit events: %w", translateError(result.Error))
+	}
+
+	return items, count, nil
+}
+
+// GetSecurityActivity returns the most recent security events performed by or on a user
+func (repository *AuditRepository) GetSecurityActivity(ctx context.Context, userId string, limit int) ([]models.AuditEvent, error) {
+	var items []models.AuditEvent
+	result := repository.defaultDB.WithContext(ctx).Model(&models.AuditEvent{}).
+		Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userId, models.AuditTargetUser, userId).
+		Where("action IN ?", models.AuditSecurityActions).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch security activity: %w", translateError(result.Error))
+	}
+
+	return items, nil
+}
+
+func (repository *AuditRepository) GetAuditEventsByUserId(ctx context.Context, userId string) ([]models.AuditEvent, error) {
+	var items []models.AuditEvent
+	result := repository.defaultDB.WithContext(ctx).Model(&models.AuditEvent{}).
+		Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userId, models.AuditTargetUser, userId).
+		Order("created_at DESC").
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch audit events by user: %w", translateError(result.Error))
+	}
+
+	return items, nil
+}
+
+// AnonymizeAuditEventsByUserId removes the personal data of an erased user from the
+// audit log. This is the only case where existing audit events are modified.
+func (repository *AuditRepository) AnonymizeAuditEventsByUserId(ctx context.Context, userId string) error {
+	result := repository.defaultDB.WithContext(ctx).Model(&models.AuditEvent{}).
+		Where("actor_id = ? OR (target_type = ? AND target_id = ?)", userId, models.AuditTargetUser, userId).
+		Updates(map[string]any{"ip_address": "", "user_agent": "", "changes": "{}"})
+	if result.Error != nil {
+		return fmt.Errorf("failed to anonymize audit events: %w", translateError(result.Error))
+	}
+	return nil
+}
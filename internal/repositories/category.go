@@ -1,7 +1,8 @@
 package repositories
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -20,15 +21,29 @@ type CategoryRepository struct {
 
 type CategoryFilter struct {
 	period.DateRange
-	Sort   string `json:"sort" form:"sort"`
-	Order  string `json:"order" form:"order"` // "asc" or "desc"
-	Search string `json:"search" form:"search"`
+	Sort            string `json:"sort" form:"sort"`
+	Order           string `json:"order" form:"order"` // "asc" or "desc"
+	Search          string `json:"search" form:"search"`
+	ParentId        string `json:"parentId" form:"parentId"`
+	IncludeArchived bool   `json:"includeArchived" form:"includeArchived"`
 }
 
 type CategoryPaginatedFilter struct {
 	CategoryFilter
-	Offset int `json:"offset" form:"offset"`
-	Limit  int `json:"limit" form:"limit"`
+	Page
+}
+
+// categorySort lists the keys categories can be sorted by
+var categorySort = listSort[models.Category]{
+	keys: map[string]sortKey[models.Category]{
+		"name":      {"name", func(category *models.Category) any { return category.Name }},
+		"createdAt": {"created_at", func(category *models.Category) any { return category.CreatedAt }},
+		"updatedAt": {"updated_at", func(category *models.Category) any { return category.UpdatedAt }},
+		"order":     {"\"order\"", func(category *models.Category) any { return category.Order }}, // quoted to avoid reserved keyword issues
+	},
+	defaultKey:   "createdAt",
+	defaultOrder: "asc",
+	id:           func(category *models.Category) string { return category.Id },
 }
 
 type CategoryStatistics struct {
@@ -47,147 +62,169 @@ func NewCategoryRepository(defaultDB *builds.DefaultDB, logger *zap.Logger) *Cat
 	return &CategoryRepository{defaultDB, logger}
 }
 
-func (repository *CategoryRepository) CreateCategory(category *models.Category) error {
+func (repository *CategoryRepository) CreateCategory(ctx context.Context, category *models.Category) error {
 	category.CreatedAt = time.Now()
 	category.UpdatedAt = time.Now()
-	result := repository.defaultDB.Create(category)
+	category.Version = 1
+	result := repository.defaultDB.WithContext(ctx).Create(category)
 	if result.Error != nil {
-		return result.Error
+		return translateError(result.Error)
 	}
 	return nil
 }
 
-func (repository *CategoryRepository) UpdateCategory(category *models.Category) error {
+func (repository *CategoryRepository) UpdateCategory(ctx context.Context, category *models.Category) error {
 	category.UpdatedAt = time.Now()
-	result := repository.defaultDB.Save(category)
-	if result.Error != nil {
-		return result.Error
-	}
-	return nil
+	return saveVersion(repository.defaultDB.WithContext(ctx), category, &category.Version)
 }
 
-func (repository *CategoryRepository) DeleteCategory(category *models.Category) error {
-	result := repository.defaultDB.Delete(category)
+func (repository *CategoryRepository) DeleteCategory(ctx context.Context, category *models.Category) error {
+	result := repository.defaultDB.WithContext(ctx).Delete(category)
 	if result.Error != nil {
-		return result.Error
+		return translateError(result.Error)
 	}
 	return nil
 }
 
-func (repository *CategoryRepository) CategoryNameExists(name string) bool {
+func (repository *CategoryRepository) CategoryNameExists(ctx context.Context, name string) (bool, error) {
 	var count int64
-	result := repository.defaultDB.Model(&models.Category{}).
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Category{}).
 		Where("LOWER(name) = LOWER(?)", name).
 		Count(&count)
 
 	if result.Error != nil {
-		panic(fmt.Errorf("failed to check if category name exists: %w", result.Error))
+		return false, fmt.Errorf("failed to check if category name exists: %w", translateError(result.Error))
 	}
 
-	return count > 0
+	return count > 0, nil
 }
 
-func (repository *CategoryRepository) CategorySlugExists(name string) bool {
+func (repository *CategoryRepository) CategorySlugExists(ctx context.Context, name string) (bool, error) {
 	var count int64
-	result := repository.defaultDB.Model(&models.Category{}).
-		Where("LOWER(short_name) = LOWER(?)", name).
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Category{}).
+		Where("LOWER(slug) = LOWER(?)", name).
 		Count(&count)
 
 	if result.Error != nil {
-		panic(fmt.Errorf("failed to check if category name exists: %w", result.Error))
+		return false, fmt.Errorf("failed to check if category slug exists: %w", translateError(result.Error))
 	}
 
-	return count > 0
+	return count > 0, nil
 }
 
-func (repository *CategoryRepository) GetCategoryById(id string) *models.Category {
+func (repository *CategoryRepository) GetCategoryById(ctx context.Context, id string) (*models.Category, error) {
 	category := &models.Category{}
-	result := repository.defaultDB.Model(&models.Category{}).
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Category{}).
 		Where("id = ?", id).
 		First(category)
 
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil
-		}
-
-		panic(fmt.Errorf("failed to find category by id: %w", result.Error))
+		return nil, fmt.Errorf("failed to find category by id: %w", translateError(result.Error))
 	}
 
-	return category
+	return category, nil
 }
 
-func (repository *CategoryRepository) GetPaginatedCategories(filter CategoryPaginatedFilter) (items []models.Category, count int64) {
-	query := repository.defaultDB.Model(&models.Category{})
+func (repository *CategoryRepository) GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	category := &models.Category{}
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Category{}).
+		Where("LOWER(slug) = LOWER(?)", slug).
+		First(category)
 
-	// Apply search filter
-	if filter.Search != "" {
-		query = query.Where("LOWER(name) LIKE LOWER(?)", "%"+filter.Search+"%")
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find category by slug: %w", translateError(result.Error))
 	}
 
-	if !filter.StartDate.IsZero() {
-		query = query.Where("created_at >= ?", filter.StartDate)
-	}
+	return category, nil
+}
 
-	if !filter.EndDate.IsZero() {
-		query = query.Where("created_at <= ?", filter.EndDate)
+// GetCategoryByKeyword returns the category, not archived, that files SMS reports
+// sent with the keyword. Keywords are stored in upper case.
+func (repository *CategoryRepository) GetCategoryByKeyword(ctx context.Context, keyword string) (*models.Category, error) {
+	match, err := json.Marshal([]string{strings.ToUpper(keyword)})
+	if err != nil {
+		return nil, err
 	}
 
-	allowedSortFields := map[string]string{
-		"name":      "name",
-		"createdAt": "created_at",
-		"updatedAt": "updated_at",
-		"order":     "\"order\"", // quoted to avoid reserved keyword issues
+	category := &models.Category{}
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Category{}).
+		Where("keywords @> ?::jsonb AND archived_at IS NULL", string(match)).
+		First(category)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find category by keyword: %w", translateError(result.Error))
 	}
 
-	allowedOrders := map[string]string{
-		"asc":  "ASC",
-		"desc": "DESC",
+	return category, nil
+}
+
+func (repository *CategoryRepository) CategoryHasChildren(ctx context.Context, id string) (bool, error) {
+	var count int64
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Category{}).
+		Where("parent_id = ?", id).
+		Count(&count)
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to check if category has children: %w", translateError(result.Error))
 	}
 
-	// Default sort settings
-	sortField := "\"created_at\""
-	sortOrder := "ASC"
+	return count > 0, nil
+}
+
+func (repository *CategoryRepository) GetCategories(ctx context.Context, includeArchived bool) ([]models.Category, error) {
+	var items []models.Category
+	query := repository.defaultDB.WithContext(ctx).Model(&models.Category{})
 
-	// Use camelCase filter.Sort and map to actual DB column
-	if dbField, ok := allowedSortFields[filter.Sort]; ok {
-		sortField = dbField
+	if !includeArchived {
+		query = query.Where("archived_at IS NULL")
 	}
 
-	if val, ok := allowedOrders[strings.ToLower(filter.Order)]; ok {
-		sortOrder = val
+	result := query.
+		Order("\"order\" ASC, name ASC").
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch categories: %w", translateError(result.Error))
 	}
 
-	// Apply ordering
-	query = query.Order(fmt.Sprintf("%s %s", sortField, sortOrder))
+	return items, nil
+}
+
+func (repository *CategoryRepository) GetPaginatedCategories(ctx context.Context, filter CategoryPaginatedFilter) ([]models.Category, PageResult, error) {
+	query := repository.defaultDB.WithContext(ctx).Model(&models.Category{})
+
+	// Apply search filter
+	if filter.Search != "" {
+		query = query.Where("LOWER(name) LIKE LOWER(?)", "%"+filter.Search+"%")
+	}
 
-	// Count total items
-	if countResult := query.Count(&count); countResult.Error != nil {
-		panic(fmt.Errorf("failed to count total items: %w", countResult.Error))
+	if filter.ParentId != "" {
+		query = query.Where("parent_id = ?", filter.ParentId)
 	}
 
-	// Normalize pagination input
-	if filter.Offset < 0 {
-		filter.Offset = 0
+	if !filter.IncludeArchived {
+		query = query.Where("archived_at IS NULL")
 	}
 
-	if filter.Limit <= 0 || filter.Limit > 100 {
-		filter.Limit = 20
+	if !filter.StartDate.IsZero() {
+		query = query.Where("created_at >= ?", filter.StartDate)
 	}
 
-	query = query.Offset(filter.Offset).Limit(filter.Limit)
+	if !filter.EndDate.IsZero() {
+		query = query.Where("created_at <= ?", filter.EndDate)
+	}
 
-	// Fetch filtered items
-	if result := query.Find(&items); result.Error != nil {
-		panic(fmt.Errorf("failed to fetch filtered items: %w", result.Error))
+	items, page, err := paginate(query, filter.Page, categorySort, filter.Sort, filter.Order)
+	if err != nil {
+		return nil, PageResult{}, fmt.Errorf("failed to fetch categories: %w", err)
 	}
 
-	return items, count
+	return items, page, nil
 }
 
-func (repository *CategoryRepository) GetCategoryStatistics(filter CategoryStatisticsFilter) (*CategoryStatistics, error) {
+func (repository *CategoryRepository) GetCategoryStatistics(ctx context.Context, filter CategoryStatisticsFilter) (*CategoryStatistics, error) {
 	countCategories := func(startDate, endDate time.Time) (int64, error) {
-		query := repository.defaultDB.Model(&models.Category{})
+		query := repository.defaultDB.WithContext(ctx).Model(&models.Category{})
 
 		if !startDate.IsZero() {
 			query = query.Where("created_at >= ?", startDate)
@@ -198,21 +235,121 @@ func (repository *CategoryRepository) GetCategoryStatistics(filter CategoryStati
 		}
 		var count int64
 		if result := query.Count(&count); result.Error != nil {
-			return 0, fmt.Errorf("failed to count categories: %w", result.Error)
+			return 0, fmt.Errorf("failed to count categories: %w", translateError(result.Error))
 		}
 		return count, nil
 	}
 
-	totalCategories := CalculateTrend(filter.StartDate, filter.EndDate, func(startDate, endDate time.Time) int64 {
-		count, err := countCategories(startDate, endDate)
-		if err != nil {
-			repository.logger.Error("Failed to count categories", zap.Error(err))
-			return 0
-		}
-		return count
+	totalCategories, err := CalculateTrend(filter.StartDate, filter.EndDate, func(startDate, endDate time.Time) (int64, error) {
+		return countCategories(startDate, endDate)
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &CategoryStatistics{
 		TotalCategories: totalCategories,
 	}, nil
 }
+
+// SetCategoryArchivedAt archives (or, with a nil time, restores) a category together with its subcategories
+func (repository *CategoryRepository) SetCategoryArchivedAt(ctx context.Context, category *models.Category, archivedAt *time.Time) error {
+	return repository.defaultDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		category.ArchivedAt = archivedAt
+		category.UpdatedAt = time.Now()
+
+		if err := saveVersion(tx, category, &category.Version); err != nil {
+			return fmt.Errorf("failed to update category: %w", translateError(err))
+		}
+
+		if err := tx.Model(&models.Category{}).
+			Where("parent_id = ?", category.Id).
+			Updates(map[string]any{"archived_at": archivedAt, "updated_at": category.UpdatedAt, "version": nextVersion}).Error; err != nil {
+			return fmt.Errorf("failed to update subcategories: %w", translateError(err))
+		}
+
+		return nil
+	})
+}
+
+// UpdateCategoryOrders sets the order of several categories at once
+func (repository *CategoryRepository) UpdateCategoryOrders(ctx context.Context, orders map[string]int64) error {
+	return repository.defaultDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		for id, order := range orders {
+			if err := tx.Model(&models.Category{}).
+				Where("id = ?", id).
+				Updates(map[string]any{"order": order, "updated_at": now, "version": nextVersion}).Error; err != nil {
+				return fmt.Errorf("failed to update category order: %w", translateError(err))
+			}
+		}
+		return nil
+	})
+}
+
+// GetCategoryChanges returns the categories created, updated or deleted since the
+// given time. Deleted categories are only returned when a time is given.
+func (repository *CategoryRepository) GetCategoryChanges(ctx context.Context, since time.Time) ([]models.Category, error) {
+	query := repository.defaultDB.WithContext(ctx).Unscoped().Model(&models.Category{})
+
+	if since.IsZero() {
+		query = query.Where("deleted_at IS NULL")
+	} else {
+		query = query.Where("GREATEST(updated_at, COALESCE(deleted_at, updated_at)) >= ?", since)
+	}
+
+	var items []models.Category
+	if err := query.Order("\"order\" ASC, name ASC").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch category changes: %w", translateError(err))
+	}
+
+	return items, nil
+}
+
+func (repository *CategoryRepository) GetCategoriesByIds(ctx context.Context, ids []string) ([]models.Category, error) {
+	var items []models.Category
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Category{}).
+		Where("id IN ?", ids).
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch categories by ids: %w", translateError(result.Error))
+	}
+
+	return items, nil
+}
+
+// CountCategoryIncidents counts the incidents filed under a category, including soft-deleted ones
+func (repository *CategoryRepository) CountCategoryIncidents(ctx context.Context, id string) (int64, error) {
+	var count int64
+	result := repository.defaultDB.WithContext(ctx).Unscoped().Model(&models.Incident{}).
+		Where("category_id = ?", id).
+		Count(&count)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count category incidents: %w", translateError(result.Error))
+	}
+
+	return count, nil
+}
+
+// DeleteCategoryMovingIncidents moves every incident of a category, including soft-deleted ones,
+// to another category and deletes the category in a single transaction
+func (repository *CategoryRepository) DeleteCategoryMovingIncidents(ctx context.Context, category *models.Category, targetId string) (int64, error) {
+	var moved int64
+	err := repository.defaultDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.Incident{}).
+			Where("category_id = ?", category.Id).
+			Updates(map[string]any{"category_id": targetId, "updated_at": time.Now(), "version": nextVersion})
+		if result.Error != nil {
+			return fmt.Errorf("failed to move incidents: %w", translateError(result.Error))
+		}
+		moved = result.RowsAffected
+
+		if err := tx.Delete(category).Error; err != nil {
+			return fmt.Errorf("failed to delete category: %w", translateError(err))
+		}
+		return nil
+	})
+	return moved, err
+}
@@ -14,14 +14,21 @@ type Trend struct {
 	IsDecrease    bool      `json:"isDecrease"`    // True if new count is less than old count
 }
 
-func CalculateTrend(startDate, endDate time.Time, countFunc func(time.Time, time.Time) int64) Trend {
+func CalculateTrend(startDate, endDate time.Time, countFunc func(time.Time, time.Time) (int64, error)) (Trend, error) {
 	duration := endDate.Sub(startDate)
 
 	oldEndDate := startDate.Add(-time.Second)
 	oldStartDate := oldEndDate.Add(-duration)
 
-	oldCount := countFunc(oldStartDate, oldEndDate)
-	newCount := countFunc(startDate, endDate)
+	oldCount, err := countFunc(oldStartDate, oldEndDate)
+	if err != nil {
+		return Trend{}, err
+	}
+
+	newCount, err := countFunc(startDate, endDate)
+	if err != nil {
+		return Trend{}, err
+	}
 
 	var percentChange float64
 	if oldCount != 0 {
@@ -38,5 +45,5 @@ func CalculateTrend(startDate, endDate time.Time, countFunc func(time.Time, time
 		PercentChange: percentChange,
 		IsIncrease:    percentChange > 0,
 		IsDecrease:    percentChange < 0,
-	}
+	}, nil
 }
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prince272/konabra/internal/models"
+	"gorm.io/gorm"
+)
+
+// Postgres error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation      = "23505"
+	pgForeignKeyViolation  = "23503"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+	pgTooManyConnections   = "53300"
+	pgQueryCanceled        = "57014"
+	pgAdminShutdown        = "57P01"
+	pgCrashShutdown        = "57P02"
+	pgCannotConnectNow     = "57P03"
+	pgConnectionException  = "08" // Class prefix
+)
+
+// translateError wraps a database error with the matching domain error from
+// the models package so that callers can tell what went wrong without
+// knowing about the database driver
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	// Already translated, for example by a repository method called from another one
+	if errors.Is(err, models.ErrNotFound) || errors.Is(err, models.ErrConflict) || errors.Is(err, models.ErrUnavailable) || errors.Is(err, models.ErrStale) {
+		return err
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %w", models.ErrNotFound, err)
+	}
+
+	// Cancellation and deadlines are reported as they are
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == pgUniqueViolation, pgErr.Code == pgForeignKeyViolation:
+			return fmt.Errorf("%w: %w", models.ErrConflict, err)
+		case pgErr.Code == pgQueryCanceled:
+			// Raised when the server side statement timeout is reached
+			return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+		case pgErr.Code == pgSerializationFailure, pgErr.Code == pgDeadlockDetected,
+			pgErr.Code == pgTooManyConnections, pgErr.Code == pgAdminShutdown,
+			pgErr.Code == pgCrashShutdown, pgErr.Code == pgCannotConnectNow,
+			strings.HasPrefix(pgErr.Code, pgConnectionException):
+			return fmt.Errorf("%w: %w", models.ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err) {
+		return fmt.Errorf("%w: %w", models.ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -1,6 +1,7 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -58,8 +59,20 @@ type RoleFilter struct {
 
 type RolePaginatedFilter struct {
 	RoleFilter
-	Offset int `json:"offset" form:"offset"`
-	Limit  int `json:"limit" form:"limit"`
+	Page
+}
+
+// roleSort lists the keys roles can be sorted by
+var roleSort = listSort[models.Role]{
+	keys: map[string]sortKey[models.Role]{
+		"name":      {"name", func(role *models.Role) any { return role.Name }},
+		"createdAt": {"created_at", func(role *models.Role) any { return role.CreatedAt }},
+		"updatedAt": {"updated_at", func(role *models.Role) any { return role.UpdatedAt }},
+		"order":     {"\"order\"", func(role *models.Role) any { return role.Order }}, // quoted to avoid reserved keyword issues
+	},
+	defaultKey:   "order",
+	defaultOrder: "asc",
+	id:           func(role *models.Role) string { return role.Id },
 }
 
 func NewIdentityRepository(logger *zap.Logger, defaultDB *builds.DefaultDB) *IdentityRepository {
@@ -69,27 +82,27 @@ func NewIdentityRepository(logger *zap.Logger, defaultDB *builds.DefaultDB) *Ide
 	}
 }
 
-func (repository *IdentityRepository) CreateUser(user *models.User) error {
+func (repository *IdentityRepository) CreateUser(ctx context.Context, user *models.User) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
-	result := repository.defaultDB.Create(user)
+	result := repository.defaultDB.WithContext(ctx).Create(user)
 	if result.Error != nil {
-		return result.Error
+		return translateError(result.Error)
 	}
 	return nil
 }
 
-func (repository *IdentityRepository) UpdateUser(user *models.User) error {
+func (repository *IdentityRepository) UpdateUser(ctx context.Context, user *models.User) error {
 	user.UpdatedAt = time.Now()
-	result := repository.defaultDB.Save(user)
+	result := repository.defaultDB.WithContext(ctx).Save(user)
 	if result.Error != nil {
-		return result.Error
+		return translateError(result.Error)
 	}
 	return nil
 }
 
-func (repository *IdentityRepository) DeleteUser(user *models.User) error {
-	result := repository.defaultDB.Delete(user)
+func (repository *IdentityRepository) DeleteUser(ctx context.Context, user *models.User) error {
+	result := repository.defaultDB.WithContext(ctx).Delete(user)
 
 	if result.Error != nil {
 
@@ -97,120 +110,109 @@ func (repository *IdentityRepository) DeleteUser(user *models.User) error {
 			return nil
 		}
 
-		return fmt.Errorf("failed to delete user: %w", result.Error)
+		return fmt.Errorf("failed to delete user: %w", translateError(result.Error))
 	}
 
 	return nil
 }
 
-func (repository *IdentityRepository) CreateRole(role *models.Role) error {
+func (repository *IdentityRepository) CreateRole(ctx context.Context, role *models.Role) error {
 	role.CreatedAt = time.Now()
 	role.UpdatedAt = time.Now()
-	result := repository.defaultDB.Create(role)
+	role.Version = 1
+	result := repository.defaultDB.WithContext(ctx).Create(role)
 	if result.Error != nil {
-		return result.Error
+		return translateError(result.Error)
 	}
 	return nil
 }
 
-func (repository *IdentityRepository) UpdateRole(role *models.Role) error {
+func (repository *IdentityRepository) UpdateRole(ctx context.Context, role *models.Role) error {
 	role.UpdatedAt = time.Now()
-	result := repository.defaultDB.Save(role)
-	if result.Error != nil {
-		return result.Error
-	}
-	return nil
+	return saveVersion(repository.defaultDB.WithContext(ctx), role, &role.Version)
 }
 
-func (repository *IdentityRepository) DeleteRole(role *models.Role) error {
-	result := repository.defaultDB.Delete(role)
+func (repository *IdentityRepository) DeleteRole(ctx context.Context, role *models.Role) error {
+	result := repository.defaultDB.WithContext(ctx).Delete(role)
 	if result.Error != nil {
-		return result.Error
+		return translateError(result.Error)
 	}
 	return nil
 }
 
-func (repository *IdentityRepository) GetUserByUsername(username string) *models.User {
+func (repository *IdentityRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	user := &models.User{}
 
-	result := repository.defaultDB.Model(&models.User{}).Preload("UserRoles").
+	result := repository.defaultDB.WithContext(ctx).Model(&models.User{}).Preload("UserRoles").
 		Where("LOWER(email) = LOWER(?) OR LOWER(phone_number) = LOWER(?)", username, username).
 		First(user)
 
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil
-		}
-
-		panic(fmt.Errorf("failed to find user by username: %w", result.Error))
+		return nil, fmt.Errorf("failed to find user by username: %w", translateError(result.Error))
 	}
 
-	return user
+	return user, nil
 }
 
-func (repository *IdentityRepository) GetUserById(id string) *models.User {
+func (repository *IdentityRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
 	user := &models.User{}
-	result := repository.defaultDB.Model(&models.User{}).Preload("UserRoles").
+	result := repository.defaultDB.WithContext(ctx).Model(&models.User{}).Preload("UserRoles").
 		Where("id = ?", id).
 		First(user)
 
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil
-		}
-
-		panic(fmt.Errorf("failed to find user by id: %w", result.Error))
+		return nil, fmt.Errorf("failed to find user by id: %w", translateError(result.Error))
 	}
 
-	return user
+	return user, nil
 }
 
-func (repository *IdentityRepository) UsernameExists(username string) bool {
+func (repository *IdentityRepository) UsernameExists(ctx context.Context, username string) (bool, error) {
 	var count int64
-	result := repository.defaultDB.Model(&models.User{}).
+	result := repository.defaultDB.WithContext(ctx).Model(&models.User{}).
 		Where("LOWER(email) = LOWER(?) OR LOWER(phone_number) = LOWER(?)", username, username).
 		Count(&count)
 
 	if result.Error != nil {
-		panic(fmt.Errorf("failed to check if username exists: %w", result.Error))
+		return false, fmt.Errorf("failed to check if username exists: %w", translateError(result.Error))
 	}
 
-	return count > 0
+	return count > 0, nil
 }
 
-func (repository *IdentityRepository) UserNameExists(name string) bool {
+func (repository *IdentityRepository) UserNameExists(ctx context.Context, name string) (bool, error) {
 	var count int64
-	result := repository.defaultDB.Model(&models.User{}).
+	result := repository.defaultDB.WithContext(ctx).Model(&models.User{}).
 		Where("LOWER(user_name) = LOWER(?)", name).
 		Count(&count)
 
 	if result.Error != nil {
-		panic(fmt.Errorf("failed to check if name exists: %w", result.Error))
+		return false, fmt.Errorf("failed to check if name exists: %w", translateError(result.Error))
 	}
 
-	return count > 0
+	return count > 0, nil
 }
 
-func (repository *IdentityRepository) RoleNameExists(name string) bool {
+func (repository *IdentityRepository) RoleNameExists(ctx context.Context, name string) (bool, error) {
 	var count int64
-	result := repository.defaultDB.Model(&models.Role{}).
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Role{}).
 		Where("LOWER(name) = LOWER(?)", name).
 		Count(&count)
 
 	if result.Error != nil {
-		panic(fmt.Errorf("failed to check if name exists: %w", result.Error))
+		return false, fmt.Errorf("failed to check if name exists: %w", translateError(result.Error))
 	}
 
-	return count > 0
+	return count > 0, nil
 }
 
-func (repository *IdentityRepository) EnsureRoleExists(roleNames ...string) ([]*models.Role, error) {
+func (repository *IdentityRepository) EnsureRoleExists(ctx context.Context, roleNames ...string) ([]*models.Role, error) {
 	var resultRoles []*models.Role
 
 	for _, roleName := range roleNames {
 		var existingRole *models.Role
 		// Check if the role already exists
-		if err := repository.defaultDB.
+		if err := repository.defaultDB.WithContext(ctx).
 			Where("name = ?", roleName).
 			First(&existingRole).Error; err == nil {
 			// Role already exists, add to result
@@ -218,7 +220,7 @@ func (repository *IdentityRepository) EnsureRoleExists(roleNames ...string) ([]*
 			continue
 		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 			// An actual error occurred (not just "not found")
-			return nil, err
+			return nil, translateError(err)
 		}
 
 		// Role does not exist, so create it
@@ -226,9 +228,9 @@ func (repository *IdentityRepository) EnsureRoleExists(roleNames ...string) ([]*
 			Id:   uuid.New().String(),
 			Name: roleName,
 		}
-		result := repository.defaultDB.Create(&role)
+		result := repository.defaultDB.WithContext(ctx).Create(&role)
 		if result.Error != nil {
-			return nil, result.Error
+			return nil, translateError(result.Error)
 		}
 		// Add the newly created role to the result
 		resultRoles = append(resultRoles, role)
@@ -236,17 +238,17 @@ func (repository *IdentityRepository) EnsureRoleExists(roleNames ...string) ([]*
 	return resultRoles, nil
 }
 
-func (repository *IdentityRepository) AddUserToRoles(user *models.User, roleNames ...string) error {
-	roles, err := repository.EnsureRoleExists(roleNames...)
+func (repository *IdentityRepository) AddUserToRoles(ctx context.Context, user *models.User, roleNames ...string) error {
+	roles, err := repository.EnsureRoleExists(ctx, roleNames...)
 	if err != nil {
-		return fmt.Errorf("failed to ensure roles exist: %w", err)
+		return fmt.Errorf("failed to ensure roles exist: %w", translateError(err))
 	}
 
-	if err := repository.defaultDB.
+	if err := repository.defaultDB.WithContext(ctx).
 		Model(user).
 		Association("UserRoles").
 		Find(&user.UserRoles); err != nil {
-		return fmt.Errorf("failed to load existing roles: %w", err)
+		return fmt.Errorf("failed to load existing roles: %w", translateError(err))
 	}
 
 	roleMap := make(map[string]*models.Role)
@@ -262,15 +264,15 @@ func (repository *IdentityRepository) AddUserToRoles(user *models.User, roleName
 		distinctRoles = append(distinctRoles, *role)
 	}
 
-	if err := repository.defaultDB.Model(user).Association("UserRoles").Replace(distinctRoles); err != nil {
-		return fmt.Errorf("failed to associate roles with user: %w", err)
+	if err := repository.defaultDB.WithContext(ctx).Model(user).Association("UserRoles").Replace(distinctRoles); err != nil {
+		return fmt.Errorf("failed to associate roles with user: %w", translateError(err))
 	}
 
 	return nil
 }
 
-func (repository *IdentityRepository) GetPaginatedUsers(filter UserPaginatedFilter) (items []models.User, count int64) {
-	query := repository.defaultDB.Model(&models.User{})
+func (repository *IdentityRepository) GetPaginatedUsers(ctx context.Context, filter UserPaginatedFilter) (items []models.User, count int64, err error) {
+	query := repository.defaultDB.WithContext(ctx).Model(&models.User{})
 
 	// Apply search filter
 	if filter.Search != "" {
@@ -331,7 +333,7 @@ func (repository *IdentityRepository) GetPaginatedUsers(filter UserPaginatedFilt
 
 	// Count total items
 	if countResult := query.Count(&count); countResult.Error != nil {
-		panic(fmt.Errorf("failed to count total items: %w", countResult.Error))
+		return nil, 0, fmt.Errorf("failed to count total items: %w", translateError(countResult.Error))
 	}
 
 	// Normalize pagination input
@@ -347,15 +349,15 @@ func (repository *IdentityRepository) GetPaginatedUsers(filter UserPaginatedFilt
 
 	// Fetch filtered items
 	if result := query.Find(&items); result.Error != nil {
-		panic(fmt.Errorf("failed to fetch filtered items: %w", result.Error))
+		return nil, 0, fmt.Errorf("failed to fetch filtered items: %w", translateError(result.Error))
 	}
 
-	return items, count
+	return items, count, nil
 }
 
-func (repository *IdentityRepository) GetUsersStatistics(dateRange period.DateRange) (*UserStatistics, error) {
+func (repository *IdentityRepository) GetUsersStatistics(ctx context.Context, dateRange period.DateRange) (*UserStatistics, error) {
 	countUsers := func(startDate, endDate time.Time) (int64, error) {
-		query := repository.defaultDB.Model(&models.User{})
+		query := repository.defaultDB.WithContext(ctx).Model(&models.User{})
 
 		if !startDate.IsZero() {
 			query = query.Where("created_at >= ?", startDate)
@@ -366,27 +368,42 @@ func (repository *IdentityRepository) GetUsersStatistics(dateRange period.DateRa
 		}
 		var count int64
 		if result := query.Count(&count); result.Error != nil {
-			return 0, fmt.Errorf("failed to count users: %w", result.Error)
+			return 0, fmt.Errorf("failed to count users: %w", translateError(result.Error))
 		}
 		return count, nil
 	}
 
-	totalUsers := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) int64 {
-		count, err := countUsers(startDate, endDate)
-		if err != nil {
-			repository.logger.Error("Failed to count users", zap.Error(err))
-			return 0
-		}
-		return count
+	totalUsers, err := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) (int64, error) {
+		return countUsers(startDate, endDate)
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &UserStatistics{
 		TotalUsers: totalUsers,
 	}, nil
 }
 
-func (repository *IdentityRepository) GetPaginatedRoles(filter RolePaginatedFilter) (items []models.Role, count int64) {
-	query := repository.defaultDB.Model(&models.Role{})
+func (repository *IdentityRepository) GetPaginatedRoles(ctx context.Context, filter RolePaginatedFilter) ([]models.Role, PageResult, error) {
+	query := repository.defaultDB.WithContext(ctx).Model(&models.Role{})
+
+	// Apply search filter
+	if filter.Search != "" {
+		query = query.Where("LOWER(name) LIKE LOWER(?)", "%"+filter.Search+"%")
+	}
+
+	items, page, err := paginate(query, filter.Page, roleSort, filter.Sort, filter.Order)
+	if err != nil {
+		return nil, PageResult{}, fmt.Errorf("failed to fetch roles: %w", err)
+	}
+
+	return items, page, nil
+}
+
+func (repository *IdentityRepository) GetRoles(ctx context.Context, filter RoleFilter) ([]models.Role, error) {
+	var items []models.Role
+	query := repository.defaultDB.WithContext(ctx).Model(&models.Role{})
 
 	// Apply search filter
 	if filter.Search != "" {
@@ -397,7 +414,7 @@ func (repository *IdentityRepository) GetPaginatedRoles(filter RolePaginatedFilt
 		"name":      "name",
 		"createdAt": "created_at",
 		"updatedAt": "updated_at",
-		"order":     "\"order\"", // quoted to avoid reserved keyword issues
+		"order":     "\"order\"",
 	}
 
 	allowedOrders := map[string]string{
@@ -409,7 +426,7 @@ func (repository *IdentityRepository) GetPaginatedRoles(filter RolePaginatedFilt
 	sortField := "\"order\""
 	sortOrder := "ASC"
 
-	// Use camelCase filter.Sort and map to actual DB column
+	// Map camelCase input to actual DB column
 	if dbField, ok := allowedSortFields[filter.Sort]; ok {
 		sortField = dbField
 	}
@@ -421,88 +438,207 @@ func (repository *IdentityRepository) GetPaginatedRoles(filter RolePaginatedFilt
 	// Apply ordering
 	query = query.Order(fmt.Sprintf("%s %s", sortField, sortOrder))
 
-	// Count total items
-	if countResult := query.Count(&count); countResult.Error != nil {
-		panic(fmt.Errorf("failed to count total items: %w", countResult.Error))
+	// Fetch filtered items
+	if result := query.Find(&items); result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch filtered items: %w", translateError(result.Error))
 	}
 
-	// Normalize pagination input
-	if filter.Offset < 0 {
-		filter.Offset = 0
+	return items, nil
+}
+
+func (repository *IdentityRepository) GetRoleById(ctx context.Context, id string) (*models.Role, error) {
+	role := &models.Role{}
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Role{}).
+		Where("id = ?", id).
+		First(role)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find role by id: %w", translateError(result.Error))
 	}
 
-	if filter.Limit <= 0 || filter.Limit > 100 {
-		filter.Limit = 20
+	return role, nil
+}
+
+func (repository *IdentityRepository) CreateApiKey(ctx context.Context, apiKey *models.ApiKey) error {
+	apiKey.CreatedAt = time.Now()
+	result := repository.defaultDB.WithContext(ctx).Create(apiKey)
+	if result.Error != nil {
+		return translateError(result.Error)
 	}
+	return nil
+}
 
-	query = query.Offset(filter.Offset).Limit(filter.Limit)
+func (repository *IdentityRepository) DeleteApiKey(ctx context.Context, apiKey *models.ApiKey) error {
+	result := repository.defaultDB.WithContext(ctx).Delete(apiKey)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	return nil
+}
 
-	// Fetch filtered items
-	if result := query.Find(&items); result.Error != nil {
-		panic(fmt.Errorf("failed to fetch filtered items: %w", result.Error))
+func (repository *IdentityRepository) DeleteApiKeysByUserId(ctx context.Context, userId string) error {
+	result := repository.defaultDB.WithContext(ctx).
+		Where("user_id = ?", userId).
+		Delete(&models.ApiKey{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete api keys: %w", translateError(result.Error))
+	}
+	return nil
+}
+
+func (repository *IdentityRepository) GetApiKeyById(ctx context.Context, userId, id string) (*models.ApiKey, error) {
+	apiKey := &models.ApiKey{}
+	result := repository.defaultDB.WithContext(ctx).Model(&models.ApiKey{}).
+		Where("id = ? AND user_id = ?", id, userId).
+		First(apiKey)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find api key by id: %w", translateError(result.Error))
 	}
 
-	return items, count
+	return apiKey, nil
 }
 
-func (repository *IdentityRepository) GetRoles(filter RoleFilter) []models.Role {
-	var items []models.Role
-	query := repository.defaultDB.Model(&models.Role{})
+func (repository *IdentityRepository) GetApiKeysByUserId(ctx context.Context, userId string) ([]models.ApiKey, error) {
+	var items []models.ApiKey
+	result := repository.defaultDB.WithContext(ctx).Model(&models.ApiKey{}).
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
+		Find(&items)
 
-	// Apply search filter
-	if filter.Search != "" {
-		query = query.Where("LOWER(name) LIKE LOWER(?)", "%"+filter.Search+"%")
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch api keys: %w", translateError(result.Error))
 	}
 
-	allowedSortFields := map[string]string{
-		"name":      "name",
-		"createdAt": "created_at",
-		"updatedAt": "updated_at",
-		"order":     "\"order\"",
+	return items, nil
+}
+
+func (repository *IdentityRepository) GetServiceAccounts(ctx context.Context) ([]models.User, error) {
+	var items []models.User
+	result := repository.defaultDB.WithContext(ctx).Model(&models.User{}).Preload("UserRoles").
+		Where("is_service_account = ?", true).
+		Order("created_at ASC").
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch service accounts: %w", translateError(result.Error))
 	}
 
-	allowedOrders := map[string]string{
-		"asc":  "ASC",
-		"desc": "DESC",
+	return items, nil
+}
+
+func (repository *IdentityRepository) GetServiceAccountById(ctx context.Context, id string) (*models.User, error) {
+	user := &models.User{}
+	result := repository.defaultDB.WithContext(ctx).Model(&models.User{}).Preload("UserRoles").
+		Where("id = ? AND is_service_account = ?", id, true).
+		First(user)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find service account by id: %w", translateError(result.Error))
 	}
 
-	// Default sort settings
-	sortField := "\"order\""
-	sortOrder := "ASC"
+	return user, nil
+}
 
-	// Map camelCase input to actual DB column
-	if dbField, ok := allowedSortFields[filter.Sort]; ok {
-		sortField = dbField
+func (repository *IdentityRepository) CreatePasswordHistory(ctx context.Context, history *models.PasswordHistory) error {
+	history.CreatedAt = time.Now()
+	result := repository.defaultDB.WithContext(ctx).Create(history)
+	if result.Error != nil {
+		return translateError(result.Error)
 	}
+	return nil
+}
 
-	if val, ok := allowedOrders[strings.ToLower(filter.Order)]; ok {
-		sortOrder = val
+func (repository *IdentityRepository) GetPasswordHistory(ctx context.Context, userId string, limit int) ([]models.PasswordHistory, error) {
+	var items []models.PasswordHistory
+	result := repository.defaultDB.WithContext(ctx).Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch password history: %w", translateError(result.Error))
 	}
 
-	// Apply ordering
-	query = query.Order(fmt.Sprintf("%s %s", sortField, sortOrder))
+	return items, nil
+}
 
-	// Fetch filtered items
-	if result := query.Find(&items); result.Error != nil {
-		panic(fmt.Errorf("failed to fetch filtered items: %w", result.Error))
+// TrimPasswordHistory removes all but the most recent keep entries for the user
+func (repository *IdentityRepository) TrimPasswordHistory(ctx context.Context, userId string, keep int) error {
+	recent := repository.defaultDB.WithContext(ctx).Model(&models.PasswordHistory{}).
+		Select("id").
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
+		Limit(keep)
+
+	result := repository.defaultDB.WithContext(ctx).
+		Where("user_id = ? AND id NOT IN (?)", userId, recent).
+		Delete(&models.PasswordHistory{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to trim password history: %w", translateError(result.Error))
 	}
+	return nil
+}
 
-	return items
+func (repository *IdentityRepository) DeletePasswordHistoryByUserId(ctx context.Context, userId string) error {
+	result := repository.defaultDB.WithContext(ctx).
+		Where("user_id = ?", userId).
+		Delete(&models.PasswordHistory{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete password history: %w", translateError(result.Error))
+	}
+	return nil
 }
 
-func (repository *IdentityRepository) GetRoleById(id string) *models.Role {
-	role := &models.Role{}
-	result := repository.defaultDB.Model(&models.Role{}).
-		Where("id = ?", id).
-		First(role)
+func (repository *IdentityRepository) GetTokensBySubject(ctx context.Context, subject string) ([]models.JwtToken, error) {
+	var items []models.JwtToken
+	result := repository.defaultDB.WithContext(ctx).Model(&models.JwtToken{}).
+		Where("subject = ?", subject).
+		Order("issued_at DESC").
+		Find(&items)
 
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil
-		}
+		return nil, fmt.Errorf("failed to fetch tokens: %w", translateError(result.Error))
+	}
+
+	return items, nil
+}
 
-		panic(fmt.Errorf("failed to find category by id: %w", result.Error))
+// GetUsersDueForErasure returns users whose erasure grace period ended before the given time
+func (repository *IdentityRepository) GetUsersDueForErasure(ctx context.Context, before time.Time, limit int) ([]models.User, error) {
+	var items []models.User
+	// Accounts soft-deleted before erasure was scheduled are erased too
+	result := repository.defaultDB.WithContext(ctx).Unscoped().Model(&models.User{}).
+		Where("erasure_scheduled_at IS NOT NULL AND erasure_scheduled_at <= ?", before).
+		Order("erasure_scheduled_at ASC").
+		Limit(limit).
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch users due for erasure: %w", translateError(result.Error))
 	}
 
-	return role
+	return items, nil
+}
+
+// EraseUser permanently deletes the user and their role memberships, freeing the
+// email address and phone number for reuse
+func (repository *IdentityRepository) EraseUser(ctx context.Context, user *models.User) error {
+	result := repository.defaultDB.WithContext(ctx).Unscoped().Select("UserRoles").Delete(user)
+	if result.Error != nil {
+		return fmt.Errorf("failed to erase user: %w", translateError(result.Error))
+	}
+	return nil
+}
+
+// PurgeApiKeysByUserId permanently deletes the user's api keys, including revoked ones
+func (repository *IdentityRepository) PurgeApiKeysByUserId(ctx context.Context, userId string) error {
+	result := repository.defaultDB.WithContext(ctx).Unscoped().
+		Where("user_id = ?", userId).
+		Delete(&models.ApiKey{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge api keys: %w", translateError(result.Error))
+	}
+	return nil
 }
@@ -1,8 +1,9 @@
 package repositories
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,8 +30,40 @@ type IncidentFilter struct {
 
 type IncidentPaginatedFilter struct {
 	IncidentFilter
-	Offset int `json:"offset" form:"offset"`
-	Limit  int `json:"limit" form:"limit"`
+	Page
+}
+
+// incidentSort lists the keys incidents can be sorted by
+var incidentSort = listSort[models.Incident]{
+	keys: map[string]sortKey[models.Incident]{
+		"reportedAt": {"reported_at", func(incident *models.Incident) any { return incident.ReportedAt }},
+		"updatedAt":  {"updated_at", func(incident *models.Incident) any { return incident.UpdatedAt }},
+		"severity":   {"severity", func(incident *models.Incident) any { return incident.Severity }},
+	},
+	defaultKey:   "reportedAt",
+	defaultOrder: "desc",
+	id:           func(incident *models.Incident) string { return incident.Id },
+}
+
+// incidentChangedAtColumn is when an incident last changed, counting its deletion
+const incidentChangedAtColumn = "GREATEST(updated_at, COALESCE(deleted_at, updated_at))"
+
+// incidentChangeSort orders incidents by when they last changed. A change moves
+// an incident to the end of the list, so it is not missed by readers paging through.
+var incidentChangeSort = listSort[models.Incident]{
+	keys: map[string]sortKey[models.Incident]{
+		"changedAt": {incidentChangedAtColumn, func(incident *models.Incident) any { return incidentChangedAt(incident) }},
+	},
+	defaultKey:   "changedAt",
+	defaultOrder: "asc",
+	id:           func(incident *models.Incident) string { return incident.Id },
+}
+
+func incidentChangedAt(incident *models.Incident) time.Time {
+	if incident.DeletedAt.Valid && incident.DeletedAt.Time.After(incident.UpdatedAt) {
+		return incident.DeletedAt.Time
+	}
+	return incident.UpdatedAt
 }
 
 type IncidentStatistics struct {
@@ -64,10 +97,13 @@ type IncidentSeverityInsightsFilter struct {
 }
 
 type IncidentCategoryCount struct {
-	Id    string `json:"id"`
-	Count int64  `json:"count"`
-	Name  string `json:"name"`
-	Slug  string `json:"slug"`
+	Id       string                  `json:"id"`
+	Count    int64                   `json:"count"`
+	Name     string                  `json:"name"`
+	Slug     string                  `json:"slug"`
+	Icon     string                  `json:"icon"`
+	Color    string                  `json:"color"`
+	Children []IncidentCategoryCount `gorm:"-" json:"children"`
 }
 
 type IncidentCategoryInsights struct {
@@ -82,54 +118,67 @@ func NewIncidentRepository(defaultDB *builds.DefaultDB, logger *zap.Logger) *Inc
 	return &IncidentRepository{defaultDB, logger}
 }
 
-func (repository *IncidentRepository) CreateIncident(incident *models.Incident) error {
+func (repository *IncidentRepository) CreateIncident(ctx context.Context, incident *models.Incident) error {
 	now := time.Now()
 	incident.UpdatedAt = now
-	incident.ReportedAt = now
-	result := repository.defaultDB.Create(incident)
-	return result.Error
+	if incident.ReportedAt.IsZero() {
+		incident.ReportedAt = now
+	}
+	incident.Version = 1
+	result := repository.defaultDB.WithContext(ctx).Create(incident)
+	return translateError(result.Error)
 }
 
-func (repository *IncidentRepository) UpdateIncident(incident *models.Incident) error {
+func (repository *IncidentRepository) UpdateIncident(ctx context.Context, incident *models.Incident) error {
 	incident.UpdatedAt = time.Now()
-	return repository.defaultDB.Save(incident).Error
+	return saveVersion(repository.defaultDB.WithContext(ctx), incident, &incident.Version)
 }
 
-func (repository *IncidentRepository) DeleteIncident(incident *models.Incident) error {
-	return repository.defaultDB.Delete(incident).Error
+func (repository *IncidentRepository) DeleteIncident(ctx context.Context, incident *models.Incident) error {
+	return translateError(repository.defaultDB.WithContext(ctx).Delete(incident).Error)
 }
 
-func (repository *IncidentRepository) GetIncidentById(id string) *models.Incident {
+func (repository *IncidentRepository) GetIncidentById(ctx context.Context, id string) (*models.Incident, error) {
 	incident := &models.Incident{}
-	result := repository.defaultDB.Preload("ReportedBy").Preload("Activities").
+	result := repository.defaultDB.WithContext(ctx).Preload("ReportedBy").Preload("Activities").
 		Where("id = ?", id).
 		First(incident)
 
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil
-		}
-		panic(fmt.Errorf("failed to find incident by id: %w", result.Error))
+		return nil, fmt.Errorf("failed to find incident by id: %w", translateError(result.Error))
+	}
+
+	return incident, nil
+}
+
+func (repository *IncidentRepository) GetIncidentByCode(ctx context.Context, code string) (*models.Incident, error) {
+	incident := &models.Incident{}
+	result := repository.defaultDB.WithContext(ctx).Preload("Category").Preload("ReportedBy").
+		Where("LOWER(code) = ?", strings.ToLower(code)).
+		First(incident)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find incident by code: %w", translateError(result.Error))
 	}
 
-	return incident
+	return incident, nil
 }
 
-func (repository *IncidentRepository) IncidentCodeExists(code string) bool {
+func (repository *IncidentRepository) IncidentCodeExists(ctx context.Context, code string) (bool, error) {
 	var count int64
-	result := repository.defaultDB.Model(&models.Incident{}).
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Incident{}).
 		Where("LOWER(code) = ?", strings.ToLower(code)).
 		Count(&count)
 
 	if result.Error != nil {
-		panic(fmt.Errorf("failed to check incident code existence: %w", result.Error))
+		return false, fmt.Errorf("failed to check incident code existence: %w", translateError(result.Error))
 	}
 
-	return count > 0
+	return count > 0, nil
 }
 
-func (repository *IncidentRepository) GetPaginatedIncidents(filter IncidentPaginatedFilter) (items []models.Incident, count int64) {
-	query := repository.defaultDB.Model(&models.Incident{}).
+func (repository *IncidentRepository) GetPaginatedIncidents(ctx context.Context, filter IncidentPaginatedFilter) ([]models.Incident, PageResult, error) {
+	query := repository.defaultDB.WithContext(ctx).Model(&models.Incident{}).
 		Preload("ReportedBy").
 		Preload("Category")
 
@@ -153,54 +202,41 @@ func (repository *IncidentRepository) GetPaginatedIncidents(filter IncidentPagin
 		query = query.Where("reported_at <= ?", filter.EndDate)
 	}
 
-	allowedSortFields := map[string]string{
-		"reportedAt": "reported_at",
-		"updatedAt":  "updated_at",
-		"severity":   "severity",
-	}
-
-	allowedOrders := map[string]string{
-		"asc":  "ASC",
-		"desc": "DESC",
-	}
-
-	sortField := "reported_at"
-	sortOrder := "DESC"
-
-	if dbField, ok := allowedSortFields[filter.Sort]; ok {
-		sortField = dbField
+	items, page, err := paginate(query, filter.Page, incidentSort, filter.Sort, filter.Order)
+	if err != nil {
+		return nil, PageResult{}, fmt.Errorf("failed to fetch incidents: %w", err)
 	}
 
-	if val, ok := allowedOrders[strings.ToLower(filter.Order)]; ok {
-		sortOrder = val
-	}
-
-	query = query.Order(fmt.Sprintf("%s %s", sortField, sortOrder))
+	return items, page, nil
+}
 
-	if countResult := query.Count(&count); countResult.Error != nil {
-		panic(fmt.Errorf("failed to count incidents: %w", countResult.Error))
-	}
+// GetIncidentChanges returns a page of the incidents created, updated or deleted
+// since the given time, oldest change first. Deleted incidents are only returned
+// when a time is given, as tombstones for copies made before they were deleted.
+func (repository *IncidentRepository) GetIncidentChanges(ctx context.Context, since time.Time, page Page) ([]models.Incident, PageResult, error) {
+	query := repository.defaultDB.WithContext(ctx).Unscoped().Model(&models.Incident{}).
+		Preload("ReportedBy").
+		Preload("Category")
 
-	if filter.Offset < 0 {
-		filter.Offset = 0
-	}
-	if filter.Limit <= 0 || filter.Limit > 100 {
-		filter.Limit = 20
+	if since.IsZero() {
+		query = query.Where("deleted_at IS NULL")
+	} else {
+		query = query.Where(incidentChangedAtColumn+" >= ?", since)
 	}
 
-	query = query.Offset(filter.Offset).Limit(filter.Limit)
-
-	if result := query.Find(&items); result.Error != nil {
-		panic(fmt.Errorf("failed to fetch incidents: %w", result.Error))
+	page.Offset, page.Before = 0, ""
+	items, result, err := paginate(query, page, incidentChangeSort, "changedAt", "asc")
+	if err != nil {
+		return nil, PageResult{}, fmt.Errorf("failed to fetch incident changes: %w", err)
 	}
 
-	return items, count
+	return items, result, nil
 }
 
-func (repository *IncidentRepository) GetIncidentStatistics(dateRange period.DateRange) (*IncidentStatistics, error) {
+func (repository *IncidentRepository) GetIncidentStatistics(ctx context.Context, dateRange period.DateRange) (*IncidentStatistics, error) {
 
 	countIncidents := func(startDate, endDate time.Time, status models.IncidentStatus) (int64, error) {
-		query := repository.defaultDB.Model(&models.Incident{})
+		query := repository.defaultDB.WithContext(ctx).Model(&models.Incident{})
 
 		if !startDate.IsZero() {
 			query = query.Where("reported_at >= ?", startDate)
@@ -216,37 +252,31 @@ func (repository *IncidentRepository) GetIncidentStatistics(dateRange period.Dat
 
 		var count int64
 		if result := query.Count(&count); result.Error != nil {
-			return 0, fmt.Errorf("failed to count incidents: %w", result.Error)
+			return 0, fmt.Errorf("failed to count incidents: %w", translateError(result.Error))
 		}
 		return count, nil
 	}
 
-	totalIncidents := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) int64 {
-		count, err := countIncidents(startDate, endDate, "")
-		if err != nil {
-			repository.logger.Error("Failed to count incidents", zap.Error(err))
-			return 0
-		}
-		return count
+	totalIncidents, err := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) (int64, error) {
+		return countIncidents(startDate, endDate, "")
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	resolvedIncidents := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) int64 {
-		count, err := countIncidents(startDate, endDate, models.IncidentStatusResolved)
-		if err != nil {
-			repository.logger.Error("Failed to count resolved incidents", zap.Error(err))
-			return 0
-		}
-		return count
+	resolvedIncidents, err := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) (int64, error) {
+		return countIncidents(startDate, endDate, models.IncidentStatusResolved)
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	unresolvedIncidents := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) int64 {
-		count, err := countIncidents(startDate, endDate, models.IncidentStatusInvestigating)
-		if err != nil {
-			repository.logger.Error("Failed to count unresolved incidents", zap.Error(err))
-			return 0
-		}
-		return count
+	unresolvedIncidents, err := CalculateTrend(dateRange.StartDate, dateRange.EndDate, func(startDate, endDate time.Time) (int64, error) {
+		return countIncidents(startDate, endDate, models.IncidentStatusInvestigating)
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &IncidentStatistics{
 		TotalIncidents:      totalIncidents,
@@ -255,7 +285,7 @@ func (repository *IncidentRepository) GetIncidentStatistics(dateRange period.Dat
 	}, nil
 }
 
-func (repository *IncidentRepository) GetIncidentSeverityInsights(filter IncidentSeverityInsightsFilter) (*IncidentSeverityInsights, error) {
+func (repository *IncidentRepository) GetIncidentSeverityInsights(ctx context.Context, filter IncidentSeverityInsightsFilter) (*IncidentSeverityInsights, error) {
 	unit := period.GetUnit(filter.StartDate, filter.EndDate)
 	repository.logger.Debug("Starting GetIncidentInsights",
 		zap.Time("startDate", filter.StartDate),
@@ -263,7 +293,7 @@ func (repository *IncidentRepository) GetIncidentSeverityInsights(filter Inciden
 		zap.String("unit", fmt.Sprint(unit)),
 	)
 
-	query := repository.defaultDB.Model(&models.Incident{})
+	query := repository.defaultDB.WithContext(ctx).Model(&models.Incident{})
 
 	if !filter.StartDate.IsZero() {
 		query = query.Where("reported_at >= ?", filter.StartDate)
@@ -280,7 +310,7 @@ func (repository *IncidentRepository) GetIncidentSeverityInsights(filter Inciden
 	var count int64
 	if err := query.Count(&count).Error; err != nil {
 		repository.logger.Error("Failed to count incidents", zap.Error(err))
-		return nil, fmt.Errorf("failed to count incidents: %w", err)
+		return nil, fmt.Errorf("failed to count incidents: %w", translateError(err))
 	}
 	repository.logger.Debug("Incident count retrieved", zap.Int64("count", count))
 
@@ -349,7 +379,7 @@ func (repository *IncidentRepository) GetIncidentSeverityInsights(filter Inciden
 			Scan(result).Error; err != nil {
 			repository.logger.Error("Failed to query severity incidents",
 				zap.String("severity", string(severity)), zap.Error(err))
-			return nil, fmt.Errorf("failed to query %s incidents: %w", severity, err)
+			return nil, fmt.Errorf("failed to query %s incidents: %w", severity, translateError(err))
 		}
 	}
 
@@ -405,7 +435,7 @@ func (repository *IncidentRepository) GetIncidentSeverityInsights(filter Inciden
 	}, nil
 }
 
-func (repository *IncidentRepository) GetIncidentCategoryInsights(filter IncidentCategoryInsightsFilter) (*IncidentCategoryInsights, error) {
+func (repository *IncidentRepository) GetIncidentCategoryInsights(ctx context.Context, filter IncidentCategoryInsightsFilter) (*IncidentCategoryInsights, error) {
 	unit := period.GetUnit(filter.StartDate, filter.EndDate)
 	repository.logger.Debug("Starting GetIncidentCategoryInsights",
 		zap.Time("startDate", filter.StartDate),
@@ -413,7 +443,7 @@ func (repository *IncidentRepository) GetIncidentCategoryInsights(filter Inciden
 		zap.String("unit", fmt.Sprint(unit)),
 	)
 
-	query := repository.defaultDB.Model(&models.Incident{})
+	query := repository.defaultDB.WithContext(ctx).Model(&models.Incident{})
 
 	if !filter.StartDate.IsZero() {
 		query = query.Where("reported_at >= ?", filter.StartDate)
@@ -423,17 +453,72 @@ func (repository *IncidentRepository) GetIncidentCategoryInsights(filter Inciden
 		query = query.Where("reported_at <= ?", filter.EndDate)
 	}
 
-	var counts []IncidentCategoryCount
+	var rows []struct {
+		IncidentCategoryCount
+		ParentId    *string
+		ParentName  string
+		ParentSlug  string
+		ParentIcon  string
+		ParentColor string
+	}
 
-	if err := query.Select("category_id AS id, COUNT(*) AS count, c.name, c.slug").
-		Joins("JOIN categories c ON c.id = category_id").
-		Group("category_id, c.name, c.slug").
-		Order("count DESC").
-		Scan(&counts).Error; err != nil {
+	// LEFT JOIN so incidents whose category was deleted are still counted
+	if err := query.Select("category_id AS id, COUNT(*) AS count, " +
+		"COALESCE(c.name, '') AS name, COALESCE(c.slug, '') AS slug, COALESCE(c.icon, '') AS icon, COALESCE(c.color, '') AS color, c.parent_id, " +
+		"COALESCE(p.name, '') AS parent_name, COALESCE(p.slug, '') AS parent_slug, COALESCE(p.icon, '') AS parent_icon, COALESCE(p.color, '') AS parent_color").
+		Joins("LEFT JOIN categories c ON c.id = category_id").
+		Joins("LEFT JOIN categories p ON p.id = c.parent_id").
+		Group("category_id, c.name, c.slug, c.icon, c.color, c.parent_id, p.name, p.slug, p.icon, p.color").
+		Scan(&rows).Error; err != nil {
 		repository.logger.Error("Failed to query incident category insights", zap.Error(err))
-		return nil, fmt.Errorf("failed to query incident category insights: %w", err)
+		return nil, fmt.Errorf("failed to query incident category insights: %w", translateError(err))
+	}
+
+	// Roll subcategory counts up into their parent category
+	counts := make([]IncidentCategoryCount, 0)
+	indexes := make(map[string]int)
+
+	rootIndex := func(count IncidentCategoryCount) int {
+		if index, ok := indexes[count.Id]; ok {
+			return index
+		}
+		count.Count = 0
+		count.Children = []IncidentCategoryCount{}
+		counts = append(counts, count)
+		indexes[count.Id] = len(counts) - 1
+		return len(counts) - 1
+	}
+
+	for _, row := range rows {
+		if row.ParentId == nil {
+			index := rootIndex(row.IncidentCategoryCount)
+			counts[index].Count += row.Count
+			continue
+		}
+
+		index := rootIndex(IncidentCategoryCount{
+			Id:    *row.ParentId,
+			Name:  row.ParentName,
+			Slug:  row.ParentSlug,
+			Icon:  row.ParentIcon,
+			Color: row.ParentColor,
+		})
+		child := row.IncidentCategoryCount
+		child.Children = []IncidentCategoryCount{}
+		counts[index].Count += child.Count
+		counts[index].Children = append(counts[index].Children, child)
+	}
+
+	for i := range counts {
+		sort.SliceStable(counts[i].Children, func(a, b int) bool {
+			return counts[i].Children[a].Count > counts[i].Children[b].Count
+		})
 	}
 
+	sort.SliceStable(counts, func(a, b int) bool {
+		return counts[a].Count > counts[b].Count
+	})
+
 	if len(counts) == 0 {
 		repository.logger.Debug("No incident category insights found")
 		return &IncidentCategoryInsights{Counts: []IncidentCategoryCount{}}, nil
@@ -446,3 +531,30 @@ func (repository *IncidentRepository) GetIncidentCategoryInsights(filter Inciden
 
 	return &IncidentCategoryInsights{Counts: counts}, nil
 }
+
+func (repository *IncidentRepository) GetIncidentsByReporterId(ctx context.Context, userId string) ([]models.Incident, error) {
+	var items []models.Incident
+	result := repository.defaultDB.WithContext(ctx).Model(&models.Incident{}).
+		Preload("Category").
+		Where("reported_by_id = ?", userId).
+		Order("reported_at DESC").
+		Find(&items)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to fetch incidents by reporter: %w", translateError(result.Error))
+	}
+
+	return items, nil
+}
+
+// AnonymizeIncidentsByReporterId detaches the incidents, including soft-deleted ones,
+// from their reporter so they can still be counted in statistics
+func (repository *IncidentRepository) AnonymizeIncidentsByReporterId(ctx context.Context, userId string) error {
+	result := repository.defaultDB.WithContext(ctx).Unscoped().Model(&models.Incident{}).
+		Where("reported_by_id = ?", userId).
+		Updates(map[string]any{"reported_by_id": nil, "version": nextVersion})
+	if result.Error != nil {
+		return fmt.Errorf("failed to anonymize incidents: %w", translateError(result.Error))
+	}
+	return nil
+}
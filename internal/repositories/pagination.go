@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/prince272/konabra/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// Page selects a page of a list, either by offset or by a cursor returned with
+// a previous page. Cursors keep their place while new items are added, so they
+// should be preferred for lists that change often.
+type Page struct {
+	Offset       int    `json:"offset" form:"offset"`
+	Limit        int    `json:"limit" form:"limit"`
+	After        string `json:"after" form:"after"`               // Returns the items that follow this cursor
+	Before       string `json:"before" form:"before"`             // Returns the items that precede this cursor
+	IncludeCount *bool  `json:"includeCount" form:"includeCount"` // Defaults to true for offset pages and false for cursor pages
+}
+
+// PageResult describes where a page sits in its list
+type PageResult struct {
+	Count      *int64 `json:"count,omitempty"`      // Total number of items, when requested
+	NextCursor string `json:"nextCursor,omitempty"` // Cursor for the next page, when more items follow
+	PrevCursor string `json:"prevCursor,omitempty"` // Cursor for the previous page, when items precede this one
+}
+
+// sortKey is a column a list can be sorted by
+type sortKey[T any] struct {
+	column string
+	value  func(item *T) any // Returns the value of the column for an item
+}
+
+// listSort describes how a list can be sorted. The id column breaks ties so
+// that every item has a distinct position.
+type listSort[T any] struct {
+	keys         map[string]sortKey[T] // Keyed by the name used by filters
+	defaultKey   string
+	defaultOrder string
+	id           func(item *T) string
+}
+
+// pageCursor is the position of an item in a sorted list
+type pageCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	Id    string          `json:"id"`
+}
+
+// paginate returns a page of the items matched by the query, sorted by the named
+// key in the given order. The total count is only computed when requested.
+func paginate[T any](query *gorm.DB, page Page, sort listSort[T], sortName string, order string) ([]T, PageResult, error) {
+	key, ok := sort.keys[sortName]
+	if !ok {
+		sortName = sort.defaultKey
+		key = sort.keys[sortName]
+	}
+
+	order = strings.ToLower(order)
+	if order != "asc" && order != "desc" {
+		order = sort.defaultOrder
+	}
+	sortId := sortName + ":" + order
+
+	if page.Limit <= 0 || page.Limit > maxPageLimit {
+		page.Limit = defaultPageLimit
+	}
+
+	var result PageResult
+
+	includeCount := page.After == "" && page.Before == ""
+	if page.IncludeCount != nil {
+		includeCount = *page.IncludeCount
+	}
+	if includeCount {
+		var count int64
+		if err := query.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+			return nil, PageResult{}, translateError(err)
+		}
+		result.Count = &count
+	}
+
+	// Pages before a cursor are read in reverse and put back in order afterwards
+	backward := page.Before != ""
+	descending := (order == "desc") != backward
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+	query = query.Order(fmt.Sprintf("%s %s, id %s", key.column, direction, direction))
+
+	cursor := page.After
+	if backward {
+		cursor = page.Before
+	}
+	if cursor != "" {
+		value, id, err := decodePageCursor(cursor, sortId, key.value(new(T)))
+		if err != nil {
+			return nil, PageResult{}, err
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", key.column, comparison), value, id)
+	} else if page.Offset > 0 {
+		query = query.Offset(page.Offset)
+	}
+
+	var items []T
+	if err := query.Limit(page.Limit + 1).Find(&items).Error; err != nil {
+		return nil, PageResult{}, translateError(err)
+	}
+
+	more := len(items) > page.Limit
+	if more {
+		items = items[:page.Limit]
+	}
+	if backward {
+		slices.Reverse(items)
+	}
+
+	if len(items) > 0 {
+		first, last := &items[0], &items[len(items)-1]
+		if (backward && more) || (!backward && (cursor != "" || page.Offset > 0)) {
+			result.PrevCursor = encodePageCursor(sortId, key.value(first), sort.id(first))
+		}
+		if (!backward && more) || backward {
+			result.NextCursor = encodePageCursor(sortId, key.value(last), sort.id(last))
+		}
+	}
+
+	return items, result, nil
+}
+
+func encodePageCursor(sortId string, value any, id string) string {
+	encodedValue, _ := json.Marshal(value)
+	data, _ := json.Marshal(pageCursor{Sort: sortId, Value: encodedValue, Id: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageCursor reads a cursor created for the same sort. The value is
+// decoded into the type of the example so that it is compared as the column type.
+func decodePageCursor(encoded string, sortId string, example any) (any, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", models.ErrInvalidCursor, err)
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", models.ErrInvalidCursor, err)
+	}
+	if cursor.Sort != sortId {
+		return nil, "", fmt.Errorf("%w: cursor was created for sort %q", models.ErrInvalidCursor, cursor.Sort)
+	}
+
+	value := reflect.New(reflect.TypeOf(example))
+	if err := json.Unmarshal(cursor.Value, value.Interface()); err != nil {
+		return nil, "", fmt.Errorf("%w: %w", models.ErrInvalidCursor, err)
+	}
+	return value.Elem().Interface(), cursor.Id, nil
+}
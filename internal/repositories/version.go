@@ -0,0 +1,30 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/prince272/konabra/internal/models"
+	"gorm.io/gorm"
+)
+
+// saveVersion saves every field of a record, but only if the record still has
+// the version it was read with, and increments the version. ErrStale is returned
+// when the record was updated or deleted by someone else in the meantime.
+func saveVersion(db *gorm.DB, value any, version *int64) error {
+	expected := *version
+	*version = expected + 1
+
+	result := db.Model(value).Where("version = ?", expected).Select("*").Updates(value)
+	if result.Error != nil {
+		*version = expected
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		*version = expected
+		return fmt.Errorf("%w: version %d is no longer current", models.ErrStale, expected)
+	}
+	return nil
+}
+
+// nextVersion increments the version column in bulk updates
+var nextVersion = gorm.Expr("version + 1")
@@ -0,0 +1,280 @@
+// Package seeds fills a fresh database with the data the application expects
+// to exist: roles, the default road incident categories and optional demo
+// incidents. Every seed is idempotent and can be run repeatedly.
+package seeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/utils"
+	"go.uber.org/zap"
+)
+
+// CategorySeed describes a default category and its subcategories
+type CategorySeed struct {
+	Name        string
+	Slug        string
+	Description string
+	Icon        string
+	Color       string
+	Keywords    []string // SMS keywords, the first one is shown in the SMS help
+	Children    []CategorySeed
+}
+
+// DefaultCategories are the road incident categories used across Ghana
+var DefaultCategories = []CategorySeed{
+	{
+		Name: "Road condition", Slug: "road-condition", Icon: "road", Color: "#F59E0B",
+		Description: "Problems with the road surface or structures",
+		Children: []CategorySeed{
+			{Name: "Pothole", Slug: "pothole", Icon: "pothole", Color: "#F59E0B", Description: "Holes or cracks in the road surface", Keywords: []string{"POT", "POTHOLE"}},
+			{Name: "Flooding", Slug: "flooding", Icon: "flood", Color: "#3B82F6", Description: "Water covering the road after rain or blocked drains", Keywords: []string{"FLOOD"}},
+			{Name: "Road works", Slug: "road-works", Icon: "cone", Color: "#F97316", Description: "Construction or repairs narrowing or closing the road", Keywords: []string{"WORKS"}},
+			{Name: "Damaged bridge", Slug: "damaged-bridge", Icon: "bridge", Color: "#B45309", Description: "Bridges or culverts that are broken or unsafe", Keywords: []string{"BRIDGE"}},
+		},
+	},
+	{
+		Name: "Traffic", Slug: "traffic", Icon: "traffic", Color: "#EF4444",
+		Description: "Delays and obstructions affecting the flow of traffic",
+		Children: []CategorySeed{
+			{Name: "Congestion", Slug: "congestion", Icon: "traffic-jam", Color: "#EF4444", Description: "Heavy or standstill traffic", Keywords: []string{"JAM", "TRAFFIC"}},
+			{Name: "Broken-down vehicle", Slug: "broken-down-vehicle", Icon: "car-breakdown", Color: "#DC2626", Description: "A vehicle stuck on the road", Keywords: []string{"BREAKDOWN"}},
+			{Name: "Faulty traffic light", Slug: "faulty-traffic-light", Icon: "traffic-light", Color: "#F87171", Description: "Traffic lights that are off or not working properly", Keywords: []string{"LIGHT"}},
+		},
+	},
+	{
+		Name: "Accident", Slug: "accident", Icon: "accident", Color: "#B91C1C",
+		Description: "Crashes involving vehicles, motorbikes or pedestrians",
+		Children: []CategorySeed{
+			{Name: "Collision", Slug: "collision", Icon: "car-crash", Color: "#B91C1C", Description: "Two or more vehicles involved in a crash", Keywords: []string{"ACC", "CRASH"}},
+			{Name: "Pedestrian knockdown", Slug: "pedestrian-knockdown", Icon: "pedestrian", Color: "#991B1B", Description: "A pedestrian hit by a vehicle", Keywords: []string{"KNOCK"}},
+			{Name: "Motorbike crash", Slug: "motorbike-crash", Icon: "motorbike", Color: "#7F1D1D", Description: "A crash involving a motorbike or okada", Keywords: []string{"OKADA", "MOTO"}},
+		},
+	},
+	{
+		Name: "Hazard", Slug: "hazard", Icon: "hazard", Color: "#8B5CF6",
+		Description: "Objects or animals on the road that put road users at risk",
+		Children: []CategorySeed{
+			{Name: "Fallen tree", Slug: "fallen-tree", Icon: "tree", Color: "#16A34A", Description: "A tree or branch blocking the road", Keywords: []string{"TREE"}},
+			{Name: "Debris", Slug: "debris", Icon: "debris", Color: "#8B5CF6", Description: "Rubble, cargo or other objects on the road", Keywords: []string{"DEBRIS"}},
+			{Name: "Animal on road", Slug: "animal-on-road", Icon: "animal", Color: "#A16207", Description: "Livestock or other animals on the road", Keywords: []string{"ANIMAL"}},
+		},
+	},
+	{
+		Name: "Security", Slug: "security", Icon: "shield", Color: "#1F2937",
+		Description: "Robberies, harassment and other threats to road users",
+		Keywords:    []string{"ROB", "SECURITY"},
+	},
+}
+
+type demoLocation struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+var demoLocations = []demoLocation{
+	{"Kwame Nkrumah Circle, Accra", 5.5700, -0.2168},
+	{"Kaneshie Market, Accra", 5.5650, -0.2360},
+	{"Tetteh Quarshie Interchange, Accra", 5.6160, -0.1770},
+	{"Madina Zongo Junction, Accra", 5.6730, -0.1660},
+	{"Kasoa Toll Booth, Accra", 5.5250, -0.4170},
+	{"Spintex Road, Accra", 5.6350, -0.1150},
+	{"Achimota Overhead, Accra", 5.6130, -0.2310},
+	{"Kejetia Market, Kumasi", 6.6960, -1.6240},
+	{"Adum, Kumasi", 6.6920, -1.6270},
+	{"Santasi Roundabout, Kumasi", 6.6640, -1.6500},
+	{"Suame Magazine, Kumasi", 6.7200, -1.6290},
+	{"KNUST Junction, Kumasi", 6.6750, -1.5700},
+}
+
+var demoSummaries = map[string][]string{
+	"pothole":              {"Deep pothole in the middle lane", "Several potholes causing cars to swerve"},
+	"flooding":             {"Road flooded after heavy rain", "Blocked gutter flooding the junction"},
+	"road-works":           {"One lane closed for road works", "Resurfacing works with no diversion signs"},
+	"damaged-bridge":       {"Cracks on the bridge railing", "Culvert collapsed at the roadside"},
+	"congestion":           {"Standstill traffic towards the interchange", "Heavy traffic at the junction"},
+	"broken-down-vehicle":  {"Trotro broken down in the outer lane", "Truck stuck on the shoulder"},
+	"faulty-traffic-light": {"Traffic lights off at the junction", "Lights stuck on red"},
+	"collision":            {"Two cars collided at the junction", "Minor crash blocking one lane"},
+	"pedestrian-knockdown": {"Pedestrian hit near the footbridge", "Pedestrian knocked down at the crossing"},
+	"motorbike-crash":      {"Okada rider crashed into a taxi", "Motorbike skidded on sand"},
+	"fallen-tree":          {"Fallen tree blocking the road", "Large branch on the road after a storm"},
+	"debris":               {"Sand and stones spilled from a truck", "Debris left from construction works"},
+	"animal-on-road":       {"Cattle crossing the highway", "Goats on the road near the market"},
+	"security":             {"Reports of phone snatching in traffic", "Suspicious roadblock at night"},
+}
+
+type Seeder struct {
+	identityRepository *repositories.IdentityRepository
+	categoryRepository *repositories.CategoryRepository
+	incidentRepository *repositories.IncidentRepository
+	logger             *zap.Logger
+}
+
+func NewSeeder(
+	identityRepository *repositories.IdentityRepository,
+	categoryRepository *repositories.CategoryRepository,
+	incidentRepository *repositories.IncidentRepository,
+	logger *zap.Logger,
+) *Seeder {
+	return &Seeder{
+		identityRepository,
+		categoryRepository,
+		incidentRepository,
+		logger,
+	}
+}
+
+// SeedRoles creates every built-in role that does not exist yet
+func (seeder *Seeder) SeedRoles(ctx context.Context) error {
+	if _, err := seeder.identityRepository.EnsureRoleExists(ctx, models.RoleAll...); err != nil {
+		return fmt.Errorf("failed to seed roles: %w", err)
+	}
+	return nil
+}
+
+// SeedCategories creates every default category whose slug does not exist yet
+// and returns the number created
+func (seeder *Seeder) SeedCategories(ctx context.Context) (int, error) {
+	created := 0
+	for order, seed := range DefaultCategories {
+		parent, isNew, err := seeder.seedCategory(ctx, seed, nil, int64(order))
+		if err != nil {
+			return created, err
+		}
+		if isNew {
+			created++
+		}
+
+		for childOrder, childSeed := range seed.Children {
+			_, isNew, err := seeder.seedCategory(ctx, childSeed, &parent.Id, int64(childOrder))
+			if err != nil {
+				return created, err
+			}
+			if isNew {
+				created++
+			}
+		}
+	}
+	return created, nil
+}
+
+func (seeder *Seeder) seedCategory(ctx context.Context, seed CategorySeed, parentId *string, order int64) (*models.Category, bool, error) {
+	category, err := seeder.categoryRepository.GetCategoryBySlug(ctx, seed.Slug)
+	if err == nil {
+		return category, false, nil
+	}
+	if !errors.Is(err, models.ErrNotFound) {
+		return nil, false, fmt.Errorf("failed to seed category %q: %w", seed.Slug, err)
+	}
+
+	category = &models.Category{
+		Id:          uuid.New().String(),
+		ParentId:    parentId,
+		Name:        seed.Name,
+		Slug:        seed.Slug,
+		Description: seed.Description,
+		Icon:        seed.Icon,
+		Color:       seed.Color,
+		Schema:      models.JSONMap{},
+		Keywords:    models.JSONList(seed.Keywords),
+		Order:       order,
+	}
+
+	if err := seeder.categoryRepository.CreateCategory(ctx, category); err != nil {
+		return nil, false, fmt.Errorf("failed to seed category %q: %w", seed.Slug, err)
+	}
+
+	seeder.logger.Info("Seeded category", zap.String("slug", seed.Slug))
+	return category, true, nil
+}
+
+// SeedDemoIncidents creates anonymous incidents spread over the last 30 days
+// around Accra and Kumasi. The default categories must have been seeded.
+func (seeder *Seeder) SeedDemoIncidents(ctx context.Context, count int) (int, error) {
+	var categories []*models.Category
+	for _, seed := range DefaultCategories {
+		slugs := []string{seed.Slug}
+		if len(seed.Children) > 0 {
+			slugs = slugs[:0]
+			for _, child := range seed.Children {
+				slugs = append(slugs, child.Slug)
+			}
+		}
+
+		for _, slug := range slugs {
+			category, err := seeder.categoryRepository.GetCategoryBySlug(ctx, slug)
+			if errors.Is(err, models.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return 0, fmt.Errorf("failed to find category %q: %w", slug, err)
+			}
+			if category.ArchivedAt == nil {
+				categories = append(categories, category)
+			}
+		}
+	}
+
+	if len(categories) == 0 {
+		return 0, fmt.Errorf("no default categories found, seed the categories first")
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	severities := []models.IncidentSeverity{models.IncidentSeverityLow, models.IncidentSeverityMedium, models.IncidentSeverityHigh}
+	statuses := []models.IncidentStatus{models.IncidentStatusPending, models.IncidentStatusInvestigating, models.IncidentStatusResolved, models.IncidentStatusFalseAlarm}
+
+	for i := 0; i < count; i++ {
+		category := categories[random.Intn(len(categories))]
+		location := demoLocations[random.Intn(len(demoLocations))]
+		summaries := demoSummaries[category.Slug]
+
+		var err error
+		code := utils.GenerateUniqueCode("INC", 5, utils.NumericUniqueCode, "", func(code string) bool {
+			var exists bool
+			exists, err = seeder.incidentRepository.IncidentCodeExists(ctx, code)
+			return exists && err == nil
+		})
+		if err != nil {
+			return i, fmt.Errorf("failed to seed demo incident: %w", err)
+		}
+
+		incident := &models.Incident{
+			Id:         uuid.New().String(),
+			CategoryId: category.Id,
+			Code:       code,
+			Summary:    summaries[random.Intn(len(summaries))],
+			Severity:   severities[random.Intn(len(severities))],
+			Status:     statuses[random.Intn(len(statuses))],
+			Latitude:   location.Latitude + (random.Float64()-0.5)*0.01,
+			Longitude:  location.Longitude + (random.Float64()-0.5)*0.01,
+			Location:   location.Name,
+			Fields:     models.JSONMap{},
+		}
+
+		if err := seeder.incidentRepository.CreateIncident(ctx, incident); err != nil {
+			return i, fmt.Errorf("failed to seed demo incident: %w", err)
+		}
+
+		// Spread the incidents over time so that statistics and insights have data to show
+		incident.ReportedAt = time.Now().Add(-time.Duration(random.Int63n(int64(30 * 24 * time.Hour))))
+		if incident.Status == models.IncidentStatusResolved || incident.Status == models.IncidentStatusFalseAlarm {
+			resolvedAt := incident.ReportedAt.Add(time.Duration(random.Int63n(int64(time.Since(incident.ReportedAt)))))
+			incident.ResolvedAt = &resolvedAt
+		}
+
+		if err := seeder.incidentRepository.UpdateIncident(ctx, incident); err != nil {
+			return i, fmt.Errorf("failed to seed demo incident: %w", err)
+		}
+	}
+
+	return count, nil
+}
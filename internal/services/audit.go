@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jinzhu/copier"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// auditRedactedFields are never written to the audit log
+var auditRedactedFields = []string{
+	"passwordHash",
+	"securityStamp",
+	"keyHash",
+	"accessTokenHash",
+	"refreshTokenHash",
+	"password",
+	"newPassword",
+	"oldPassword",
+	"code",
+	"token",
+}
+
+const securityActivityLimit = 50
+
+type AuditService struct {
+	auditRepository *repositories.AuditRepository
+	logger          *zap.Logger
+}
+
+// AuditRecord describes an action to be written to the audit log
+type AuditRecord struct {
+	Action     string
+	ActorId    string // Defaults to the authenticated user of the request
+	TargetType string
+	TargetId   string
+	Before     any // State of the target before the action, if any
+	After      any // State of the target after the action, if any
+}
+
+type AuditEventModel struct {
+	Id         string          `json:"id"`
+	ActorId    string          `json:"actorId"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"targetType"`
+	TargetId   string          `json:"targetId"`
+	IpAddress  string          `json:"ipAddress"`
+	UserAgent  string          `json:"userAgent"`
+	Changes    json.RawMessage `json:"changes"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+type AuditEventPaginatedListModel struct {
+	Items []AuditEventModel `json:"items"`
+	Count int64             `json:"count"`
+}
+
+type AuditEventListModel []AuditEventModel
+
+type auditChange struct {
+	Old any `json:"old,omitempty"`
+	New any `json:"new,omitempty"`
+}
+
+func NewAuditService(auditRepository *repositories.AuditRepository, logger *zap.Logger) *AuditService {
+	return &AuditService{
+		auditRepository: auditRepository,
+		logger:          logger,
+	}
+}
+
+// log returns the request-scoped logger carried by ctx
+func (service *AuditService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+// Record writes an audit event. Failures are logged and never interrupt the caller.
+func (service *AuditService) Record(ctx context.Context, record AuditRecord) {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	info := helpers.GetRequestInfo(ctx)
+
+	actorId := record.ActorId
+	if actorId == "" {
+		actorId = info.UserId
+	}
+
+	changes, err := diffAuditChanges(record.Before, record.After)
+	if err != nil {
+		service.log(ctx).Error("Error computing audit changes: ", zap.Error(err))
+		changes = "{}"
+	}
+
+	event := &models.AuditEvent{
+		Id:         uuid.New().String(),
+		ActorId:    actorId,
+		Action:     record.Action,
+		TargetType: record.TargetType,
+		TargetId:   record.TargetId,
+		IpAddress:  info.IpAddress,
+		UserAgent:  info.UserAgent,
+		Changes:    changes,
+	}
+
+	// The action being audited has already happened, so the event is written
+	// even when the request has been cancelled or has run out of time
+	if err := service.auditRepository.CreateAuditEvent(context.WithoutCancel(ctx), event); err != nil {
+		service.log(ctx).Error("Error writing audit event: ", zap.String("action", record.Action), zap.Error(err))
+	}
+}
+
+func (service *AuditService) GetPaginatedAuditEvents(ctx context.Context, filter repositories.AuditEventPaginatedFilter) (*AuditEventPaginatedListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetPaginatedAuditEvents")
+	defer span.End()
+
+	items, count, err := service.auditRepository.GetPaginatedAuditEvents(ctx, filter)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	models, problem := service.toAuditEventModels(ctx, items)
+	if problem != nil {
+		return nil, problem
+	}
+
+	return &AuditEventPaginatedListModel{
+		Items: models,
+		Count: count,
+	}, nil
+}
+
+func (service *AuditService) GetSecurityActivity(ctx context.Context, userId string) (*AuditEventListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetSecurityActivity")
+	defer span.End()
+
+	items, err := service.auditRepository.GetSecurityActivity(ctx, userId, securityActivityLimit)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	models, problem := service.toAuditEventModels(ctx, items)
+	if problem != nil {
+		return nil, problem
+	}
+
+	listModel := AuditEventListModel(models)
+	return &listModel, nil
+}
+
+func (service *AuditService) toAuditEventModels(ctx context.Context, items []models.AuditEvent) ([]AuditEventModel, *problems.Problem) {
+	models := make([]AuditEventModel, 0, len(items))
+	for _, item := range items {
+		model := &AuditEventModel{}
+		if err := copier.Copy(model, &item); err != nil {
+			service.log(ctx).Error("Error copying audit event to model: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+		model.Changes = json.RawMessage(item.Changes)
+		models = append(models, *model)
+	}
+	return models, nil
+}
+
+// diffAuditChanges compares the top-level scalar fields of two values and
+// returns the changed fields as JSON, leaving out sensitive fields.
+func diffAuditChanges(before, after any) (string, error) {
+	oldFields, err := toAuditFields(before)
+	if err != nil {
+		return "", err
+	}
+
+	newFields, err := toAuditFields(after)
+	if err != nil {
+		return "", err
+	}
+
+	changes := map[string]auditChange{}
+	for key, oldValue := range oldFields {
+		if newValue, ok := newFields[key]; !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = auditChange{Old: oldValue, New: newFields[key]}
+		}
+	}
+	for key, newValue := range newFields {
+		if _, ok := oldFields[key]; !ok {
+			changes[key] = auditChange{New: newValue}
+		}
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func toAuditFields(value any) (map[string]any, error) {
+	fields := map[string]any{}
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil()) {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	for key, fieldValue := range raw {
+		if slices.Contains(auditRedactedFields, key) {
+			continue
+		}
+
+		switch fieldValue.(type) {
+		case map[string]any, []any:
+			// Nested objects are left out to keep related records out of the log
+			continue
+		}
+
+		fields[key] = fieldValue
+	}
+
+	return fields, nil
+}
@@ -1,14 +1,23 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jinzhu/copier"
 	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/logging"
 	"github.com/prince272/konabra/internal/models"
 	"github.com/prince272/konabra/internal/problems"
 	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
+	"github.com/prince272/konabra/pkg/jsonschema"
 	"github.com/prince272/konabra/utils"
 	"go.uber.org/zap"
 )
@@ -16,180 +25,669 @@ import (
 type CategoryService struct {
 	categoryRepository *repositories.CategoryRepository
 	validator          *helpers.Validator
+	auditService       *AuditService
 	logger             *zap.Logger
 }
 
 type CreateCategoryForm struct {
-	Name        string `json:"name" validate:"required,max=512"`
-	Description string `json:"description" validate:"max=1024"`
+	ParentId    *string        `json:"parentId"`
+	Name        string         `json:"name" validate:"required,max=512"`
+	Description string         `json:"description" validate:"max=1024"`
+	Icon        string         `json:"icon" validate:"max=64"`
+	Color       string         `json:"color" validate:"omitempty,hexcolor"`
+	Schema      map[string]any `json:"schema"`
+	Keywords    []string       `json:"keywords" validate:"max=10,dive,required,max=16,alphanum"` // Words that file an SMS report under the category
 }
 
 type UpdateCategoryForm struct {
 	CreateCategoryForm
+	ExpectedVersion *int64 `json:"-"` // Read from the If-Match header, the update fails if the category has another version
+}
+
+type ReorderCategoriesForm struct {
+	Items []CategoryOrderForm `json:"items" validate:"required,min=1,dive"`
+}
+
+type CategoryOrderForm struct {
+	Id    string `json:"id" validate:"required"`
+	Order int64  `json:"order"`
+}
+
+type DeleteCategoryForm struct {
+	MoveTo string `json:"moveTo" form:"moveTo"` // Category that receives the incidents of the deleted category
+	Force  bool   `json:"force" form:"force"`   // Delete the category even though incidents still reference it
 }
 
 type CategoryModel struct {
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	Slug        string `json:"slug"`
-	Description string `json:"description"`
+	Id          string         `json:"id"`
+	ParentId    *string        `json:"parentId"`
+	Name        string         `json:"name"`
+	Slug        string         `json:"slug"`
+	Description string         `json:"description"`
+	Icon        string         `json:"icon"`
+	Color       string         `json:"color"`
+	Schema      map[string]any `json:"schema"`
+	Keywords    []string       `json:"keywords"`
+	ArchivedAt  *time.Time     `json:"archivedAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	Version     int64          `json:"version"`
 }
 
+// LastModified returns when the category last changed
+func (model CategoryModel) LastModified() time.Time {
+	return model.UpdatedAt
+}
+
+// ResourceVersion returns the version of the category, which leads its ETag
+func (model CategoryModel) ResourceVersion() int64 {
+	return model.Version
+}
+
+type CategoryTreeModel struct {
+	CategoryModel
+	Children []CategoryTreeModel `json:"children"`
+}
+
+type CategoryTreeListModel []CategoryTreeModel
+
 type CategoryListModel []CategoryModel
 
 type CategoryPaginatedListModel struct {
 	Items []CategoryModel `json:"items"`
-	Count int64           `json:"count"`
+	repositories.PageResult
 }
 
-func NewCategoryService(categoryRepository *repositories.CategoryRepository, validator *helpers.Validator, logger *zap.Logger) *CategoryService {
+func NewCategoryService(categoryRepository *repositories.CategoryRepository, validator *helpers.Validator, auditService *AuditService, logger *zap.Logger) *CategoryService {
 	return &CategoryService{
 		categoryRepository,
 		validator,
+		auditService,
 		logger,
 	}
 }
 
-func (service *CategoryService) CreateCategory(form CreateCategoryForm) (*CategoryModel, *problems.Problem) {
+// log returns the request-scoped logger carried by ctx
+func (service *CategoryService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+func (service *CategoryService) CreateCategory(ctx context.Context, form CreateCategoryForm) (*CategoryModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.CreateCategory")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return nil, problems.FromError(err)
 	}
 
-	if exists := service.categoryRepository.CategoryNameExists(form.Name); exists {
+	exists, err := service.categoryRepository.CategoryNameExists(ctx, form.Name)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	if exists {
 		return nil, problems.NewValidationProblem(map[string]string{"name": "Category name already exists."})
 	}
 
+	if problem := service.validateCategoryParent(ctx, "", form.ParentId); problem != nil {
+		return nil, problem
+	}
+
+	if problem := service.validateCategorySchema(form.Schema); problem != nil {
+		return nil, problem
+	}
+
+	keywords, problem := service.validateCategoryKeywords(ctx, "", form.Keywords)
+	if problem != nil {
+		return nil, problem
+	}
+
 	category := &models.Category{}
 
 	if err := copier.Copy(category, form); err != nil {
-		service.logger.Error("Error copying form to category: ", zap.Error(err))
+		service.log(ctx).Error("Error copying form to category: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	category.Id = uuid.New().String()
-	category.Slug = utils.GenerateSlug([]string{form.Name}, service.categoryRepository.CategorySlugExists)
-	err := service.categoryRepository.CreateCategory(category)
+	category.ParentId = normalizeCategoryParentId(form.ParentId)
+	category.Keywords = keywords
+	category.Slug = utils.GenerateSlug([]string{form.Name}, existenceChecker(ctx, service.categoryRepository.CategorySlugExists, &err))
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	err = service.categoryRepository.CreateCategory(ctx, category)
 
 	if err != nil {
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionCategoryCreated,
+		TargetType: models.AuditTargetCategory,
+		TargetId:   category.Id,
+		After:      category,
+	})
+
 	model := &CategoryModel{}
 
 	if err := copier.Copy(model, category); err != nil {
-		service.logger.Error("Error copying category to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *CategoryService) UpdateCategory(id string, form UpdateCategoryForm) (*CategoryModel, *problems.Problem) {
+func (service *CategoryService) UpdateCategory(ctx context.Context, id string, form UpdateCategoryForm) (*CategoryModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.UpdateCategory")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return nil, problems.FromError(err)
 	}
 
-	category := service.categoryRepository.GetCategoryById(id)
+	category, err := service.categoryRepository.GetCategoryById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	return service.updateCategory(ctx, category, form)
+}
 
-	if category == nil {
+// PatchCategory applies a JSON merge patch to a category. Only the fields named
+// by the patch are validated, the others keep their current values.
+func (service *CategoryService) PatchCategory(ctx context.Context, id string, patch map[string]any, expectedVersion *int64) (*CategoryModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.PatchCategory")
+	defer span.End()
+
+	category, err := service.categoryRepository.GetCategoryById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
 		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
 	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
-	if exists := service.categoryRepository.CategoryNameExists(form.Name); exists {
+	form := UpdateCategoryForm{}
+	if err := copier.Copy(&form, category); err != nil {
+		service.log(ctx).Error("Error copying category to form: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+	if err := helpers.ApplyMergePatch(&form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+	if err := service.validator.ValidatePatch(form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+	form.ExpectedVersion = expectedVersion
+
+	return service.updateCategory(ctx, category, form)
+}
+
+// updateCategory saves a validated form to a category
+func (service *CategoryService) updateCategory(ctx context.Context, category *models.Category, form UpdateCategoryForm) (*CategoryModel, *problems.Problem) {
+	id := category.Id
+	if form.ExpectedVersion != nil && *form.ExpectedVersion != category.Version {
+		return nil, service.staleCategoryProblem(ctx, id)
+	}
+
+	exists, err := service.categoryRepository.CategoryNameExists(ctx, form.Name)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	if exists {
 		if category.Name != form.Name {
 			return nil, problems.NewValidationProblem(map[string]string{"name": "Category name already exists for another category."})
 		}
 	}
 
+	if problem := service.validateCategoryParent(ctx, category.Id, form.ParentId); problem != nil {
+		return nil, problem
+	}
+
+	if problem := service.validateCategorySchema(form.Schema); problem != nil {
+		return nil, problem
+	}
+
+	keywords, problem := service.validateCategoryKeywords(ctx, category.Id, form.Keywords)
+	if problem != nil {
+		return nil, problem
+	}
+
+	before := *category
+
 	if err := copier.Copy(category, form); err != nil {
-		service.logger.Error("Error copying form to category: ", zap.Error(err))
+		service.log(ctx).Error("Error copying form to category: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
+	category.ParentId = normalizeCategoryParentId(form.ParentId)
+	category.Keywords = keywords
+
 	slug := utils.GenerateSlug([]string{form.Name})
 
-	if exists := service.categoryRepository.CategorySlugExists(slug); exists {
+	slugExists, err := service.categoryRepository.CategorySlugExists(ctx, slug)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	if slugExists {
 		if category.Slug != slug {
-			category.Slug = utils.GenerateSlug([]string{form.Name}, service.categoryRepository.CategorySlugExists)
+			category.Slug = utils.GenerateSlug([]string{form.Name}, existenceChecker(ctx, service.categoryRepository.CategorySlugExists, &err))
+			if err != nil {
+				return nil, repositoryProblem(service.log(ctx), err)
+			}
 		}
 	}
 
 	category.Slug = slug
-	err := service.categoryRepository.UpdateCategory(category)
+	err = service.categoryRepository.UpdateCategory(ctx, category)
 
+	if errors.Is(err, models.ErrStale) {
+		return nil, service.staleCategoryProblem(ctx, id)
+	}
 	if err != nil {
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionCategoryUpdated,
+		TargetType: models.AuditTargetCategory,
+		TargetId:   category.Id,
+		Before:     &before,
+		After:      category,
+	})
+
 	model := &CategoryModel{}
 
 	if err := copier.Copy(model, category); err != nil {
-		service.logger.Error("Error copying category to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *CategoryService) DeleteCategory(id string) *problems.Problem {
-	category := service.categoryRepository.GetCategoryById(id)
+// staleCategoryProblem returns the problem for an update based on a version of
+// the category that is no longer current, together with the current version
+func (service *CategoryService) staleCategoryProblem(ctx context.Context, id string) *problems.Problem {
+	current, problem := service.GetCategoryById(ctx, id)
+	if problem != nil {
+		return problem
+	}
+	return problems.NewPreconditionFailedProblem(current)
+}
+
+func (service *CategoryService) DeleteCategory(ctx context.Context, id string, form DeleteCategoryForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "CategoryService.DeleteCategory")
+	defer span.End()
 
-	if category == nil {
+	category, err := service.categoryRepository.GetCategoryById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
 		return problems.NewProblem(http.StatusNotFound, "Category not found.")
 	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	hasChildren, err := service.categoryRepository.CategoryHasChildren(ctx, category.Id)
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+	if hasChildren {
+		return problems.NewProblem(http.StatusConflict, "Category has subcategories. Move or delete them first.")
+	}
+
+	changes := map[string]any{}
+
+	if form.MoveTo != "" {
+		if form.MoveTo == category.Id {
+			return problems.NewValidationProblem(map[string]string{"moveTo": "Incidents cannot be moved to the category being deleted."})
+		}
+
+		target, err := service.categoryRepository.GetCategoryById(ctx, form.MoveTo)
+		if errors.Is(err, models.ErrNotFound) {
+			return problems.NewValidationProblem(map[string]string{"moveTo": "Category not found."})
+		}
+		if err != nil {
+			return repositoryProblem(service.log(ctx), err)
+		}
+
+		moved, err := service.categoryRepository.DeleteCategoryMovingIncidents(ctx, category, target.Id)
+		if err != nil {
+			return repositoryProblem(service.log(ctx), err)
+		}
+
+		changes["movedTo"] = target.Id
+		changes["movedIncidents"] = moved
+	} else {
+		count, err := service.categoryRepository.CountCategoryIncidents(ctx, category.Id)
+		if err != nil {
+			return repositoryProblem(service.log(ctx), err)
+		}
+
+		if count > 0 && !form.Force {
+			return problems.NewProblem(http.StatusConflict, localize(ctx, "Category has %d incidents. Move them to another category or force the delete.", count))
+		}
+
+		if err := service.categoryRepository.DeleteCategory(ctx, category); err != nil {
+			return repositoryProblem(service.log(ctx), err)
+		}
+
+		changes["force"] = form.Force
+		changes["incidents"] = count
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionCategoryDeleted,
+		TargetType: models.AuditTargetCategory,
+		TargetId:   category.Id,
+		Before:     category,
+		After:      changes,
+	})
+
+	return nil
+}
+
+func (service *CategoryService) ArchiveCategory(ctx context.Context, id string) (*CategoryModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.ArchiveCategory")
+	defer span.End()
 
-	if err := service.categoryRepository.DeleteCategory(category); err != nil {
-		service.logger.Error("Error deleting category: ", zap.Error(err))
+	return service.setCategoryArchived(ctx, id, true)
+}
+
+func (service *CategoryService) UnarchiveCategory(ctx context.Context, id string) (*CategoryModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.UnarchiveCategory")
+	defer span.End()
+
+	return service.setCategoryArchived(ctx, id, false)
+}
+
+// setCategoryArchived archives or restores a category. Subcategories follow their parent.
+func (service *CategoryService) setCategoryArchived(ctx context.Context, id string, archived bool) (*CategoryModel, *problems.Problem) {
+	category, err := service.categoryRepository.GetCategoryById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	action := models.AuditActionCategoryArchived
+	var archivedAt *time.Time
+
+	if archived {
+		now := time.Now()
+		archivedAt = &now
+	} else {
+		action = models.AuditActionCategoryUnarchived
+
+		if category.ParentId != nil {
+			parent, err := service.categoryRepository.GetCategoryById(ctx, *category.ParentId)
+			if err != nil && !errors.Is(err, models.ErrNotFound) {
+				return nil, repositoryProblem(service.log(ctx), err)
+			}
+			if parent != nil && parent.ArchivedAt != nil {
+				return nil, problems.NewProblem(http.StatusConflict, "Parent category is archived. Unarchive it first.")
+			}
+		}
+	}
+
+	if (category.ArchivedAt != nil) != archived {
+		if err := service.categoryRepository.SetCategoryArchivedAt(ctx, category, archivedAt); err != nil {
+			return nil, repositoryProblem(service.log(ctx), err)
+		}
+
+		service.auditService.Record(ctx, AuditRecord{
+			Action:     action,
+			TargetType: models.AuditTargetCategory,
+			TargetId:   category.Id,
+		})
+	}
+
+	model := &CategoryModel{}
+
+	if err := copier.Copy(model, category); err != nil {
+		service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	return model, nil
+}
+
+// ReorderCategories updates the display order of several categories at once
+func (service *CategoryService) ReorderCategories(ctx context.Context, form ReorderCategoriesForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "CategoryService.ReorderCategories")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
 		return problems.FromError(err)
 	}
 
+	orders := make(map[string]int64, len(form.Items))
+	ids := make([]string, 0, len(form.Items))
+
+	for _, item := range form.Items {
+		if _, ok := orders[item.Id]; ok {
+			return problems.NewValidationProblem(map[string]string{"items": localize(ctx, "Category %v is listed more than once.", item.Id)})
+		}
+		orders[item.Id] = item.Order
+		ids = append(ids, item.Id)
+	}
+
+	found, err := service.categoryRepository.GetCategoriesByIds(ctx, ids)
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+	if len(found) != len(ids) {
+		return problems.NewValidationProblem(map[string]string{"items": "One or more categories were not found."})
+	}
+
+	if err := service.categoryRepository.UpdateCategoryOrders(ctx, orders); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionCategoryReordered,
+		TargetType: models.AuditTargetCategory,
+		After:      map[string]any{"count": len(orders)},
+	})
+
 	return nil
 }
 
-func (service *CategoryService) GetPaginatedCategories(filter repositories.CategoryPaginatedFilter) (*CategoryPaginatedListModel, *problems.Problem) {
-	items, count := service.categoryRepository.GetPaginatedCategories(filter)
+func (service *CategoryService) GetPaginatedCategories(ctx context.Context, filter repositories.CategoryPaginatedFilter) (*CategoryPaginatedListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.GetPaginatedCategories")
+	defer span.End()
+
+	items, page, err := service.categoryRepository.GetPaginatedCategories(ctx, filter)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	models := make([]CategoryModel, 0, len(items))
 	for _, item := range items {
 		model := &CategoryModel{}
 		if err := copier.Copy(model, item); err != nil {
-			service.logger.Error("Error copying category to model: ", zap.Error(err))
+			service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
 			return nil, problems.FromError(err)
 		}
 		models = append(models, *model)
 	}
 
 	return &CategoryPaginatedListModel{
-		Items: models,
-		Count: count,
+		Items:      models,
+		PageResult: page,
 	}, nil
 }
 
-func (service *CategoryService) GetCategoryById(id string) (*CategoryModel, *problems.Problem) {
-	category := service.categoryRepository.GetCategoryById(id)
+func (service *CategoryService) GetCategoryById(ctx context.Context, id string) (*CategoryModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.GetCategoryById")
+	defer span.End()
 
-	if category == nil {
+	category, err := service.categoryRepository.GetCategoryById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
 		return nil, problems.NewProblem(http.StatusNotFound, "Category not found.")
 	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	model := &CategoryModel{}
 
 	if err := copier.Copy(model, category); err != nil {
-		service.logger.Error("Error copying category to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *CategoryService) GetCategoryStatistics(filter repositories.CategoryStatisticsFilter) (*repositories.CategoryStatistics, *problems.Problem) {
+// GetCategoryTree returns all categories with their subcategories nested under them
+func (service *CategoryService) GetCategoryTree(ctx context.Context, includeArchived bool) (*CategoryTreeListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.GetCategoryTree")
+	defer span.End()
+
+	items, err := service.categoryRepository.GetCategories(ctx, includeArchived)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	children := make(map[string][]CategoryTreeModel)
+	roots := make([]CategoryTreeModel, 0)
+
+	for _, item := range items {
+		model := CategoryTreeModel{Children: []CategoryTreeModel{}}
+		if err := copier.Copy(&model.CategoryModel, &item); err != nil {
+			service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+
+		if item.ParentId == nil {
+			roots = append(roots, model)
+		} else {
+			children[*item.ParentId] = append(children[*item.ParentId], model)
+		}
+	}
+
+	for i := range roots {
+		if items, ok := children[roots[i].Id]; ok {
+			roots[i].Children = items
+		}
+	}
+
+	listModel := CategoryTreeListModel(roots)
+	return &listModel, nil
+}
+
+func (service *CategoryService) GetCategoryStatistics(ctx context.Context, filter repositories.CategoryStatisticsFilter) (*repositories.CategoryStatistics, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "CategoryService.GetCategoryStatistics")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(filter); err != nil {
 		return nil, problems.FromError(err)
 	}
-	stats, err := service.categoryRepository.GetCategoryStatistics(filter)
+	stats, err := service.categoryRepository.GetCategoryStatistics(ctx, filter)
 	if err != nil {
-		service.logger.Error("Failed to get categories statistics", zap.Error(err))
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 	return stats, nil
 }
+
+// validateCategoryParent checks that a category can be placed under the given parent.
+// Categories are limited to two levels: top-level categories and their subcategories.
+func (service *CategoryService) validateCategoryParent(ctx context.Context, id string, parentId *string) *problems.Problem {
+	parentId = normalizeCategoryParentId(parentId)
+	if parentId == nil {
+		return nil
+	}
+
+	if *parentId == id {
+		return problems.NewValidationProblem(map[string]string{"parentId": "Category cannot be its own parent."})
+	}
+
+	parent, err := service.categoryRepository.GetCategoryById(ctx, *parentId)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewValidationProblem(map[string]string{"parentId": "Parent category not found."})
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if parent.ParentId != nil {
+		return problems.NewValidationProblem(map[string]string{"parentId": "Parent category must be a top-level category."})
+	}
+
+	if parent.ArchivedAt != nil {
+		return problems.NewValidationProblem(map[string]string{"parentId": "Parent category is archived."})
+	}
+
+	if id != "" {
+		hasChildren, err := service.categoryRepository.CategoryHasChildren(ctx, id)
+		if err != nil {
+			return repositoryProblem(service.log(ctx), err)
+		}
+		if hasChildren {
+			return problems.NewValidationProblem(map[string]string{"parentId": "Category with subcategories cannot be moved under another category."})
+		}
+	}
+
+	return nil
+}
+
+func (service *CategoryService) validateCategorySchema(schema map[string]any) *problems.Problem {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	if _, err := jsonschema.Parse(schema); err != nil {
+		return problems.NewValidationProblem(map[string]string{"schema": fmt.Sprintf("Schema is not valid: %v.", err)})
+	}
+
+	return nil
+}
+
+// validateCategoryKeywords returns the SMS keywords of a category in upper case
+// without repeats, and checks that no other category uses them
+func (service *CategoryService) validateCategoryKeywords(ctx context.Context, id string, keywords []string) (models.JSONList, *problems.Problem) {
+	normalized := models.JSONList{}
+	for _, keyword := range keywords {
+		keyword = strings.ToUpper(keyword)
+		if slices.Contains(smsCommands, keyword) {
+			return nil, problems.NewValidationProblem(map[string]string{"keywords": localize(ctx, "%v is reserved for SMS commands.", keyword)})
+		}
+		if !slices.Contains(normalized, keyword) {
+			normalized = append(normalized, keyword)
+		}
+	}
+	if len(normalized) == 0 {
+		return normalized, nil
+	}
+
+	categories, err := service.categoryRepository.GetCategories(ctx, true)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	for _, category := range categories {
+		if category.Id == id {
+			continue
+		}
+		for _, keyword := range normalized {
+			if slices.Contains(category.Keywords, keyword) {
+				return nil, problems.NewValidationProblem(map[string]string{"keywords": localize(ctx, "Keyword %v is already used by category %v.", keyword, category.Name)})
+			}
+		}
+	}
+
+	return normalized, nil
+}
+
+func normalizeCategoryParentId(parentId *string) *string {
+	if parentId == nil || *parentId == "" {
+		return nil
+	}
+	return parentId
+}
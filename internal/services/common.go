@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/utils"
+	"go.uber.org/zap"
+)
+
+// repositoryProblem maps an error returned by a repository to a problem.
+// Errors the client did not cause are logged, since the problem hides them.
+func repositoryProblem(logger *zap.Logger, err error) *problems.Problem {
+	problem := problems.FromError(err)
+	if problem.Status >= http.StatusInternalServerError {
+		logger.Error("Repository error", zap.Error(err))
+	}
+	return problem
+}
+
+// existenceChecker adapts a repository lookup for the utils generators. The
+// first lookup error stops the generator and is stored in err.
+func existenceChecker(ctx context.Context, exists func(context.Context, string) (bool, error), err *error) utils.ExistenceChecker {
+	return func(value string) bool {
+		found, lookupErr := exists(ctx, value)
+		if lookupErr != nil {
+			*err = lookupErr
+			return false
+		}
+		return found
+	}
+}
+
+// localize formats a message in the language of the request. Problems translate
+// fixed messages themselves, so only formatted messages need to be localized here.
+func localize(ctx context.Context, format string, args ...any) string {
+	return locales.Sprintf(locales.FromContext(ctx), format, args...)
+}
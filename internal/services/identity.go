@@ -1,16 +1,26 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jinzhu/copier"
+	"github.com/prince272/konabra/internal/builds"
 	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/metrics"
 	models "github.com/prince272/konabra/internal/models"
 	"github.com/prince272/konabra/internal/problems"
 	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
 	"github.com/prince272/konabra/pkg/humanize"
 	"github.com/prince272/konabra/pkg/otp"
 	"github.com/prince272/konabra/pkg/period"
@@ -35,6 +45,19 @@ type SignInWithRefreshTokenForm struct {
 	RefreshToken string `json:"refreshToken" validate:"required"`
 }
 
+type SignInWithCodeForm struct {
+	Username string `json:"username" validate:"required,max=256,username"`
+}
+
+type CompleteSignInWithCodeForm struct {
+	SignInWithCodeForm
+	Code string `json:"code" validate:"required"`
+}
+
+type CompleteSignInWithLinkForm struct {
+	Token string `json:"token" validate:"required"`
+}
+
 type SignOutForm struct {
 	RefreshToken string `json:"refreshToken" validate:"required"`
 	Global       bool   `json:"global"`
@@ -55,22 +78,24 @@ func (form CreateAccountForm) GetPhoneNumber() string {
 }
 
 type AccountModel struct {
-	Id                    string    `json:"id"`
-	FirstName             string    `json:"firstName"`
-	LastName              string    `json:"lastName"`
-	FullName              string    `json:"fullName"`
-	UserName              string    `json:"userName"`
-	Email                 string    `json:"email"`
-	EmailVerified         bool      `json:"emailVerified"`
-	PhoneNumber           string    `json:"phoneNumber"`
-	PhoneNumberVerified   bool      `json:"phoneNumberVerified"`
-	HasPassword           bool      `json:"hasPassword"`
-	LastPasswordChangedAt time.Time `json:"lastPasswordChangedAt"`
-	CreatedAt             time.Time `json:"createdAt"`
-	UpdatedAt             time.Time `json:"updatedAt"`
-	LastActiveAt          time.Time `json:"lastActiveAt"`
-	Roles                 []string  `json:"roles"`
-	PrimaryRole           string    `json:"primaryRole"`
+	Id                    string     `json:"id"`
+	FirstName             string     `json:"firstName"`
+	LastName              string     `json:"lastName"`
+	FullName              string     `json:"fullName"`
+	UserName              string     `json:"userName"`
+	Email                 string     `json:"email"`
+	EmailVerified         bool       `json:"emailVerified"`
+	PhoneNumber           string     `json:"phoneNumber"`
+	PhoneNumberVerified   bool       `json:"phoneNumberVerified"`
+	HasPassword           bool       `json:"hasPassword"`
+	LastPasswordChangedAt time.Time  `json:"lastPasswordChangedAt"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	UpdatedAt             time.Time  `json:"updatedAt"`
+	LastActiveAt          time.Time  `json:"lastActiveAt"`
+	Roles                 []string   `json:"roles"`
+	PrimaryRole           string     `json:"primaryRole"`
+	IsServiceAccount      bool       `json:"isServiceAccount"`
+	ErasureScheduledAt    *time.Time `json:"erasureScheduledAt"`
 }
 
 type AccountWithTokenModel struct {
@@ -78,6 +103,13 @@ type AccountWithTokenModel struct {
 	helpers.JwtTokenModel
 }
 
+// UpdateAccountForm holds the profile fields users can change themselves. The
+// email address and phone number are changed with ChangeAccount instead.
+type UpdateAccountForm struct {
+	FirstName string `json:"firstName" validate:"required,max=256"`
+	LastName  string `json:"lastName" validate:"required,max=256"`
+}
+
 type VerifyAccountForm struct {
 	Username string `json:"username" validate:"required,max=256,username"`
 }
@@ -134,6 +166,7 @@ const (
 	PurposeVerifyAccount = "VerifyAccount"
 	PurposeChangeAccount = "ChangeAccount"
 	PurposeResetPassword = "ResetPassword"
+	PurposeSignIn        = "SignIn"
 )
 
 type CreateRoleForm struct {
@@ -143,26 +176,76 @@ type CreateRoleForm struct {
 
 type UpdateRoleForm struct {
 	CreateRoleForm
+	ExpectedVersion *int64 `json:"-"` // Read from the If-Match header, the update fails if the role has another version
 }
 
 type RoleModel struct {
-	Id          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Id          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Version     int64     `json:"version"`
+}
+
+// LastModified returns when the role last changed
+func (model RoleModel) LastModified() time.Time {
+	return model.UpdatedAt
+}
+
+// ResourceVersion returns the version of the role, which leads its ETag
+func (model RoleModel) ResourceVersion() int64 {
+	return model.Version
 }
 
 type RolePaginatedListModel struct {
 	Items []RoleModel `json:"items"`
-	Count int64       `json:"count"`
+	repositories.PageResult
 }
 
 type RoleListModel []RoleModel
 
+type CreateApiKeyForm struct {
+	Name      string     `json:"name" validate:"required,max=256"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type ApiKeyModel struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type ApiKeyWithSecretModel struct {
+	ApiKeyModel
+	Key string `json:"key"`
+}
+
+type ApiKeyListModel []ApiKeyModel
+
+type CreateServiceAccountForm struct {
+	Name  string   `json:"name" validate:"required,max=256"`
+	Roles []string `json:"roles"`
+}
+
+type AccountListModel []AccountModel
+
 type IdentityService struct {
 	identityRepository *repositories.IdentityRepository
 	jwtHelper          *helpers.JwtHelper
 	validator          *helpers.Validator
 	state              *helpers.State
+	codeStore          *helpers.CodeStore
+	challengeStore     *helpers.ChallengeStore
+	smtp               *helpers.Smtp
+	smsSender          helpers.SmsSender
+	auditService       *AuditService
+	metrics            *metrics.Metrics
+	config             *builds.Config
 	logger             *zap.Logger
 }
 
@@ -171,17 +254,38 @@ func NewIdentityService(
 	jwtHelper *helpers.JwtHelper,
 	validator *helpers.Validator,
 	state *helpers.State,
+	codeStore *helpers.CodeStore,
+	challengeStore *helpers.ChallengeStore,
+	smtp *helpers.Smtp,
+	smsSender helpers.SmsSender,
+	auditService *AuditService,
+	metrics *metrics.Metrics,
+	config *builds.Config,
 	logger *zap.Logger) *IdentityService {
 	return &IdentityService{
 		identityRepository,
 		jwtHelper,
 		validator,
 		state,
+		codeStore,
+		challengeStore,
+		smtp,
+		smsSender,
+		auditService,
+		metrics,
+		config,
 		logger,
 	}
 }
 
-func (service *IdentityService) CreateAccount(form CreateAccountForm) (*AccountWithTokenModel, *problems.Problem) {
+// log returns the request-scoped logger carried by ctx
+func (service *IdentityService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+func (service *IdentityService) CreateAccount(ctx context.Context, form CreateAccountForm) (*AccountWithTokenModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CreateAccount")
+	defer span.End()
 
 	// Validate form
 	if err := service.validator.ValidateStruct(form); err != nil {
@@ -189,14 +293,23 @@ func (service *IdentityService) CreateAccount(form CreateAccountForm) (*AccountW
 	}
 
 	accountType := GetAccountType(form.Username)
-	if usernameExists := service.identityRepository.UsernameExists(form.Username); usernameExists {
-		return nil, problems.NewValidationProblem(map[string]string{"username": fmt.Sprintf("%v already exists.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	usernameExists, err := service.identityRepository.UsernameExists(ctx, form.Username)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	if usernameExists {
+		return nil, problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v already exists.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
 	}
 
 	if form.ValidateOnly {
 		return nil, nil
 	}
 
+	userName := utils.GenerateSlug([]string{form.FirstName, form.LastName}, existenceChecker(ctx, service.identityRepository.UserNameExists, &err))
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
 	currentTime := time.Now()
 
 	user := &models.User{
@@ -207,7 +320,7 @@ func (service *IdentityService) CreateAccount(form CreateAccountForm) (*AccountW
 		EmailVerified:         false,
 		PhoneNumber:           form.GetPhoneNumber(),
 		PhoneNumberVerified:   false,
-		UserName:              utils.GenerateSlug([]string{form.FirstName, form.LastName}, service.identityRepository.UserNameExists),
+		UserName:              userName,
 		PasswordHash:          utils.MustHashPassword(form.Password),
 		HasPassword:           true,
 		SecurityStamp:         uuid.New().String(),
@@ -216,16 +329,27 @@ func (service *IdentityService) CreateAccount(form CreateAccountForm) (*AccountW
 		Status:                models.UserStatusActive,
 	}
 
-	if err := service.identityRepository.CreateUser(user); err != nil {
-		service.logger.Error("Error creating user: ", zap.Error(err))
-		return nil, problems.FromError(err)
+	if err := service.identityRepository.CreateUser(ctx, user); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
-	if err := service.identityRepository.AddUserToRoles(user, []string{models.RoleReporter}...); err != nil {
-		service.logger.Error("Error adding user to roles: ", zap.Error(err))
+	if err := service.identityRepository.AddUserToRoles(ctx, user, []string{models.RoleReporter}...); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.recordPasswordHistory(ctx, user); err != nil {
+		service.log(ctx).Error("Error recording password history: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountCreated,
+		ActorId:    user.Id,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		After:      user,
+	})
+
 	// Create JWT token
 	token, err := service.jwtHelper.CreateToken(user.Id, map[string]any{
 		"email":       user.Email,
@@ -234,26 +358,28 @@ func (service *IdentityService) CreateAccount(form CreateAccountForm) (*AccountW
 	})
 
 	if err != nil {
-		service.logger.Error("Error creating token: ", zap.Error(err))
+		service.log(ctx).Error("Error creating token: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	model := &AccountWithTokenModel{}
 
 	if err := copier.Copy(model, user); err != nil {
-		service.logger.Error("Error copying user to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	if err := copier.Copy(model, token); err != nil {
-		service.logger.Error("Error copying token to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying token to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IdentityService) SignIn(form SignInForm) (*AccountWithTokenModel, *problems.Problem) {
+func (service *IdentityService) SignIn(ctx context.Context, form SignInForm) (*AccountWithTokenModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.SignIn")
+	defer span.End()
 
 	// Validate form
 	if err := service.validator.ValidateStruct(form); err != nil {
@@ -262,49 +388,60 @@ func (service *IdentityService) SignIn(form SignInForm) (*AccountWithTokenModel,
 
 	// Check if username exists
 	accountType := GetAccountType(form.Username)
-	var user *models.User
-	if user = service.identityRepository.GetUserByUsername(form.Username); user == nil {
-		return nil, problems.NewValidationProblem(map[string]string{"username": fmt.Sprintf("%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	user, err := service.identityRepository.GetUserByUsername(ctx, form.Username)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	if user == nil {
+		service.auditService.Record(ctx, AuditRecord{
+			Action:     models.AuditActionAccountSignInFailed,
+			TargetType: models.AuditTargetUser,
+			After:      map[string]any{"username": form.Username, "method": "password"},
+		})
+		service.metrics.SignInFailures.WithLabelValues("password").Inc()
+		return nil, problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
 	}
 
 	// Check if password is correct
 	if !utils.CheckPasswordHash(form.Password, user.PasswordHash) {
+		service.auditService.Record(ctx, AuditRecord{
+			Action:     models.AuditActionAccountSignInFailed,
+			TargetType: models.AuditTargetUser,
+			TargetId:   user.Id,
+			After:      map[string]any{"method": "password"},
+		})
+		service.metrics.SignInFailures.WithLabelValues("password").Inc()
 		return nil, problems.NewValidationProblem(map[string]string{"password": "Password is incorrect."})
 	}
 
-	if err := service.jwtHelper.RevokeExpiredTokens(user.Id); err != nil {
-		service.logger.Error("Error revoking expired tokens: ", zap.Error(err))
-		return nil, problems.FromError(err)
-	}
+	return service.signInUser(ctx, user, "password")
+}
 
-	// Create JWT token
-	token, err := service.jwtHelper.CreateToken(user.Id, map[string]any{
-		"email":       user.Email,
-		"phoneNumber": user.PhoneNumber,
-		"roles":       user.Roles(),
-	})
+// IssueToken signs in a user without credentials. It is meant for trusted
+// operator tooling such as the command-line interface.
+func (service *IdentityService) IssueToken(ctx context.Context, username string) (*AccountWithTokenModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.IssueToken")
+	defer span.End()
 
-	if err != nil {
-		service.logger.Error("Error creating token: ", zap.Error(err))
-		return nil, problems.FromError(err)
+	accountType := GetAccountType(username)
+	user, err := service.identityRepository.GetUserByUsername(ctx, username)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
 	}
-
-	model := &AccountWithTokenModel{}
-
-	if err := copier.Copy(model, user); err != nil {
-		service.logger.Error("Error copying user to model: ", zap.Error(err))
-		return nil, problems.FromError(err)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
-	if err := copier.Copy(model, token); err != nil {
-		service.logger.Error("Error copying token to model: ", zap.Error(err))
-		return nil, problems.FromError(err)
+	if user.Status != models.UserStatusActive {
+		return nil, problems.NewProblem(http.StatusForbidden, "User account is not active.")
 	}
 
-	return model, nil
+	return service.signInUser(ctx, user, "cli")
 }
 
-func (service *IdentityService) SignInWithRefreshToken(form SignInWithRefreshTokenForm) (*AccountWithTokenModel, *problems.Problem) {
+func (service *IdentityService) SignInWithRefreshToken(ctx context.Context, form SignInWithRefreshTokenForm) (*AccountWithTokenModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.SignInWithRefreshToken")
+	defer span.End()
 
 	// Validate form
 	if err := service.validator.ValidateStruct(form); err != nil {
@@ -318,14 +455,17 @@ func (service *IdentityService) SignInWithRefreshToken(form SignInWithRefreshTok
 	}
 
 	// Lookup user
-	user := service.identityRepository.GetUserById(claims["sub"].(string))
-	if user == nil {
+	user, err := service.identityRepository.GetUserById(ctx, claims["sub"].(string))
+	if errors.Is(err, models.ErrNotFound) {
 		return nil, problems.NewValidationProblem(map[string]string{"refreshToken": "User not found."})
 	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	// Revoke token
 	if err := service.jwtHelper.RevokeToken(user.Id, form.RefreshToken); err != nil {
-		service.logger.Error("Error revoking token: ", zap.Error(err))
+		service.log(ctx).Error("Error revoking token: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
@@ -337,338 +477,841 @@ func (service *IdentityService) SignInWithRefreshToken(form SignInWithRefreshTok
 	})
 
 	if err != nil {
-		service.logger.Error("Error creating token: ", zap.Error(err))
+		service.log(ctx).Error("Error creating token: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	model := &AccountWithTokenModel{}
 
 	if err := copier.Copy(model, user); err != nil {
-		service.logger.Error("Error copying user to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	if err := copier.Copy(model, token); err != nil {
-		service.logger.Error("Error copying token to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying token to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IdentityService) SignOut(userId string, form SignOutForm) *problems.Problem {
-	// Validate form
+func (service *IdentityService) SignInWithCode(ctx context.Context, form SignInWithCodeForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.SignInWithCode")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return problems.FromError(err)
 	}
 
-	if form.Global {
-		if err := service.jwtHelper.RevokeAllTokens(userId); err != nil {
-			service.logger.Error("Error revoking all tokens: ", zap.Error(err))
-			return problems.FromError(err)
-		}
-	} else {
-		if err := service.jwtHelper.RevokeToken(userId, form.RefreshToken); err != nil {
-			service.logger.Error("Error revoking token: ", zap.Error(err))
-			return problems.FromError(err)
-		}
+	accountType := GetAccountType(form.Username)
+	user, err := service.identityRepository.GetUserByUsername(ctx, form.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
 	}
 
-	return nil
-}
-
-func (service *IdentityService) GetAccountByUserId(userId string) (*AccountModel, *problems.Problem) {
-	user := service.identityRepository.GetUserById(userId)
+	if accountType != AccountTypeEmail && accountType != AccountTypePhoneNumber {
+		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+	}
 
-	if user == nil {
-		return nil, problems.NewProblem(http.StatusNotFound, "User not found.")
+	code, problem := service.issueCode(ctx, PurposeSignIn, user.Id)
+	if problem != nil {
+		return problem
 	}
 
-	model := &AccountModel{}
+	message := localize(ctx, "Your sign-in code is %v.", code)
+	if accountType == AccountTypeEmail {
+		link, err := service.createSignInLink(user)
+		if err != nil {
+			service.log(ctx).Error("Sign-in link generation error: ", zap.Error(err))
+			return problems.FromError(err)
+		}
 
-	if err := copier.Copy(model, user); err != nil {
-		service.logger.Error("Error copying user to model: ", zap.Error(err))
-		return nil, problems.FromError(err)
+		message = localize(ctx, "Your sign-in code is %v. You can also sign in with this link: %v", code, link)
 	}
 
-	return model, nil
+	return service.sendCode(ctx, accountType, form.Username, "Sign in", message)
 }
 
-func (service *IdentityService) VerifyAccount(form VerifyAccountForm) *problems.Problem {
+func (service *IdentityService) CompleteSignInWithCode(ctx context.Context, form CompleteSignInWithCodeForm) (*AccountWithTokenModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CompleteSignInWithCode")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
-		return problems.FromError(err)
+		return nil, problems.FromError(err)
 	}
 
 	accountType := GetAccountType(form.Username)
-	user := service.identityRepository.GetUserByUsername(form.Username)
-	if user == nil {
-		return problems.NewValidationProblem(map[string]string{"username": fmt.Sprintf("%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	user, err := service.identityRepository.GetUserByUsername(ctx, form.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
 	}
-
-	secret := fmt.Sprintf("%v-%v-%v", user.Id, PurposeVerifyAccount, user.SecurityStamp)
-
-	tp, err := otp.NewCodeProvider(secret)
 	if err != nil {
-		service.logger.Error("Code provider error: ", zap.Error(err))
-		return problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
-	code, err := tp.GenerateCode()
-
-	if err != nil {
-		service.logger.Error("Code generation error: ", zap.Error(err))
-		return problems.FromError(err)
+	if problem := service.verifyCode(ctx, PurposeSignIn, user.Id, form.Code, true); problem != nil {
+		service.auditService.Record(ctx, AuditRecord{
+			Action:     models.AuditActionAccountSignInFailed,
+			TargetType: models.AuditTargetUser,
+			TargetId:   user.Id,
+			After:      map[string]any{"method": "code"},
+		})
+		service.metrics.SignInFailures.WithLabelValues("code").Inc()
+		return nil, problem
 	}
 
 	if accountType == AccountTypeEmail {
-		service.logger.Debug("Email verification code: " + code)
-
+		user.EmailVerified = true
 	} else if accountType == AccountTypePhoneNumber {
-		service.logger.Debug("Phone verification code: " + code)
-	} else {
-		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+		user.PhoneNumberVerified = true
 	}
 
-	return nil
+	return service.signInUser(ctx, user, "code")
 }
 
-func (service *IdentityService) CompleteVerifyAccount(form CompleteVerifyAccountForm) *problems.Problem {
+func (service *IdentityService) CompleteSignInWithLink(ctx context.Context, form CompleteSignInWithLinkForm) (*AccountWithTokenModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CompleteSignInWithLink")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
-		return problems.FromError(err)
+		return nil, problems.FromError(err)
 	}
 
-	accountType := GetAccountType(form.Username)
-	user := service.identityRepository.GetUserByUsername(form.Username)
-	if user == nil {
-		return problems.NewValidationProblem(map[string]string{"username": fmt.Sprintf("%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	tp, err := otp.NewTokenProvider(service.config.EncryptKey)
+	if err != nil {
+		service.log(ctx).Error("Token provider error: ", zap.Error(err))
+		return nil, problems.FromError(err)
 	}
 
-	secret := fmt.Sprintf("%v-%v-%v", user.Id, PurposeVerifyAccount, user.SecurityStamp)
-
-	tp, err := otp.NewCodeProvider(secret)
+	payload, err := tp.ValidateToken(form.Token)
 	if err != nil {
-		service.logger.Error("Code provider error: ", zap.Error(err))
-		return problems.FromError(err)
+		service.metrics.SignInFailures.WithLabelValues("link").Inc()
+		return nil, problems.NewValidationProblem(map[string]string{"token": "Sign-in link is invalid or has expired."})
 	}
 
-	valid, err := tp.ValidateCode(form.Code)
+	userId, _ := payload.Data["sub"].(string)
+	purpose, _ := payload.Data["purpose"].(string)
+	stamp, _ := payload.Data["stamp"].(string)
 
+	user, err := service.identityRepository.GetUserById(ctx, userId)
+	if errors.Is(err, models.ErrNotFound) {
+		service.metrics.SignInFailures.WithLabelValues("link").Inc()
+		return nil, problems.NewValidationProblem(map[string]string{"token": "Sign-in link is invalid or has expired."})
+	}
 	if err != nil {
-		service.logger.Error("Code validation error: ", zap.Error(err))
-		return problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
-	if !valid {
-		return problems.NewValidationProblem(map[string]string{"code": "Verification code is invalid."})
+	if purpose != PurposeSignIn || stamp != user.SecurityStamp {
+		service.metrics.SignInFailures.WithLabelValues("link").Inc()
+		return nil, problems.NewValidationProblem(map[string]string{"token": "Sign-in link is invalid or has expired."})
 	}
 
-	if accountType == AccountTypeEmail {
-		user.EmailVerified = true
-	} else if accountType == AccountTypePhoneNumber {
-		user.PhoneNumberVerified = true
-
-	} else {
-		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+	if !service.codeStore.Consume(PurposeSignIn, user.Id, form.Token, time.Until(payload.Expiry)) {
+		service.metrics.SignInFailures.WithLabelValues("link").Inc()
+		return nil, problems.NewValidationProblem(map[string]string{"token": "Sign-in link has already been used."})
 	}
 
-	user.SecurityStamp = uuid.New().String()
-	user.UpdatedAt = time.Now()
-
-	if err := service.identityRepository.UpdateUser(user); err != nil {
-		service.logger.Error("User update error: ", zap.Error(err))
-		return problems.FromError(err)
-	}
+	user.EmailVerified = true
 
-	return nil
+	return service.signInUser(ctx, user, "link")
 }
 
-func (service *IdentityService) DeleteAccount(userId string) *problems.Problem {
-	user := service.identityRepository.GetUserById(userId)
+// sendCode delivers a message carrying a one-time code by email or SMS. The
+// message is also logged in development, where no SMTP server or SMS gateway is
+// usually available, under a field the log redaction lets through.
+func (service *IdentityService) sendCode(ctx context.Context, accountType AccountType, to string, subject string, message string) *problems.Problem {
+	if service.config.IsDevelopment() {
+		service.log(ctx).Debug("Code issued", zap.String("to", to), zap.String(logging.DevOnlyField, message))
+	}
 
-	if user == nil {
-		return problems.NewProblem(http.StatusNotFound, "User not found.")
+	var err error
+	if accountType == AccountTypeEmail {
+		err = service.smtp.Send(ctx, to, locales.Translate(locales.FromContext(ctx), subject), message)
+	} else {
+		if phoneNumber, ok := helpers.NormalizePhoneNumber(to, service.config.PhoneDefaultRegion); ok {
+			to = phoneNumber
+		}
+		err = service.smsSender.Send(ctx, to, message)
 	}
 
-	if err := service.identityRepository.DeleteUser(user); err != nil {
-		service.logger.Error("User deletion error: ", zap.Error(err))
-		return problems.FromError(err)
+	if err != nil {
+		if service.config.IsDevelopment() {
+			service.log(ctx).Warn("Failed to send code, it was logged instead", zap.Error(err))
+			return nil
+		}
+		service.log(ctx).Error("Failed to send code", zap.Error(err))
+		return problems.NewProblem(http.StatusServiceUnavailable, "The code could not be sent. Please try again later.")
 	}
 
 	return nil
 }
 
-func (service *IdentityService) ChangeAccount(userId string, form ChangeAccountForm) *problems.Problem {
-	if err := service.validator.ValidateStruct(form); err != nil {
-		return problems.FromError(err)
+func (service *IdentityService) createSignInLink(user *models.User) (string, error) {
+	tp, err := otp.NewTokenProvider(service.config.EncryptKey)
+	if err != nil {
+		return "", err
 	}
 
-	accountType := GetAccountType(form.NewUsername)
-	user := service.identityRepository.GetUserById(userId)
-
-	if user == nil {
-		return problems.NewProblem(http.StatusNotFound, "User not found.")
+	token, err := tp.GenerateToken(map[string]any{
+		"sub":     user.Id,
+		"purpose": PurposeSignIn,
+		"stamp":   user.SecurityStamp,
+	})
+	if err != nil {
+		return "", err
 	}
 
-	if user.Email == form.NewUsername || user.PhoneNumber == form.NewUsername {
-		return problems.NewValidationProblem(map[string]string{
-			"newUsername": fmt.Sprintf("%v is already associated with your account.", humanize.Humanize(string(accountType), humanize.SentenceCase)),
-		})
-	}
+	return fmt.Sprintf("%v/account/signin/link?token=%v", service.config.WebUrl, url.QueryEscape(token)), nil
+}
 
-	secret := fmt.Sprintf("%v-%v-%v-%v", user.Id, PurposeChangeAccount, user.SecurityStamp, form.NewUsername)
+func (service *IdentityService) challengePolicy(purpose string) helpers.ChallengePolicy {
+	policy := helpers.ChallengePolicy{
+		MaxAttempts: service.config.CodeMaxAttempts,
+		Cooldown:    service.config.CodeResendCooldown,
+		Lockout:     service.config.CodeLockout,
+	}
 
-	tp, err := otp.NewCodeProvider(secret)
-	if err != nil {
-		service.logger.Error("Code provider error: ", zap.Error(err))
-		return problems.FromError(err)
+	switch purpose {
+	case PurposeVerifyAccount:
+		policy.TTL = service.config.CodeTtlVerifyAccount
+	case PurposeChangeAccount:
+		policy.TTL = service.config.CodeTtlChangeAccount
+	case PurposeResetPassword:
+		policy.TTL = service.config.CodeTtlResetPassword
+	case PurposeSignIn:
+		policy.TTL = service.config.CodeTtlSignIn
 	}
 
-	code, err := tp.GenerateCode()
+	return policy
+}
 
+// issueCode creates a single-use verification code for the purpose and subject
+func (service *IdentityService) issueCode(ctx context.Context, purpose, subject string) (string, *problems.Problem) {
+	code, err := service.challengeStore.Issue(purpose, subject, service.challengePolicy(purpose))
 	if err != nil {
-		service.logger.Error("Code generation error: ", zap.Error(err))
-		return problems.FromError(err)
+		return "", service.challengeProblem(ctx, err)
 	}
+	service.metrics.OtpsSent.WithLabelValues(purpose).Inc()
+	return code, nil
+}
 
-	if accountType == AccountTypeEmail {
-		service.logger.Debug("Email change verification code: " + code)
-	} else if accountType == AccountTypePhoneNumber {
-		service.logger.Debug("Phone change verification code: " + code)
+// verifyCode checks a verification code, invalidating it when consume is set
+func (service *IdentityService) verifyCode(ctx context.Context, purpose, subject, code string, consume bool) *problems.Problem {
+	policy := service.challengePolicy(purpose)
+
+	var err error
+	if consume {
+		err = service.challengeStore.Verify(purpose, subject, code, policy)
 	} else {
-		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+		err = service.challengeStore.Check(purpose, subject, code, policy)
 	}
 
+	if err != nil {
+		return service.challengeProblem(ctx, err)
+	}
 	return nil
 }
 
-func (service *IdentityService) CompleteChangeAccount(userId string, form CompleteChangeAccountForm) *problems.Problem {
-	if err := service.validator.ValidateStruct(form); err != nil {
+func (service *IdentityService) challengeProblem(ctx context.Context, err error) *problems.Problem {
+	switch {
+	case errors.Is(err, helpers.ErrChallengeInvalid):
+		return problems.NewValidationProblem(map[string]string{"code": "Verification code is invalid or has expired."})
+	case errors.Is(err, helpers.ErrChallengeLocked):
+		return problems.NewProblem(http.StatusTooManyRequests, "Too many failed attempts. Please try again later.")
+	case errors.Is(err, helpers.ErrChallengeCooldown):
+		return problems.NewProblem(http.StatusTooManyRequests, "A code was sent recently. Please wait before requesting another.")
+	default:
+		service.log(ctx).Error("Verification challenge error: ", zap.Error(err))
 		return problems.FromError(err)
 	}
+}
 
-	accountType := GetAccountType(form.NewUsername)
-	user := service.identityRepository.GetUserById(userId)
+// signInUser records the user's activity and issues a new token pair
+func (service *IdentityService) signInUser(ctx context.Context, user *models.User, method string) (*AccountWithTokenModel, *problems.Problem) {
+	user.LastActiveAt = time.Now()
 
-	if user == nil {
-		return problems.NewProblem(http.StatusNotFound, "User not found.")
-	}
+	erasureCancelled := user.ErasureScheduledAt != nil
+	user.ErasureScheduledAt = nil
 
-	if user.Email == form.NewUsername || user.PhoneNumber == form.NewUsername {
-		return problems.NewValidationProblem(map[string]string{"newUsername": fmt.Sprintf("%v is already verified.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
-	secret := fmt.Sprintf("%v-%v-%v-%v", user.Id, PurposeChangeAccount, user.SecurityStamp, form.NewUsername)
-
-	tp, err := otp.NewCodeProvider(secret)
-	if err != nil {
-		service.logger.Error("Code provider error: ", zap.Error(err))
-		return problems.FromError(err)
+	if err := service.jwtHelper.RevokeExpiredTokens(user.Id); err != nil {
+		service.log(ctx).Error("Error revoking expired tokens: ", zap.Error(err))
+		return nil, problems.FromError(err)
 	}
 
-	valid, err := tp.ValidateCode(form.Code)
-	if err != nil {
-		service.logger.Error("Code validation error: ", zap.Error(err))
-		return problems.FromError(err)
-	}
-	if !valid {
-		return problems.NewValidationProblem(map[string]string{"code": "Verification code is invalid."})
+	if erasureCancelled {
+		service.auditService.Record(ctx, AuditRecord{
+			Action:     models.AuditActionAccountErasureCancelled,
+			ActorId:    user.Id,
+			TargetType: models.AuditTargetUser,
+			TargetId:   user.Id,
+		})
 	}
 
-	if accountType == AccountTypeEmail {
-		user.Email = form.NewUsername
-		user.EmailVerified = true
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountSignedIn,
+		ActorId:    user.Id,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		After:      map[string]any{"method": method},
+	})
+	service.metrics.SignIns.WithLabelValues(method).Inc()
 
-	} else if accountType == AccountTypePhoneNumber {
-		user.PhoneNumber = form.NewUsername
-		user.PhoneNumberVerified = true
+	token, err := service.jwtHelper.CreateToken(user.Id, map[string]any{
+		"email":       user.Email,
+		"phoneNumber": user.PhoneNumber,
+		"roles":       user.Roles(),
+	})
 
-	} else {
-		return problems.NewValidationProblem(map[string]string{"newUsername": "Username is not a valid email or phone number."})
+	if err != nil {
+		service.log(ctx).Error("Error creating token: ", zap.Error(err))
+		return nil, problems.FromError(err)
 	}
 
-	user.SecurityStamp = uuid.New().String()
-	user.UpdatedAt = time.Now()
+	model := &AccountWithTokenModel{}
 
-	if err := service.identityRepository.UpdateUser(user); err != nil {
-		service.logger.Error("User update error: ", zap.Error(err))
-		return problems.FromError(err)
+	if err := copier.Copy(model, user); err != nil {
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
 	}
 
-	return nil
-}
-
-func (service *IdentityService) ResetPassword(form ResetPasswordForm) *problems.Problem {
-	if err := service.validator.ValidateStruct(form); err != nil {
-		return problems.FromError(err)
+	if err := copier.Copy(model, token); err != nil {
+		service.log(ctx).Error("Error copying token to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
 	}
 
-	accountType := GetAccountType(form.Username)
-	user := service.identityRepository.GetUserByUsername(form.Username)
+	return model, nil
+}
 
-	if user == nil {
-		return problems.NewValidationProblem(map[string]string{"username": fmt.Sprintf("%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
-	}
+// CreateVerifiedAccount creates an account whose username is already verified
+// and adds it to the given roles. It is meant for trusted operator tooling such
+// as the command-line interface.
+func (service *IdentityService) CreateVerifiedAccount(ctx context.Context, form CreateAccountForm, roleNames ...string) (*AccountModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CreateVerifiedAccount")
+	defer span.End()
 
-	secret := fmt.Sprintf("%v-%v-%v", user.Id, PurposeResetPassword, user.SecurityStamp)
+	form.ValidateOnly = false
 
-	tp, err := otp.NewCodeProvider(secret)
-	if err != nil {
-		service.logger.Error("Code provider error: ", zap.Error(err))
-		return problems.FromError(err)
+	account, problem := service.CreateAccount(ctx, form)
+	if problem != nil {
+		return nil, problem
 	}
 
-	code, err := tp.GenerateCode()
+	user, err := service.identityRepository.GetUserById(ctx, account.Id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "User not found.")
+	}
 	if err != nil {
-		service.logger.Error("Code generation error: ", zap.Error(err))
-		return problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
-	if accountType == AccountTypeEmail {
-		service.logger.Debug("Email reset password code: " + code)
-	} else if accountType == AccountTypePhoneNumber {
+	before := *user
 
-		service.logger.Debug("Phone reset password code: " + code)
-	} else {
-		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+	switch GetAccountType(form.Username) {
+	case AccountTypeEmail:
+		user.EmailVerified = true
+	case AccountTypePhoneNumber:
+		user.PhoneNumberVerified = true
 	}
 
-	return nil
-}
-
-func (service *IdentityService) CompleteResetPassword(form CompleteResetPasswordForm) *problems.Problem {
-	if err := service.validator.ValidateStruct(form); err != nil {
-		return problems.FromError(err)
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
-	accountType := GetAccountType(form.Username)
-	user := service.identityRepository.GetUserByUsername(form.Username)
+	if len(roleNames) > 0 {
+		if err := service.identityRepository.AddUserToRoles(ctx, user, roleNames...); err != nil {
+			return nil, repositoryProblem(service.log(ctx), err)
+		}
 
-	if user == nil {
-		return problems.NewValidationProblem(map[string]string{"username": fmt.Sprintf("%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+		user, err = service.identityRepository.GetUserById(ctx, user.Id)
+		if errors.Is(err, models.ErrNotFound) {
+			return nil, problems.NewProblem(http.StatusNotFound, "User not found.")
+		}
+		if err != nil {
+			return nil, repositoryProblem(service.log(ctx), err)
+		}
 	}
 
-	secret := fmt.Sprintf("%v-%v-%v", user.Id, PurposeResetPassword, user.SecurityStamp)
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountChanged,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		Before:     map[string]any{"emailVerified": before.EmailVerified, "phoneNumberVerified": before.PhoneNumberVerified, "roles": before.Roles()},
+		After:      map[string]any{"emailVerified": user.EmailVerified, "phoneNumberVerified": user.PhoneNumberVerified, "roles": user.Roles()},
+	})
 
-	tp, err := otp.NewCodeProvider(secret)
-	if err != nil {
-		service.logger.Error("Code provider error: ", zap.Error(err))
-		return problems.FromError(err)
+	model := &AccountModel{}
+
+	if err := copier.Copy(model, user); err != nil {
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
 	}
 
-	valid, err := tp.ValidateCode(form.Code)
+	return model, nil
+}
 
-	if err != nil {
-		service.logger.Error("Code validation error: ", zap.Error(err))
-		return problems.FromError(err)
-	}
-	if !valid {
-		return problems.NewValidationProblem(map[string]string{"code": "Verification code is invalid."})
-	}
+// GetOrCreatePhoneAccount returns the account of a phone number, creating one for
+// callers who report through a phone channel before they have signed up. The
+// number is taken as verified, since the mobile network identified the caller.
+func (service *IdentityService) GetOrCreatePhoneAccount(ctx context.Context, phoneNumber string) (*AccountModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetOrCreatePhoneAccount")
+	defer span.End()
 
-	if form.ValidateOnly {
-		return nil
+	user, err := service.identityRepository.GetUserByUsername(ctx, phoneNumber)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
-	currentTime := time.Now()
+	if user == nil {
+		user = &models.User{
+			Id:                  uuid.New().String(),
+			PhoneNumber:         phoneNumber,
+			PhoneNumberVerified: true,
+			SecurityStamp:       uuid.New().String(),
+			LastActiveAt:        time.Now(),
+			Status:              models.UserStatusActive,
+		}
+
+		// The phone number is left out of the name, which other users can see
+		user.UserName = utils.GenerateSlug([]string{"reporter", user.Id[:8]}, existenceChecker(ctx, service.identityRepository.UserNameExists, &err))
+		if err != nil {
+			return nil, repositoryProblem(service.log(ctx), err)
+		}
+
+		if err := service.identityRepository.CreateUser(ctx, user); err != nil {
+			if !errors.Is(err, models.ErrConflict) {
+				return nil, repositoryProblem(service.log(ctx), err)
+			}
+
+			// Two messages of a new sender handled at once both try to create its
+			// account, the one that loses uses the account of the other
+			existing, lookupErr := service.identityRepository.GetUserByUsername(ctx, phoneNumber)
+			if errors.Is(lookupErr, models.ErrNotFound) {
+				return nil, repositoryProblem(service.log(ctx), err)
+			} else if lookupErr != nil {
+				return nil, repositoryProblem(service.log(ctx), lookupErr)
+			}
+			user = existing
+		} else {
+			if err := service.identityRepository.AddUserToRoles(ctx, user, []string{models.RoleReporter}...); err != nil {
+				return nil, repositoryProblem(service.log(ctx), err)
+			}
+
+			service.auditService.Record(ctx, AuditRecord{
+				Action:     models.AuditActionAccountCreated,
+				ActorId:    user.Id,
+				TargetType: models.AuditTargetUser,
+				TargetId:   user.Id,
+				After:      user,
+			})
+		}
+	}
+
+	if user.Status != models.UserStatusActive {
+		return nil, problems.NewProblem(http.StatusForbidden, "User account is not active.")
+	}
+
+	model := &AccountModel{}
+
+	if err := copier.Copy(model, user); err != nil {
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	return model, nil
+}
+
+func (service *IdentityService) SignOut(ctx context.Context, userId string, form SignOutForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.SignOut")
+	defer span.End()
+
+	// Validate form
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return problems.FromError(err)
+	}
+
+	if form.Global {
+		if err := service.jwtHelper.RevokeAllTokens(userId); err != nil {
+			service.log(ctx).Error("Error revoking all tokens: ", zap.Error(err))
+			return problems.FromError(err)
+		}
+	} else {
+		if err := service.jwtHelper.RevokeToken(userId, form.RefreshToken); err != nil {
+			service.log(ctx).Error("Error revoking token: ", zap.Error(err))
+			return problems.FromError(err)
+		}
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountSignedOut,
+		ActorId:    userId,
+		TargetType: models.AuditTargetUser,
+		TargetId:   userId,
+		After:      map[string]any{"global": form.Global},
+	})
+
+	return nil
+}
+
+func (service *IdentityService) GetAccountByUserId(ctx context.Context, userId string) (*AccountModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetAccountByUserId")
+	defer span.End()
+
+	user, err := service.identityRepository.GetUserById(ctx, userId)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "User not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	model := &AccountModel{}
+
+	if err := copier.Copy(model, user); err != nil {
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	return model, nil
+}
+
+// PatchAccount applies a JSON merge patch to the profile of an account. Only
+// the fields named by the patch are validated.
+func (service *IdentityService) PatchAccount(ctx context.Context, userId string, patch map[string]any) (*AccountModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.PatchAccount")
+	defer span.End()
+
+	user, err := service.identityRepository.GetUserById(ctx, userId)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "User not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	form := UpdateAccountForm{}
+	if err := copier.Copy(&form, user); err != nil {
+		service.log(ctx).Error("Error copying user to form: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+	if err := helpers.ApplyMergePatch(&form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+	if err := service.validator.ValidatePatch(form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	before := map[string]any{"firstName": user.FirstName, "lastName": user.LastName}
+
+	user.FirstName = form.FirstName
+	user.LastName = form.LastName
+
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountChanged,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		Before:     before,
+		After:      map[string]any{"firstName": user.FirstName, "lastName": user.LastName},
+	})
+
+	model := &AccountModel{}
+
+	if err := copier.Copy(model, user); err != nil {
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	return model, nil
+}
+
+func (service *IdentityService) VerifyAccount(ctx context.Context, form VerifyAccountForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.VerifyAccount")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return problems.FromError(err)
+	}
+
+	accountType := GetAccountType(form.Username)
+	user, err := service.identityRepository.GetUserByUsername(ctx, form.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if accountType != AccountTypeEmail && accountType != AccountTypePhoneNumber {
+		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+	}
+
+	code, problem := service.issueCode(ctx, PurposeVerifyAccount, user.Id)
+	if problem != nil {
+		return problem
+	}
+
+	return service.sendCode(ctx, accountType, form.Username, "Verify your account", localize(ctx, "Your verification code is %v.", code))
+}
+
+func (service *IdentityService) CompleteVerifyAccount(ctx context.Context, form CompleteVerifyAccountForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.CompleteVerifyAccount")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return problems.FromError(err)
+	}
+
+	accountType := GetAccountType(form.Username)
+	user, err := service.identityRepository.GetUserByUsername(ctx, form.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if accountType != AccountTypeEmail && accountType != AccountTypePhoneNumber {
+		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+	}
+
+	if problem := service.verifyCode(ctx, PurposeVerifyAccount, user.Id, form.Code, true); problem != nil {
+		return problem
+	}
+
+	before := *user
+
+	if accountType == AccountTypeEmail {
+		user.EmailVerified = true
+	} else {
+		user.PhoneNumberVerified = true
+	}
+
+	user.SecurityStamp = uuid.New().String()
+	user.UpdatedAt = time.Now()
+
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountVerified,
+		ActorId:    user.Id,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		Before:     &before,
+		After:      user,
+	})
+
+	return nil
+}
+
+func (service *IdentityService) DeleteAccount(ctx context.Context, userId string) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.DeleteAccount")
+	defer span.End()
+
+	user, err := service.identityRepository.GetUserById(ctx, userId)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewProblem(http.StatusNotFound, "User not found.")
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	// The account is erased by a background job once the grace period ends;
+	// signing in again before then cancels the erasure.
+	erasureScheduledAt := time.Now().Add(service.config.ErasureGracePeriod)
+	user.ErasureScheduledAt = &erasureScheduledAt
+
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.jwtHelper.RevokeAllTokens(user.Id); err != nil {
+		service.log(ctx).Error("Error revoking tokens: ", zap.Error(err))
+		return problems.FromError(err)
+	}
+
+	if err := service.identityRepository.DeleteApiKeysByUserId(ctx, user.Id); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountDeleted,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		After:      map[string]any{"erasureScheduledAt": erasureScheduledAt},
+	})
+
+	return nil
+}
+
+func (service *IdentityService) ChangeAccount(ctx context.Context, userId string, form ChangeAccountForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.ChangeAccount")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return problems.FromError(err)
+	}
+
+	accountType := GetAccountType(form.NewUsername)
+	user, err := service.identityRepository.GetUserById(ctx, userId)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewProblem(http.StatusNotFound, "User not found.")
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if user.Email == form.NewUsername || user.PhoneNumber == form.NewUsername {
+		return problems.NewValidationProblem(map[string]string{
+			"newUsername": localize(ctx, "%v is already associated with your account.", humanize.Humanize(string(accountType), humanize.SentenceCase)),
+		})
+	}
+
+	if accountType != AccountTypeEmail && accountType != AccountTypePhoneNumber {
+		return problems.NewValidationProblem(map[string]string{"newUsername": "Username is not a valid email or phone number."})
+	}
+
+	code, problem := service.issueCode(ctx, PurposeChangeAccount, fmt.Sprintf("%v:%v", user.Id, form.NewUsername))
+	if problem != nil {
+		return problem
+	}
+
+	return service.sendCode(ctx, accountType, form.NewUsername, "Confirm your new account", localize(ctx, "Your verification code is %v.", code))
+}
+
+func (service *IdentityService) CompleteChangeAccount(ctx context.Context, userId string, form CompleteChangeAccountForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.CompleteChangeAccount")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return problems.FromError(err)
+	}
+
+	accountType := GetAccountType(form.NewUsername)
+	user, err := service.identityRepository.GetUserById(ctx, userId)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewProblem(http.StatusNotFound, "User not found.")
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if user.Email == form.NewUsername || user.PhoneNumber == form.NewUsername {
+		return problems.NewValidationProblem(map[string]string{"newUsername": localize(ctx, "%v is already verified.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	}
+
+	if accountType != AccountTypeEmail && accountType != AccountTypePhoneNumber {
+		return problems.NewValidationProblem(map[string]string{"newUsername": "Username is not a valid email or phone number."})
+	}
+
+	if problem := service.verifyCode(ctx, PurposeChangeAccount, fmt.Sprintf("%v:%v", user.Id, form.NewUsername), form.Code, true); problem != nil {
+		return problem
+	}
+
+	before := *user
+
+	if accountType == AccountTypeEmail {
+		user.Email = form.NewUsername
+		user.EmailVerified = true
+	} else {
+		user.PhoneNumber = form.NewUsername
+		user.PhoneNumberVerified = true
+	}
+
+	user.SecurityStamp = uuid.New().String()
+	user.UpdatedAt = time.Now()
+
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountChanged,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		Before:     &before,
+		After:      user,
+	})
+
+	return nil
+}
+
+func (service *IdentityService) ResetPassword(ctx context.Context, form ResetPasswordForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.ResetPassword")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return problems.FromError(err)
+	}
+
+	accountType := GetAccountType(form.Username)
+	user, err := service.identityRepository.GetUserByUsername(ctx, form.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if accountType != AccountTypeEmail && accountType != AccountTypePhoneNumber {
+		return problems.NewValidationProblem(map[string]string{"username": "Username is not a valid email or phone number."})
+	}
+
+	code, problem := service.issueCode(ctx, PurposeResetPassword, user.Id)
+	if problem != nil {
+		return problem
+	}
+
+	return service.sendCode(ctx, accountType, form.Username, "Reset your password", localize(ctx, "Your password reset code is %v.", code))
+}
+
+func (service *IdentityService) CompleteResetPassword(ctx context.Context, form CompleteResetPasswordForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.CompleteResetPassword")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return problems.FromError(err)
+	}
+
+	accountType := GetAccountType(form.Username)
+	user, err := service.identityRepository.GetUserByUsername(ctx, form.Username)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewValidationProblem(map[string]string{"username": localize(ctx, "%v does not exist.", humanize.Humanize(string(accountType), humanize.SentenceCase))})
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	// Only consume the code once the password is actually reset
+	if problem := service.verifyCode(ctx, PurposeResetPassword, user.Id, form.Code, false); problem != nil {
+		return problem
+	}
+
+	if problem := service.checkPasswordReuse(ctx, user, "newPassword", form.NewPassword); problem != nil {
+		return problem
+	}
+
+	if form.ValidateOnly {
+		return nil
+	}
+
+	if problem := service.verifyCode(ctx, PurposeResetPassword, user.Id, form.Code, true); problem != nil {
+		return problem
+	}
+
+	currentTime := time.Now()
 
 	user.HasPassword = true
 	user.PasswordHash = utils.MustHashPassword(form.NewPassword)
@@ -676,29 +1319,49 @@ func (service *IdentityService) CompleteResetPassword(form CompleteResetPassword
 	user.UpdatedAt = currentTime
 	user.LastPasswordChangedAt = &currentTime
 
-	if err := service.identityRepository.UpdateUser(user); err != nil {
-		service.logger.Error("User update error: ", zap.Error(err))
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.recordPasswordHistory(ctx, user); err != nil {
+		service.log(ctx).Error("Error recording password history: ", zap.Error(err))
 		return problems.FromError(err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionPasswordReset,
+		ActorId:    user.Id,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+	})
+
 	return nil
 }
 
-func (service *IdentityService) ChangePassword(userId string, form ChangePasswordForm) *problems.Problem {
+func (service *IdentityService) ChangePassword(ctx context.Context, userId string, form ChangePasswordForm) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.ChangePassword")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return problems.FromError(err)
 	}
 
-	user := service.identityRepository.GetUserById(userId)
-
-	if user == nil {
+	user, err := service.identityRepository.GetUserById(ctx, userId)
+	if errors.Is(err, models.ErrNotFound) {
 		return problems.NewProblem(http.StatusNotFound, "User not found.")
 	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
 
 	if !utils.CheckPasswordHash(form.OldPassword, user.PasswordHash) {
 		return problems.NewValidationProblem(map[string]string{"oldPassword": "Old password is incorrect."})
 	}
 
+	if problem := service.checkPasswordReuse(ctx, user, "newPassword", form.NewPassword); problem != nil {
+		return problem
+	}
+
 	currentTime := time.Now()
 	user.HasPassword = true
 	user.PasswordHash = utils.MustHashPassword(form.NewPassword)
@@ -706,127 +1369,283 @@ func (service *IdentityService) ChangePassword(userId string, form ChangePasswor
 	user.UpdatedAt = currentTime
 	user.LastPasswordChangedAt = &currentTime
 
-	if err := service.identityRepository.UpdateUser(user); err != nil {
-		service.logger.Error("User update error: ", zap.Error(err))
+	if err := service.identityRepository.UpdateUser(ctx, user); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.recordPasswordHistory(ctx, user); err != nil {
+		service.log(ctx).Error("Error recording password history: ", zap.Error(err))
 		return problems.FromError(err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionPasswordChanged,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+	})
+
 	return nil
 }
 
-func (service *IdentityService) CreateRole(form CreateRoleForm) (*RoleModel, *problems.Problem) {
+// checkPasswordReuse rejects a password that matches the current one or any of the
+// recently used passwords kept in the user's password history
+func (service *IdentityService) checkPasswordReuse(ctx context.Context, user *models.User, field string, password string) *problems.Problem {
+	message := localize(ctx, "Password must not match any of your last %d passwords.", service.config.PasswordHistory)
+
+	if user.HasPassword && utils.CheckPasswordHash(password, user.PasswordHash) {
+		return problems.NewValidationProblem(map[string]string{field: message})
+	}
+
+	histories, err := service.identityRepository.GetPasswordHistory(ctx, user.Id, service.config.PasswordHistory)
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	for _, history := range histories {
+		if utils.CheckPasswordHash(password, history.PasswordHash) {
+			return problems.NewValidationProblem(map[string]string{field: message})
+		}
+	}
+
+	return nil
+}
+
+// recordPasswordHistory stores the user's current password hash and trims the
+// history to the configured length
+func (service *IdentityService) recordPasswordHistory(ctx context.Context, user *models.User) error {
+	if err := service.identityRepository.CreatePasswordHistory(ctx, &models.PasswordHistory{
+		Id:           uuid.New().String(),
+		UserId:       user.Id,
+		PasswordHash: user.PasswordHash,
+	}); err != nil {
+		return err
+	}
+
+	return service.identityRepository.TrimPasswordHistory(ctx, user.Id, service.config.PasswordHistory)
+}
+
+func (service *IdentityService) CreateRole(ctx context.Context, form CreateRoleForm) (*RoleModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CreateRole")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return nil, problems.FromError(err)
 	}
 
-	if exists := service.identityRepository.RoleNameExists(form.Name); exists {
+	exists, err := service.identityRepository.RoleNameExists(ctx, form.Name)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	if exists {
 		return nil, problems.NewValidationProblem(map[string]string{"name": "Role name already exists."})
 	}
 
 	role := &models.Role{}
 
 	if err := copier.Copy(role, form); err != nil {
-		service.logger.Error("Error copying form to category: ", zap.Error(err))
+		service.log(ctx).Error("Error copying form to category: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	role.Id = uuid.New().String()
-	err := service.identityRepository.CreateRole(role)
+	err = service.identityRepository.CreateRole(ctx, role)
 
 	if err != nil {
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionRoleCreated,
+		TargetType: models.AuditTargetRole,
+		TargetId:   role.Id,
+		After:      role,
+	})
+
 	model := &RoleModel{}
 
 	if err := copier.Copy(model, role); err != nil {
-		service.logger.Error("Error copying role to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying role to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IdentityService) UpdateRole(id string, form UpdateRoleForm) (*RoleModel, *problems.Problem) {
+func (service *IdentityService) UpdateRole(ctx context.Context, id string, form UpdateRoleForm) (*RoleModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.UpdateRole")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return nil, problems.FromError(err)
 	}
 
-	role := service.identityRepository.GetRoleById(id)
+	role, err := service.identityRepository.GetRoleById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "Role not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	return service.updateRole(ctx, role, form)
+}
+
+// PatchRole applies a JSON merge patch to a role. Only the fields named
+// by the patch are validated, the others keep their current values.
+func (service *IdentityService) PatchRole(ctx context.Context, id string, patch map[string]any, expectedVersion *int64) (*RoleModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.PatchRole")
+	defer span.End()
 
-	if role == nil {
+	role, err := service.identityRepository.GetRoleById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
 		return nil, problems.NewProblem(http.StatusNotFound, "Role not found.")
 	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
-	if exists := service.identityRepository.RoleNameExists(form.Name); exists {
+	form := UpdateRoleForm{}
+	if err := copier.Copy(&form, role); err != nil {
+		service.log(ctx).Error("Error copying role to form: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+	if err := helpers.ApplyMergePatch(&form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+	if err := service.validator.ValidatePatch(form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+	form.ExpectedVersion = expectedVersion
+
+	return service.updateRole(ctx, role, form)
+}
+
+// updateRole saves a validated form to a role
+func (service *IdentityService) updateRole(ctx context.Context, role *models.Role, form UpdateRoleForm) (*RoleModel, *problems.Problem) {
+	id := role.Id
+	if form.ExpectedVersion != nil && *form.ExpectedVersion != role.Version {
+		return nil, service.staleRoleProblem(ctx, id)
+	}
+
+	exists, err := service.identityRepository.RoleNameExists(ctx, form.Name)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	if exists {
 		if role.Name != form.Name {
 			return nil, problems.NewValidationProblem(map[string]string{"name": "Role name already exists for another role."})
 		}
 	}
 
+	before := *role
+
 	if err := copier.Copy(role, form); err != nil {
-		service.logger.Error("Error copying form to role: ", zap.Error(err))
+		service.log(ctx).Error("Error copying form to role: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
-	err := service.identityRepository.UpdateRole(role)
+	err = service.identityRepository.UpdateRole(ctx, role)
 
+	if errors.Is(err, models.ErrStale) {
+		return nil, service.staleRoleProblem(ctx, id)
+	}
 	if err != nil {
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionRoleUpdated,
+		TargetType: models.AuditTargetRole,
+		TargetId:   role.Id,
+		Before:     &before,
+		After:      role,
+	})
+
 	model := &RoleModel{}
 
 	if err := copier.Copy(model, role); err != nil {
-		service.logger.Error("Error copying role to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying role to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IdentityService) DeleteRole(id string) *problems.Problem {
-	role := service.identityRepository.GetRoleById(id)
+// staleRoleProblem returns the problem for an update based on a version of
+// the role that is no longer current, together with the current version
+func (service *IdentityService) staleRoleProblem(ctx context.Context, id string) *problems.Problem {
+	current, problem := service.GetRoleById(ctx, id)
+	if problem != nil {
+		return problem
+	}
+	return problems.NewPreconditionFailedProblem(current)
+}
+
+func (service *IdentityService) DeleteRole(ctx context.Context, id string) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.DeleteRole")
+	defer span.End()
 
-	if role == nil {
+	role, err := service.identityRepository.GetRoleById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
 		return problems.NewProblem(http.StatusNotFound, "Role not found.")
 	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
 
-	if err := service.identityRepository.DeleteRole(role); err != nil {
-		service.logger.Error("Error deleting role: ", zap.Error(err))
-		return problems.FromError(err)
+	if err := service.identityRepository.DeleteRole(ctx, role); err != nil {
+		return repositoryProblem(service.log(ctx), err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionRoleDeleted,
+		TargetType: models.AuditTargetRole,
+		TargetId:   role.Id,
+		Before:     role,
+	})
+
 	return nil
 }
 
-func (service *IdentityService) GetPaginatedRoles(filter repositories.RolePaginatedFilter) (*RolePaginatedListModel, *problems.Problem) {
-	items, count := service.identityRepository.GetPaginatedRoles(filter)
+func (service *IdentityService) GetPaginatedRoles(ctx context.Context, filter repositories.RolePaginatedFilter) (*RolePaginatedListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetPaginatedRoles")
+	defer span.End()
+
+	items, page, err := service.identityRepository.GetPaginatedRoles(ctx, filter)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	models := make([]RoleModel, 0, len(items))
 	for _, item := range items {
 		model := &RoleModel{}
 		if err := copier.Copy(model, item); err != nil {
-			service.logger.Error("Error copying category to model: ", zap.Error(err))
+			service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
 			return nil, problems.FromError(err)
 		}
 		models = append(models, *model)
 	}
 
 	return &RolePaginatedListModel{
-		Items: models,
-		Count: count,
+		Items:      models,
+		PageResult: page,
 	}, nil
 }
 
-func (service *IdentityService) GetRoles(filter repositories.RoleFilter) (*RoleListModel, *problems.Problem) {
-	items := service.identityRepository.GetRoles(filter)
+func (service *IdentityService) GetRoles(ctx context.Context, filter repositories.RoleFilter) (*RoleListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetRoles")
+	defer span.End()
+
+	items, err := service.identityRepository.GetRoles(ctx, filter)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	models := make([]RoleModel, 0, len(items))
 	for _, item := range items {
 		model := &RoleModel{}
 		if err := copier.Copy(model, item); err != nil {
-			service.logger.Error("Error copying category to model: ", zap.Error(err))
+			service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
 			return nil, problems.FromError(err)
 		}
 		models = append(models, *model)
@@ -836,31 +1655,305 @@ func (service *IdentityService) GetRoles(filter repositories.RoleFilter) (*RoleL
 	return &listModel, nil
 }
 
-func (service *IdentityService) GetRoleById(id string) (*RoleModel, *problems.Problem) {
-	role := service.identityRepository.GetRoleById(id)
+func (service *IdentityService) GetRoleById(ctx context.Context, id string) (*RoleModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetRoleById")
+	defer span.End()
 
-	if role == nil {
+	role, err := service.identityRepository.GetRoleById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
 		return nil, problems.NewProblem(http.StatusNotFound, "Role not found.")
 	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	model := &RoleModel{}
 
 	if err := copier.Copy(model, role); err != nil {
-		service.logger.Error("Error copying role to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying role to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IdentityService) GetUsersStatistics(dateRange period.DateRange) (*repositories.UserStatistics, *problems.Problem) {
+func (service *IdentityService) GetUsersStatistics(ctx context.Context, dateRange period.DateRange) (*repositories.UserStatistics, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetUsersStatistics")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(dateRange); err != nil {
 		return nil, problems.FromError(err)
 	}
-	stats, err := service.identityRepository.GetUsersStatistics(dateRange)
+	stats, err := service.identityRepository.GetUsersStatistics(ctx, dateRange)
 	if err != nil {
-		service.logger.Error("Failed to get users statistics", zap.Error(err))
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 	return stats, nil
 }
+
+func (service *IdentityService) CreateServiceAccount(ctx context.Context, form CreateServiceAccountForm) (*AccountModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CreateServiceAccount")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	roles := form.Roles
+	if len(roles) == 0 {
+		roles = []string{models.RoleReporter}
+	}
+
+	for _, role := range roles {
+		exists, err := service.identityRepository.RoleNameExists(ctx, role)
+		if err != nil {
+			return nil, repositoryProblem(service.log(ctx), err)
+		}
+		if !exists && !slices.Contains(models.RoleAll, role) {
+			return nil, problems.NewValidationProblem(map[string]string{"roles": localize(ctx, "Role '%v' does not exist.", role)})
+		}
+	}
+
+	var err error
+	userName := utils.GenerateSlug([]string{form.Name}, existenceChecker(ctx, service.identityRepository.UserNameExists, &err))
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	currentTime := time.Now()
+
+	user := &models.User{
+		Id:               uuid.New().String(),
+		FirstName:        form.Name,
+		UserName:         userName,
+		SecurityStamp:    uuid.New().String(),
+		LastActiveAt:     currentTime,
+		Status:           models.UserStatusActive,
+		IsServiceAccount: true,
+	}
+
+	if err := service.identityRepository.CreateUser(ctx, user); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.identityRepository.AddUserToRoles(ctx, user, roles...); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionServiceAccountCreated,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		After:      user,
+	})
+
+	model := &AccountModel{}
+
+	if err := copier.Copy(model, user); err != nil {
+		service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	return model, nil
+}
+
+func (service *IdentityService) GetServiceAccounts(ctx context.Context) (*AccountListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetServiceAccounts")
+	defer span.End()
+
+	items, err := service.identityRepository.GetServiceAccounts(ctx)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	models := make([]AccountModel, 0, len(items))
+	for _, item := range items {
+		model := &AccountModel{}
+		if err := copier.Copy(model, &item); err != nil {
+			service.log(ctx).Error("Error copying user to model: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+		models = append(models, *model)
+	}
+
+	listModel := AccountListModel(models)
+	return &listModel, nil
+}
+
+func (service *IdentityService) DeleteServiceAccount(ctx context.Context, id string) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.DeleteServiceAccount")
+	defer span.End()
+
+	user, err := service.identityRepository.GetServiceAccountById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewProblem(http.StatusNotFound, "Service account not found.")
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.identityRepository.DeleteApiKeysByUserId(ctx, user.Id); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.identityRepository.DeleteUser(ctx, user); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionServiceAccountDeleted,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+		Before:     user,
+	})
+
+	return nil
+}
+
+func (service *IdentityService) GetServiceAccountApiKeys(ctx context.Context, id string) (*ApiKeyListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetServiceAccountApiKeys")
+	defer span.End()
+
+	_, err := service.identityRepository.GetServiceAccountById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "Service account not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	return service.GetApiKeys(ctx, id)
+}
+
+func (service *IdentityService) CreateServiceAccountApiKey(ctx context.Context, id string, form CreateApiKeyForm) (*ApiKeyWithSecretModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CreateServiceAccountApiKey")
+	defer span.End()
+
+	_, err := service.identityRepository.GetServiceAccountById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "Service account not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	return service.CreateApiKey(ctx, id, form)
+}
+
+func (service *IdentityService) RevokeServiceAccountApiKey(ctx context.Context, id string, apiKeyId string) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.RevokeServiceAccountApiKey")
+	defer span.End()
+
+	_, err := service.identityRepository.GetServiceAccountById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewProblem(http.StatusNotFound, "Service account not found.")
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	return service.RevokeApiKey(ctx, id, apiKeyId)
+}
+
+func (service *IdentityService) CreateApiKey(ctx context.Context, userId string, form CreateApiKeyForm) (*ApiKeyWithSecretModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.CreateApiKey")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	for _, scope := range form.Scopes {
+		if !slices.Contains(models.ScopeAll, scope) {
+			return nil, problems.NewValidationProblem(map[string]string{"scopes": localize(ctx, "Scope '%v' is not valid.", scope)})
+		}
+	}
+
+	if form.ExpiresAt != nil && form.ExpiresAt.Before(time.Now()) {
+		return nil, problems.NewValidationProblem(map[string]string{"expiresAt": "Expiry date must be in the future."})
+	}
+
+	key, prefix, hash := helpers.GenerateApiKey()
+
+	apiKey := &models.ApiKey{
+		Id:        uuid.New().String(),
+		Name:      form.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    strings.Join(slices.Compact(slices.Sorted(slices.Values(form.Scopes))), ","),
+		UserId:    userId,
+		ExpiresAt: form.ExpiresAt,
+	}
+
+	if err := service.identityRepository.CreateApiKey(ctx, apiKey); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionApiKeyCreated,
+		TargetType: models.AuditTargetApiKey,
+		TargetId:   apiKey.Id,
+		After:      apiKey,
+	})
+
+	model := &ApiKeyWithSecretModel{Key: key}
+
+	if err := copier.Copy(&model.ApiKeyModel, apiKey); err != nil {
+		service.log(ctx).Error("Error copying api key to model: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	model.Scopes = apiKey.ScopeList()
+
+	return model, nil
+}
+
+func (service *IdentityService) GetApiKeys(ctx context.Context, userId string) (*ApiKeyListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IdentityService.GetApiKeys")
+	defer span.End()
+
+	items, err := service.identityRepository.GetApiKeysByUserId(ctx, userId)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	models := make([]ApiKeyModel, 0, len(items))
+	for _, item := range items {
+		model := &ApiKeyModel{}
+		if err := copier.Copy(model, &item); err != nil {
+			service.log(ctx).Error("Error copying api key to model: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+		model.Scopes = item.ScopeList()
+		models = append(models, *model)
+	}
+
+	listModel := ApiKeyListModel(models)
+	return &listModel, nil
+}
+
+func (service *IdentityService) RevokeApiKey(ctx context.Context, userId string, id string) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IdentityService.RevokeApiKey")
+	defer span.End()
+
+	apiKey, err := service.identityRepository.GetApiKeyById(ctx, userId, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewProblem(http.StatusNotFound, "Api key not found.")
+	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.identityRepository.DeleteApiKey(ctx, apiKey); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionApiKeyRevoked,
+		TargetType: models.AuditTargetApiKey,
+		TargetId:   apiKey.Id,
+		Before:     apiKey,
+	})
+
+	return nil
+}
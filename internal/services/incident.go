@@ -1,15 +1,24 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jinzhu/copier"
 	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/metrics"
 	"github.com/prince272/konabra/internal/models"
 	"github.com/prince272/konabra/internal/problems"
 	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
+	"github.com/prince272/konabra/pkg/humanize"
+	"github.com/prince272/konabra/pkg/jsonschema"
 	"github.com/prince272/konabra/pkg/period"
 	"github.com/prince272/konabra/utils"
 	"go.uber.org/zap"
@@ -17,21 +26,26 @@ import (
 
 type IncidentService struct {
 	incidentRepository *repositories.IncidentRepository
+	categoryRepository *repositories.CategoryRepository
 	validator          *helpers.Validator
+	auditService       *AuditService
+	metrics            *metrics.Metrics
 	logger             *zap.Logger
 }
 
 type CreateIncidentForm struct {
-	CategoryId string  `json:"categoryId" validate:"required"`
-	Summary    string  `json:"summary" validate:"required,max=256"`
-	Severity   string  `json:"severity" validate:"required" enum:"low,medium,high"`
-	Latitude   float64 `json:"latitude"`
-	Longitude  float64 `json:"longitude"`
-	Location   string  `json:"location"`
+	CategoryId string         `json:"categoryId" validate:"required"`
+	Summary    string         `json:"summary" validate:"required,max=256"`
+	Severity   string         `json:"severity" validate:"required" enum:"low,medium,high"`
+	Latitude   float64        `json:"latitude"`
+	Longitude  float64        `json:"longitude"`
+	Location   string         `json:"location"`
+	Fields     map[string]any `json:"fields"`
 }
 
 type UpdateIncidentForm struct {
 	CreateIncidentForm
+	ExpectedVersion *int64 `json:"-"` // Read from the If-Match header, the update fails if the incident has another version
 }
 
 type IncidentModel struct {
@@ -42,178 +56,385 @@ type IncidentModel struct {
 	Status       models.IncidentStatus   `json:"status"`
 	ReportedAt   time.Time               `json:"reportedAt"`
 	ResolvedAt   *time.Time              `json:"resolvedAt"`
-	ReportedById string                  `json:"reportedById"`
-	ReportedBy   AccountModel            `json:"reportedBy"`
+	ReportedById *string                 `json:"reportedById"`
+	ReportedBy   *AccountModel           `json:"reportedBy"`
 	Latitude     float64                 `json:"latitude"`
 	Longitude    float64                 `json:"longitude"`
 	Location     string                  `json:"location"`
+	Fields       map[string]any          `json:"fields"`
 	CategoryId   string                  `json:"categoryId"`
 	Category     CategoryModel           `json:"category"`
+	UpdatedAt    time.Time               `json:"updatedAt"`
+	Version      int64                   `json:"version"`
+}
+
+// LastModified returns when the incident last changed
+func (model IncidentModel) LastModified() time.Time {
+	return model.UpdatedAt
+}
+
+// ResourceVersion returns the version of the incident, which leads its ETag
+func (model IncidentModel) ResourceVersion() int64 {
+	return model.Version
 }
 
 type IncidentPaginatedListModel struct {
 	Items []IncidentModel `json:"items"`
-	Count int64           `json:"count"`
+	repositories.PageResult
 }
 
-func NewIncidentService(incidentRepo *repositories.IncidentRepository, validator *helpers.Validator, logger *zap.Logger) *IncidentService {
+func NewIncidentService(incidentRepo *repositories.IncidentRepository, categoryRepository *repositories.CategoryRepository, validator *helpers.Validator, auditService *AuditService, metrics *metrics.Metrics, logger *zap.Logger) *IncidentService {
 	return &IncidentService{
 		incidentRepository: incidentRepo,
+		categoryRepository: categoryRepository,
 		validator:          validator,
+		auditService:       auditService,
+		metrics:            metrics,
 		logger:             logger,
 	}
 }
 
-func (service *IncidentService) CreateIncident(userId string, form CreateIncidentForm) (*IncidentModel, *problems.Problem) {
+// log returns the request-scoped logger carried by ctx
+func (service *IncidentService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+func (service *IncidentService) CreateIncident(ctx context.Context, userId string, form CreateIncidentForm) (*IncidentModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.CreateIncident")
+	defer span.End()
+
+	return service.createIncident(ctx, userId, uuid.New().String(), time.Now(), form)
+}
+
+// createIncident validates and saves a report with the given id and report time.
+// Reports made offline keep the id generated by the device and the time the
+// incident was seen, rather than the time they were uploaded.
+func (service *IncidentService) createIncident(ctx context.Context, userId string, id string, reportedAt time.Time, form CreateIncidentForm) (*IncidentModel, *problems.Problem) {
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return nil, problems.FromError(err)
 	}
 
+	category, problem := service.validateIncidentCategory(ctx, form.CategoryId, form.Fields, false)
+	if problem != nil {
+		return nil, problem
+	}
+
 	incident := &models.Incident{}
 	if err := copier.Copy(incident, form); err != nil {
-		service.logger.Error("Copy error", zap.Error(err))
+		service.log(ctx).Error("Copy error", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
-	incident.Id = uuid.New().String()
-	incident.Code = utils.GenerateUniqueCode("INC", 5, utils.NumericUniqueCode, "", service.incidentRepository.IncidentCodeExists)
-	incident.ReportedById = userId
-	incident.ReportedAt = time.Now()
-	incident.UpdatedAt = incident.ReportedAt
+	incident.Id = id
+	var err error
+	incident.Code = utils.GenerateUniqueCode("INC", 5, utils.NumericUniqueCode, "", existenceChecker(ctx, service.incidentRepository.IncidentCodeExists, &err))
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	incident.ReportedById = &userId
+	incident.ReportedAt = reportedAt
+	incident.UpdatedAt = time.Now()
 	incident.Status = models.IncidentStatusPending
 
-	if err := service.incidentRepository.CreateIncident(incident); err != nil {
-		service.logger.Error("Failed to create incident", zap.Error(err))
-		return nil, problems.FromError(err)
+	if err := service.incidentRepository.CreateIncident(ctx, incident); err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionIncidentCreated,
+		TargetType: models.AuditTargetIncident,
+		TargetId:   incident.Id,
+		After:      incident,
+	})
+	service.metrics.IncidentsCreated.WithLabelValues(category.Slug, string(incident.Severity)).Inc()
+
 	model := &IncidentModel{}
 	if err := copier.Copy(model, incident); err != nil {
-		service.logger.Error("Copy error", zap.Error(err))
+		service.log(ctx).Error("Copy error", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IncidentService) UpdateIncident(id string, form UpdateIncidentForm) (*IncidentModel, *problems.Problem) {
+func (service *IncidentService) UpdateIncident(ctx context.Context, id string, form UpdateIncidentForm) (*IncidentModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.UpdateIncident")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(form); err != nil {
 		return nil, problems.FromError(err)
 	}
 
-	incident := service.incidentRepository.GetIncidentById(id)
-	if incident == nil {
-		return nil, problems.NewProblem(http.StatusNotFound, "Incident not found")
+	incident, err := service.incidentRepository.GetIncidentById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "Incident not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	return service.updateIncident(ctx, incident, form)
+}
+
+// PatchIncident applies a JSON merge patch to an incident. Only the fields named
+// by the patch are validated, the others keep their current values.
+func (service *IncidentService) PatchIncident(ctx context.Context, id string, patch map[string]any, expectedVersion *int64) (*IncidentModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.PatchIncident")
+	defer span.End()
+
+	incident, err := service.incidentRepository.GetIncidentById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewProblem(http.StatusNotFound, "Incident not found.")
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	return service.patchIncident(ctx, incident, patch, expectedVersion)
+}
+
+// patchIncident applies a JSON merge patch to an incident that was read for the update
+func (service *IncidentService) patchIncident(ctx context.Context, incident *models.Incident, patch map[string]any, expectedVersion *int64) (*IncidentModel, *problems.Problem) {
+	form := UpdateIncidentForm{}
+	if err := copier.Copy(&form, incident); err != nil {
+		service.log(ctx).Error("Copy error", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+	if err := helpers.ApplyMergePatch(&form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+	if err := service.validator.ValidatePatch(form, patch); err != nil {
+		return nil, problems.FromError(err)
+	}
+	form.ExpectedVersion = expectedVersion
+
+	return service.updateIncident(ctx, incident, form)
+}
+
+// updateIncident saves a validated form to an incident
+func (service *IncidentService) updateIncident(ctx context.Context, incident *models.Incident, form UpdateIncidentForm) (*IncidentModel, *problems.Problem) {
+	id := incident.Id
+	if form.ExpectedVersion != nil && *form.ExpectedVersion != incident.Version {
+		return nil, service.staleIncidentProblem(ctx, id)
+	}
+
+	// Incidents may stay in an archived category but cannot be moved into one
+	if _, problem := service.validateIncidentCategory(ctx, form.CategoryId, form.Fields, form.CategoryId == incident.CategoryId); problem != nil {
+		return nil, problem
 	}
 
+	before := *incident
+
 	if err := copier.Copy(incident, form); err != nil {
-		service.logger.Error("Copy error", zap.Error(err))
+		service.log(ctx).Error("Copy error", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	incident.UpdatedAt = time.Now()
 
-	if err := service.incidentRepository.UpdateIncident(incident); err != nil {
-		return nil, problems.FromError(err)
+	if err := service.incidentRepository.UpdateIncident(ctx, incident); err != nil {
+		if errors.Is(err, models.ErrStale) {
+			return nil, service.staleIncidentProblem(ctx, id)
+		}
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionIncidentUpdated,
+		TargetType: models.AuditTargetIncident,
+		TargetId:   incident.Id,
+		Before:     &before,
+		After:      incident,
+	})
+
 	model := &IncidentModel{}
 	if err := copier.Copy(model, incident); err != nil {
-		service.logger.Error("Copy error", zap.Error(err))
+		service.log(ctx).Error("Copy error", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IncidentService) DeleteIncident(id string) *problems.Problem {
-	incident := service.incidentRepository.GetIncidentById(id)
-	if incident == nil {
-		return problems.NewProblem(http.StatusNotFound, "Incident not found")
+// staleIncidentProblem returns the problem for an update based on a version of
+// the incident that is no longer current, together with the current version
+func (service *IncidentService) staleIncidentProblem(ctx context.Context, id string) *problems.Problem {
+	current, problem := service.GetIncidentById(ctx, id)
+	if problem != nil {
+		return problem
 	}
+	return problems.NewPreconditionFailedProblem(current)
+}
+
+func (service *IncidentService) DeleteIncident(ctx context.Context, id string) *problems.Problem {
+	ctx, span := tracing.Start(ctx, "IncidentService.DeleteIncident")
+	defer span.End()
 
-	if err := service.incidentRepository.DeleteIncident(incident); err != nil {
-		return problems.FromError(err)
+	incident, err := service.incidentRepository.GetIncidentById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return problems.NewProblem(http.StatusNotFound, "Incident not found.")
 	}
+	if err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.incidentRepository.DeleteIncident(ctx, incident); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionIncidentDeleted,
+		TargetType: models.AuditTargetIncident,
+		TargetId:   incident.Id,
+		Before:     incident,
+	})
 
 	return nil
 }
 
-func (service *IncidentService) GetPaginatedIncidents(filter repositories.IncidentPaginatedFilter) (*IncidentPaginatedListModel, *problems.Problem) {
-	items, count := service.incidentRepository.GetPaginatedIncidents(filter)
+// validateIncidentCategory checks that the category can receive reports and validates
+// the extra fields of the report against the schema of the category
+func (service *IncidentService) validateIncidentCategory(ctx context.Context, categoryId string, fields map[string]any, allowArchived bool) (*models.Category, *problems.Problem) {
+	category, err := service.categoryRepository.GetCategoryById(ctx, categoryId)
+	if errors.Is(err, models.ErrNotFound) {
+		return nil, problems.NewValidationProblem(map[string]string{"categoryId": "Category not found."})
+	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	if category.ArchivedAt != nil && !allowArchived {
+		return nil, problems.NewValidationProblem(map[string]string{"categoryId": "Category is archived."})
+	}
+
+	if len(category.Schema) == 0 {
+		if len(fields) > 0 {
+			return nil, problems.NewValidationProblem(map[string]string{"fields": "Category does not accept extra fields."})
+		}
+		return category, nil
+	}
+
+	schema, err := jsonschema.Parse(category.Schema)
+	if err != nil {
+		service.log(ctx).Error("Error parsing category schema: ", zap.String("categoryId", category.Id), zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	if fields == nil {
+		fields = map[string]any{}
+	}
+
+	if errs := schema.Validate(fields); len(errs) > 0 {
+		errors := make(map[string]string, len(errs))
+		for _, fieldError := range errs {
+			if fieldError.Path == "" {
+				errors["fields"] = fmt.Sprintf("Fields %v.", fieldError.Message)
+				continue
+			}
+			name := fieldError.Path[strings.LastIndex(fieldError.Path, ".")+1:]
+			errors["fields."+fieldError.Path] = fmt.Sprintf("%v %v.", humanize.Humanize(name, humanize.SentenceCase), fieldError.Message)
+		}
+		return nil, problems.NewValidationProblem(errors)
+	}
+
+	return category, nil
+}
+
+func (service *IncidentService) GetPaginatedIncidents(ctx context.Context, filter repositories.IncidentPaginatedFilter) (*IncidentPaginatedListModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.GetPaginatedIncidents")
+	defer span.End()
+
+	items, page, err := service.incidentRepository.GetPaginatedIncidents(ctx, filter)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	models := make([]IncidentModel, 0, len(items))
 	for _, item := range items {
 		model := &IncidentModel{}
 
 		if err := copier.Copy(model, item); err != nil {
-			service.logger.Error("Error copying incident to model: ", zap.Error(err))
+			service.log(ctx).Error("Error copying incident to model: ", zap.Error(err))
 			return nil, problems.FromError(err)
 		}
 
-		if err := copier.Copy(&model.ReportedBy, item.ReportedBy); err != nil {
-			service.logger.Error("Error copying reported by to model: ", zap.Error(err))
-			return nil, problems.FromError(err)
+		if item.ReportedBy != nil {
+			model.ReportedBy = &AccountModel{}
+			if err := copier.Copy(model.ReportedBy, item.ReportedBy); err != nil {
+				service.log(ctx).Error("Error copying reported by to model: ", zap.Error(err))
+				return nil, problems.FromError(err)
+			}
 		}
 
 		models = append(models, *model)
 	}
 
 	return &IncidentPaginatedListModel{
-		Items: models,
-		Count: count,
+		Items:      models,
+		PageResult: page,
 	}, nil
 }
 
-func (service *IncidentService) GetIncidentById(id string) (*IncidentModel, *problems.Problem) {
-	incident := service.incidentRepository.GetIncidentById(id)
+func (service *IncidentService) GetIncidentById(ctx context.Context, id string) (*IncidentModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.GetIncidentById")
+	defer span.End()
 
-	if incident == nil {
+	incident, err := service.incidentRepository.GetIncidentById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
 		return nil, problems.NewProblem(http.StatusNotFound, "Incident not found.")
 	}
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
 
 	model := &IncidentModel{}
 
 	if err := copier.Copy(model, incident); err != nil {
-		service.logger.Error("Error copying incident to model: ", zap.Error(err))
+		service.log(ctx).Error("Error copying incident to model: ", zap.Error(err))
 		return nil, problems.FromError(err)
 	}
 
 	return model, nil
 }
 
-func (service *IncidentService) GetIncidentStatistics(dateRange period.DateRange) (*repositories.IncidentStatistics, *problems.Problem) {
+func (service *IncidentService) GetIncidentStatistics(ctx context.Context, dateRange period.DateRange) (*repositories.IncidentStatistics, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.GetIncidentStatistics")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(dateRange); err != nil {
 		return nil, problems.FromError(err)
 	}
-	stats, err := service.incidentRepository.GetIncidentStatistics(dateRange)
+	stats, err := service.incidentRepository.GetIncidentStatistics(ctx, dateRange)
 	if err != nil {
-		service.logger.Error("Failed to get incidents statistics", zap.Error(err))
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 	return stats, nil
 }
 
-func (service *IncidentService) GetIncidentSeverityInsights(filter repositories.IncidentSeverityInsightsFilter) (*repositories.IncidentSeverityInsights, *problems.Problem) {
+func (service *IncidentService) GetIncidentSeverityInsights(ctx context.Context, filter repositories.IncidentSeverityInsightsFilter) (*repositories.IncidentSeverityInsights, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.GetIncidentSeverityInsights")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(filter); err != nil {
 		return nil, problems.FromError(err)
 	}
-	insights, err := service.incidentRepository.GetIncidentSeverityInsights(filter)
+	insights, err := service.incidentRepository.GetIncidentSeverityInsights(ctx, filter)
 	if err != nil {
-		service.logger.Error("Failed to get incidents insights", zap.Error(err))
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 	return insights, nil
 }
 
-func (service *IncidentService) GetIncidentCategoryInsights(filter repositories.IncidentCategoryInsightsFilter) (*repositories.IncidentCategoryInsights, *problems.Problem) {
+func (service *IncidentService) GetIncidentCategoryInsights(ctx context.Context, filter repositories.IncidentCategoryInsightsFilter) (*repositories.IncidentCategoryInsights, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "IncidentService.GetIncidentCategoryInsights")
+	defer span.End()
+
 	if err := service.validator.ValidateStruct(filter); err != nil {
 		return nil, problems.FromError(err)
 	}
-	insights, err := service.incidentRepository.GetIncidentCategoryInsights(filter)
+	insights, err := service.incidentRepository.GetIncidentCategoryInsights(ctx, filter)
 	if err != nil {
-		service.logger.Error("Failed to get incidents insights", zap.Error(err))
-		return nil, problems.FromError(err)
+		return nil, repositoryProblem(service.log(ctx), err)
 	}
 	return insights, nil
 }
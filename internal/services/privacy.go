@@ -0,0 +1,261 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/copier"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// erasureBatchSize limits how many accounts are erased in a single run
+const erasureBatchSize = 100
+
+type PrivacyService struct {
+	identityRepository *repositories.IdentityRepository
+	incidentRepository *repositories.IncidentRepository
+	auditRepository    *repositories.AuditRepository
+	identityService    *IdentityService
+	auditService       *AuditService
+	jwtHelper          *helpers.JwtHelper
+	logger             *zap.Logger
+}
+
+type SessionModel struct {
+	Id                    string    `json:"id"`
+	TokenType             string    `json:"tokenType"`
+	IssuedAt              time.Time `json:"issuedAt"`
+	AccessTokenExpiresAt  time.Time `json:"accessTokenExpiresAt"`
+	RefreshTokenExpiresAt time.Time `json:"refreshTokenExpiresAt"`
+}
+
+// AccountExportModel is the bundle of personal data held about a user
+type AccountExportModel struct {
+	ExportedAt time.Time         `json:"exportedAt"`
+	Account    AccountModel      `json:"account"`
+	Incidents  []IncidentModel   `json:"incidents"`
+	ApiKeys    []ApiKeyModel     `json:"apiKeys"`
+	Sessions   []SessionModel    `json:"sessions"`
+	Activity   []AuditEventModel `json:"activity"`
+}
+
+func NewPrivacyService(
+	identityRepository *repositories.IdentityRepository,
+	incidentRepository *repositories.IncidentRepository,
+	auditRepository *repositories.AuditRepository,
+	identityService *IdentityService,
+	auditService *AuditService,
+	jwtHelper *helpers.JwtHelper,
+	logger *zap.Logger,
+) *PrivacyService {
+	return &PrivacyService{
+		identityRepository,
+		incidentRepository,
+		auditRepository,
+		identityService,
+		auditService,
+		jwtHelper,
+		logger,
+	}
+}
+
+// log returns the request-scoped logger carried by ctx
+func (service *PrivacyService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+func (service *PrivacyService) ExportAccount(ctx context.Context, userId string) (*AccountExportModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "PrivacyService.ExportAccount")
+	defer span.End()
+
+	account, problem := service.identityService.GetAccountByUserId(ctx, userId)
+	if problem != nil {
+		return nil, problem
+	}
+
+	apiKeys, problem := service.identityService.GetApiKeys(ctx, userId)
+	if problem != nil {
+		return nil, problem
+	}
+
+	export := &AccountExportModel{
+		ExportedAt: time.Now(),
+		Account:    *account,
+		ApiKeys:    *apiKeys,
+	}
+
+	incidents, err := service.incidentRepository.GetIncidentsByReporterId(ctx, userId)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	export.Incidents = make([]IncidentModel, 0, len(incidents))
+	for _, item := range incidents {
+		model := &IncidentModel{}
+		if err := copier.Copy(model, &item); err != nil {
+			service.log(ctx).Error("Error copying incident to model: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+		export.Incidents = append(export.Incidents, *model)
+	}
+
+	tokens, err := service.identityRepository.GetTokensBySubject(ctx, userId)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+	export.Sessions = make([]SessionModel, 0, len(tokens))
+	for _, item := range tokens {
+		model := &SessionModel{}
+		if err := copier.Copy(model, &item); err != nil {
+			service.log(ctx).Error("Error copying token to model: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+		export.Sessions = append(export.Sessions, *model)
+	}
+
+	events, err := service.auditRepository.GetAuditEventsByUserId(ctx, userId)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	activity, problem := service.auditService.toAuditEventModels(ctx, events)
+	if problem != nil {
+		return nil, problem
+	}
+	export.Activity = activity
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountExported,
+		ActorId:    userId,
+		TargetType: models.AuditTargetUser,
+		TargetId:   userId,
+	})
+
+	return export, nil
+}
+
+// ExportAccountArchive returns the account export as a ZIP archive with one JSON file per section
+func (service *PrivacyService) ExportAccountArchive(ctx context.Context, userId string) ([]byte, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "PrivacyService.ExportAccountArchive")
+	defer span.End()
+
+	export, problem := service.ExportAccount(ctx, userId)
+	if problem != nil {
+		return nil, problem
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"account.json", export.Account},
+		{"incidents.json", export.Incidents},
+		{"apiKeys.json", export.ApiKeys},
+		{"sessions.json", export.Sessions},
+		{"activity.json", export.Activity},
+	}
+
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: export.ExportedAt,
+		})
+		if err != nil {
+			service.log(ctx).Error("Error creating export archive entry: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			service.log(ctx).Error("Error writing export archive entry: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		service.log(ctx).Error("Error closing export archive: ", zap.Error(err))
+		return nil, problems.FromError(err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// EraseScheduledAccounts permanently erases accounts whose erasure grace period has ended.
+// It returns the number of accounts erased. An account that cannot be erased is
+// skipped so that it does not hold back the others, and is retried on the next run.
+func (service *PrivacyService) EraseScheduledAccounts(ctx context.Context) (int, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "PrivacyService.EraseScheduledAccounts")
+	defer span.End()
+
+	users, err := service.identityRepository.GetUsersDueForErasure(ctx, time.Now(), erasureBatchSize)
+	if err != nil {
+		return 0, repositoryProblem(service.log(ctx), err)
+	}
+
+	erased, failed := 0, 0
+	for i := range users {
+		if problem := service.eraseAccount(ctx, &users[i]); problem != nil {
+			service.log(ctx).Error("Failed to erase account", zap.String("userId", users[i].Id), zap.String("detail", problem.Detail))
+			failed++
+			continue
+		}
+		erased++
+	}
+
+	if failed > 0 {
+		return erased, problems.NewProblem(http.StatusInternalServerError, localize(ctx, "%v of %v accounts due for erasure could not be erased.", failed, len(users)))
+	}
+
+	return erased, nil
+}
+
+// eraseAccount removes all personal data of a user. Each step can safely be
+// repeated, so a failed erasure is retried on the next run.
+func (service *PrivacyService) eraseAccount(ctx context.Context, user *models.User) *problems.Problem {
+	if err := service.incidentRepository.AnonymizeIncidentsByReporterId(ctx, user.Id); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.auditRepository.AnonymizeAuditEventsByUserId(ctx, user.Id); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.jwtHelper.RevokeAllTokens(user.Id); err != nil {
+		service.log(ctx).Error("Error revoking tokens: ", zap.Error(err))
+		return problems.FromError(err)
+	}
+
+	if err := service.identityRepository.PurgeApiKeysByUserId(ctx, user.Id); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.identityRepository.DeletePasswordHistoryByUserId(ctx, user.Id); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	if err := service.identityRepository.EraseUser(ctx, user); err != nil {
+		return repositoryProblem(service.log(ctx), err)
+	}
+
+	service.auditService.Record(ctx, AuditRecord{
+		Action:     models.AuditActionAccountErased,
+		TargetType: models.AuditTargetUser,
+		TargetId:   user.Id,
+	})
+
+	return nil
+}
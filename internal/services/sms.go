@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prince272/konabra/internal/builds"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	smsCommandStatus = "STATUS" // STATUS INC12345 looks up a report
+	smsCommandHelp   = "HELP"
+)
+
+// smsCommands are the words that start a command rather than a report, so they
+// cannot be used as category keywords
+var smsCommands = []string{smsCommandStatus, smsCommandHelp}
+
+// smsSeverityHints are the words of a report that set its severity
+var smsSeverityHints = map[string]models.IncidentSeverity{
+	"LOW":      models.IncidentSeverityLow,
+	"MINOR":    models.IncidentSeverityLow,
+	"MEDIUM":   models.IncidentSeverityMedium,
+	"MODERATE": models.IncidentSeverityMedium,
+	"HIGH":     models.IncidentSeverityHigh,
+	"SERIOUS":  models.IncidentSeverityHigh,
+	"SEVERE":   models.IncidentSeverityHigh,
+	"URGENT":   models.IncidentSeverityHigh,
+	"CRITICAL": models.IncidentSeverityHigh,
+	"FATAL":    models.IncidentSeverityHigh,
+}
+
+// smsDefaultSeverity is the severity of reports without a severity hint
+const smsDefaultSeverity = models.IncidentSeverityMedium
+
+// smsHelpKeywords is the number of keywords listed in the help reply
+const smsHelpKeywords = 8
+
+// smsDuplicateWindow is how long message ids are remembered, since providers
+// deliver a message again when they did not get an answer in time
+const smsDuplicateWindow = 24 * time.Hour
+
+// smsStatusLabels describe the status of a report to its reporter
+var smsStatusLabels = map[models.IncidentStatus]string{
+	models.IncidentStatusPending:       "Pending",
+	models.IncidentStatusInvestigating: "Being investigated",
+	models.IncidentStatusResolved:      "Resolved",
+	models.IncidentStatusFalseAlarm:    "Closed as a false alarm",
+}
+
+type SmsService struct {
+	categoryRepository *repositories.CategoryRepository
+	incidentRepository *repositories.IncidentRepository
+	identityService    *IdentityService
+	incidentService    *IncidentService
+	smsSender          helpers.SmsSender
+	validator          *helpers.Validator
+	state              *helpers.State
+	config             *builds.Config
+	logger             *zap.Logger
+}
+
+// InboundSmsForm is a message received by the provider, once mapped from its payload
+type InboundSmsForm struct {
+	Id   string `json:"id"` // Id given by the provider, used to ignore messages delivered twice
+	From string `json:"from" validate:"required"`
+	Text string `json:"text" validate:"max=1600"`
+}
+
+// SmsReplyModel is the reply sent back to the sender of a message
+type SmsReplyModel struct {
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+func NewSmsService(
+	categoryRepository *repositories.CategoryRepository,
+	incidentRepository *repositories.IncidentRepository,
+	identityService *IdentityService,
+	incidentService *IncidentService,
+	smsSender helpers.SmsSender,
+	validator *helpers.Validator,
+	state *helpers.State,
+	config *builds.Config,
+	logger *zap.Logger,
+) *SmsService {
+	return &SmsService{
+		categoryRepository,
+		incidentRepository,
+		identityService,
+		incidentService,
+		smsSender,
+		validator,
+		state,
+		config,
+		logger,
+	}
+}
+
+// log returns the request-scoped logger carried by ctx
+func (service *SmsService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+// ReceiveSms handles a message sent to the reporting number. A message such as
+// "ACC Kasoa toll booth 2 cars HIGH" reports an incident under the category with
+// the keyword ACC, and "STATUS INC12345" looks up a report. The sender gets the
+// outcome by SMS, which is returned too. Nil is returned for messages already
+// handled, and a 503 problem for messages to deliver again after a temporary failure.
+func (service *SmsService) ReceiveSms(ctx context.Context, form InboundSmsForm) (*SmsReplyModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "SmsService.ReceiveSms")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	phoneNumber, ok := helpers.NormalizePhoneNumber(form.From, service.config.PhoneDefaultRegion)
+	if !ok {
+		return nil, problems.NewValidationProblem(map[string]string{"from": "Phone number is not valid."})
+	}
+
+	key := "sms:received:" + form.Id
+	if form.Id != "" && !service.state.AddItem(key, true, smsDuplicateWindow) {
+		return nil, nil
+	}
+
+	message, failed := service.handleSms(ctx, phoneNumber, form.Text)
+	if failed {
+		// No reply is sent, the provider delivers the message again and it is
+		// handled once the failure is over
+		if form.Id != "" {
+			service.state.RemoveItem(key)
+		}
+		return nil, problems.NewProblem(http.StatusServiceUnavailable, "The service is unavailable. Please try again later.")
+	}
+	reply := &SmsReplyModel{To: phoneNumber, Message: message}
+
+	// A report is kept even when its acknowledgement cannot be sent
+	if err := service.smsSender.Send(ctx, reply.To, reply.Message); err != nil {
+		service.log(ctx).Error("Failed to send SMS reply", zap.Error(err))
+	}
+
+	return reply, nil
+}
+
+// handleSms returns the reply to a message, and whether it could not be handled
+// because of a temporary failure such as the database being unavailable
+func (service *SmsService) handleSms(ctx context.Context, phoneNumber string, text string) (string, bool) {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return service.help(ctx, "")
+	}
+
+	keyword := strings.ToUpper(words[0])
+	switch keyword {
+	case smsCommandHelp:
+		return service.help(ctx, "")
+	case smsCommandStatus:
+		return service.status(ctx, phoneNumber, words[1:])
+	default:
+		return service.report(ctx, phoneNumber, keyword, words[1:])
+	}
+}
+
+func (service *SmsService) report(ctx context.Context, phoneNumber string, keyword string, words []string) (string, bool) {
+	category, err := service.categoryRepository.GetCategoryByKeyword(ctx, keyword)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		service.log(ctx).Error("Repository error", zap.Error(err))
+		return smsUnavailable(ctx)
+	}
+
+	// Categories that need extra fields are left out of the help too, so their
+	// keywords read as unknown
+	if category == nil || !acceptsPhoneReports(*category) {
+		return service.help(ctx, localize(ctx, "Unknown keyword %v.", keyword))
+	}
+
+	severity, location := parseSmsReport(words)
+	if location == "" {
+		return localize(ctx, "Add where it happened, e.g. %v Kasoa toll booth.", keyword), false
+	}
+
+	account, problem := service.identityService.GetOrCreatePhoneAccount(ctx, phoneNumber)
+	if problem != nil {
+		return problem.WithContext(ctx).Detail, problem.Status >= http.StatusInternalServerError
+	}
+
+	// The sender is the author of the report, and of the account when it was just created
+	info := helpers.GetRequestInfo(ctx)
+	info.UserId = account.Id
+	ctx = helpers.WithRequestInfo(ctx, info)
+
+	form := CreateIncidentForm{
+		CategoryId: category.Id,
+		Summary:    truncateRunes(fmt.Sprintf("%v: %v", category.Name, location), 256),
+		Severity:   string(severity),
+		Location:   truncateRunes(location, 256),
+	}
+
+	incident, problem := service.incidentService.CreateIncident(ctx, account.Id, form)
+	if problem != nil {
+		service.log(ctx).Warn("Failed to create incident reported by SMS", zap.Int("status", problem.Status), zap.String("detail", problem.Detail))
+		return locales.Translate(locales.FromContext(ctx), "Your report could not be sent. Please try again later."), problem.Status >= http.StatusInternalServerError
+	}
+
+	return localize(ctx, "Thank you. Your report %v has been received. Send STATUS %v to follow it up.", incident.Code, incident.Code), false
+}
+
+// parseSmsReport takes the severity hints out of the words following the
+// keyword, and returns the words left as the location
+func parseSmsReport(words []string) (models.IncidentSeverity, string) {
+	severity := smsDefaultSeverity
+	var location []string
+	for _, word := range words {
+		if hint, ok := smsSeverityHints[strings.ToUpper(strings.Trim(word, ".,;:!"))]; ok {
+			severity = hint
+			continue
+		}
+		location = append(location, word)
+	}
+	return severity, strings.Join(location, " ")
+}
+
+// status looks up a report of the sender by its code. Reports of other people
+// are not disclosed.
+func (service *SmsService) status(ctx context.Context, phoneNumber string, words []string) (string, bool) {
+	if len(words) == 0 {
+		return locales.Translate(locales.FromContext(ctx), "Send STATUS and the code of your report, e.g. STATUS INC12345."), false
+	}
+	code := strings.ToUpper(words[0])
+
+	incident, err := service.incidentRepository.GetIncidentByCode(ctx, code)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		service.log(ctx).Error("Repository error", zap.Error(err))
+		return smsUnavailable(ctx)
+	}
+	if incident == nil || incident.ReportedBy == nil || incident.ReportedBy.PhoneNumber != phoneNumber {
+		return localize(ctx, "No report %v was found for your number.", code), false
+	}
+
+	status := locales.Translate(locales.FromContext(ctx), smsStatusLabels[incident.Status])
+	return localize(ctx, "Report %v: %v.", incident.Code, status), false
+}
+
+// help explains how to report by SMS, listing some of the keywords
+func (service *SmsService) help(ctx context.Context, notice string) (string, bool) {
+	locale := locales.FromContext(ctx)
+
+	lines := []string{}
+	if notice != "" {
+		lines = append(lines, notice)
+	}
+
+	categories, err := service.categoryRepository.GetCategories(ctx, false)
+	if err != nil {
+		service.log(ctx).Error("Repository error", zap.Error(err))
+		return smsUnavailable(ctx)
+	}
+
+	var keywords []string
+	for _, category := range categories {
+		if acceptsPhoneReports(category) && len(category.Keywords) > 0 {
+			keywords = append(keywords, category.Keywords[0])
+		}
+	}
+	if len(keywords) == 0 {
+		return strings.Join(append(lines, locales.Translate(locale, "No categories are available for reporting.")), " "), false
+	}
+
+	lines = append(lines,
+		localize(ctx, "Send a keyword and where it happened, e.g. %v Kasoa toll booth. Add HIGH or LOW for the severity.", keywords[0]),
+		localize(ctx, "Keywords: %v.", strings.Join(keywords[:min(len(keywords), smsHelpKeywords)], ", ")),
+	)
+	return strings.Join(lines, " "), false
+}
+
+// smsUnavailable is the reply to messages that hit a temporary failure
+func smsUnavailable(ctx context.Context) (string, bool) {
+	return locales.Translate(locales.FromContext(ctx), "The service is unavailable. Please try again later."), true
+}
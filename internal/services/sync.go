@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/copier"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// syncPageLimit is the number of incidents sent per page of changes when the client does not ask for fewer
+const syncPageLimit = 100
+
+// syncCommitMargin moves the time the next sync starts from back a little, so
+// that changes which were still being saved while the changes were read are not missed
+const syncCommitMargin = time.Minute
+
+const (
+	SyncActionCreate = "create" // Report an incident seen while offline
+	SyncActionUpdate = "update" // Edit an incident
+)
+
+const (
+	SyncStatusCreated   = "created"   // The incident was reported
+	SyncStatusUpdated   = "updated"   // The edit was applied
+	SyncStatusDuplicate = "duplicate" // The incident was reported by an earlier sync
+	SyncStatusConflict  = "conflict"  // The edit lost to a later change made by someone else
+	SyncStatusRejected  = "rejected"  // The item is not valid, see its problem
+)
+
+const (
+	SyncTombstoneIncident = "incident"
+	SyncTombstoneCategory = "category"
+)
+
+type SyncService struct {
+	incidentService    *IncidentService
+	incidentRepository *repositories.IncidentRepository
+	categoryRepository *repositories.CategoryRepository
+	validator          *helpers.Validator
+	logger             *zap.Logger
+}
+
+type SyncForm struct {
+	Items []SyncItemForm `json:"items" validate:"required,min=1,max=100"` // Applied in order, so an incident can be reported and edited in one batch
+}
+
+type SyncItemForm struct {
+	ClientId    string         `json:"clientId" validate:"required,uuid"` // Id of the incident. Reports made offline use an id generated by the device.
+	Action      string         `json:"action" validate:"required,oneof=create update" enum:"create,update"`
+	CapturedAt  time.Time      `json:"capturedAt" validate:"required"` // When the incident was seen, or when the edit was made
+	BaseVersion int64          `json:"baseVersion"`                    // Version of the incident the edit was made on
+	Incident    map[string]any `json:"incident" validate:"required"`   // The report for creates, or a JSON merge patch for updates
+}
+
+type SyncChangesFilter struct {
+	Since time.Time `json:"since" form:"since"` // Returns the changes made since this time, or every record when empty
+	After string    `json:"after" form:"after"` // Returns the changes that follow this cursor, sent with the same since
+	Limit int       `json:"limit" form:"limit"`
+}
+
+type SyncResultModel struct {
+	Items []SyncItemResultModel `json:"items"`
+}
+
+type SyncItemResultModel struct {
+	ClientId string            `json:"clientId"`
+	Status   string            `json:"status"`
+	Incident *IncidentModel    `json:"incident,omitempty"` // The incident as saved, which replaces the copy on the device
+	Problem  *problems.Problem `json:"problem,omitempty"`  // Why the item was rejected
+}
+
+type SyncTombstoneModel struct {
+	Type      string    `json:"type"` // incident or category
+	Id        string    `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+type SyncChangesModel struct {
+	Incidents  []IncidentModel      `json:"incidents"`
+	Categories []CategoryModel      `json:"categories"` // Sent with the first page only
+	Deleted    []SyncTombstoneModel `json:"deleted"`
+	NextCursor string               `json:"nextCursor,omitempty"` // Pass as after to read the next page
+	Until      time.Time            `json:"until"`                // Pass as since on the next sync, once every page was read
+}
+
+func NewSyncService(incidentService *IncidentService, incidentRepository *repositories.IncidentRepository, categoryRepository *repositories.CategoryRepository, validator *helpers.Validator, logger *zap.Logger) *SyncService {
+	return &SyncService{
+		incidentService,
+		incidentRepository,
+		categoryRepository,
+		validator,
+		logger,
+	}
+}
+
+// log returns the request-scoped logger carried by ctx
+func (service *SyncService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+// Sync applies a batch of reports and edits made on a device, each on its own.
+// An edit made on an older version of an incident is applied when it was made
+// after the latest change to the incident, otherwise it is reported as a conflict.
+func (service *SyncService) Sync(ctx context.Context, userId string, form SyncForm) (*SyncResultModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "SyncService.Sync")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	results := make([]SyncItemResultModel, 0, len(form.Items))
+	for _, item := range form.Items {
+		var result SyncItemResultModel
+		if err := ctx.Err(); err != nil {
+			result = SyncItemResultModel{Status: SyncStatusRejected, Problem: problems.FromError(err)}
+		} else if err := service.validator.ValidateStruct(item); err != nil {
+			result = SyncItemResultModel{Status: SyncStatusRejected, Problem: problems.FromError(err)}
+		} else if item.Action == SyncActionCreate {
+			result = service.syncCreate(ctx, userId, item)
+		} else {
+			result = service.syncUpdate(ctx, item)
+		}
+
+		result.ClientId = item.ClientId
+		if result.Problem != nil {
+			result.Problem = result.Problem.WithContext(ctx)
+		}
+		results = append(results, result)
+	}
+
+	return &SyncResultModel{Items: results}, nil
+}
+
+func (service *SyncService) syncCreate(ctx context.Context, userId string, item SyncItemForm) SyncItemResultModel {
+	if result, found := service.syncedIncident(ctx, userId, item.ClientId); found {
+		return result
+	}
+
+	form := CreateIncidentForm{}
+	if err := helpers.ApplyMergePatch(&form, item.Incident); err != nil {
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: problems.FromError(err)}
+	}
+
+	// Devices with a clock running ahead cannot report incidents in the future
+	reportedAt := item.CapturedAt
+	if now := time.Now(); reportedAt.After(now) {
+		reportedAt = now
+	}
+
+	model, problem := service.incidentService.createIncident(ctx, userId, item.ClientId, reportedAt, form)
+	if problem != nil {
+		// The same batch may have been sent again before the first one completed
+		if problem.Status == http.StatusConflict {
+			if result, found := service.syncedIncident(ctx, userId, item.ClientId); found {
+				return result
+			}
+		}
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: problem}
+	}
+
+	return SyncItemResultModel{Status: SyncStatusCreated, Incident: model}
+}
+
+// syncedIncident looks for an incident reported by an earlier sync. The id is
+// not accepted again when it belongs to an incident reported by someone else.
+func (service *SyncService) syncedIncident(ctx context.Context, userId string, id string) (SyncItemResultModel, bool) {
+	incident, err := service.incidentRepository.GetIncidentById(ctx, id)
+	if errors.Is(err, models.ErrNotFound) {
+		return SyncItemResultModel{}, false
+	}
+	if err != nil {
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: repositoryProblem(service.log(ctx), err)}, true
+	}
+
+	if incident.ReportedById == nil || *incident.ReportedById != userId {
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: problems.NewProblem(http.StatusConflict, "The client id is already used by another incident.")}, true
+	}
+
+	model := &IncidentModel{}
+	if err := copier.Copy(model, incident); err != nil {
+		service.log(ctx).Error("Copy error", zap.Error(err))
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: problems.FromError(err)}, true
+	}
+
+	return SyncItemResultModel{Status: SyncStatusDuplicate, Incident: model}, true
+}
+
+func (service *SyncService) syncUpdate(ctx context.Context, item SyncItemForm) SyncItemResultModel {
+	incident, err := service.incidentRepository.GetIncidentById(ctx, item.ClientId)
+	if errors.Is(err, models.ErrNotFound) {
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: problems.NewProblem(http.StatusNotFound, "Incident not found.")}
+	}
+	if err != nil {
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: repositoryProblem(service.log(ctx), err)}
+	}
+
+	// Devices with a clock running ahead cannot claim edits newer than the server's
+	capturedAt := item.CapturedAt
+	if now := time.Now(); capturedAt.After(now) {
+		capturedAt = now
+	}
+
+	if item.BaseVersion != incident.Version && !capturedAt.After(incident.UpdatedAt) {
+		model := &IncidentModel{}
+		if err := copier.Copy(model, incident); err != nil {
+			service.log(ctx).Error("Copy error", zap.Error(err))
+			return SyncItemResultModel{Status: SyncStatusRejected, Problem: problems.FromError(err)}
+		}
+		return SyncItemResultModel{Status: SyncStatusConflict, Incident: model}
+	}
+
+	// The version that was read is expected, so that a change saved in the
+	// meantime is reported as a conflict rather than overwritten
+	model, problem := service.incidentService.patchIncident(ctx, incident, item.Incident, &incident.Version)
+	if problem != nil {
+		if current, ok := problem.Current.(*IncidentModel); ok && problem.Status == http.StatusPreconditionFailed {
+			return SyncItemResultModel{Status: SyncStatusConflict, Incident: current}
+		}
+		return SyncItemResultModel{Status: SyncStatusRejected, Problem: problem}
+	}
+
+	return SyncItemResultModel{Status: SyncStatusUpdated, Incident: model}
+}
+
+// GetChanges returns the incidents and categories changed since the last sync,
+// with tombstones for the ones that were deleted. Incidents are paged, oldest
+// change first, and categories are sent with the first page.
+func (service *SyncService) GetChanges(ctx context.Context, filter SyncChangesFilter) (*SyncChangesModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "SyncService.GetChanges")
+	defer span.End()
+
+	until := time.Now().Add(-syncCommitMargin)
+
+	if filter.Limit <= 0 {
+		filter.Limit = syncPageLimit
+	}
+
+	incidents, page, err := service.incidentRepository.GetIncidentChanges(ctx, filter.Since, repositories.Page{After: filter.After, Limit: filter.Limit})
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	changes := &SyncChangesModel{
+		Incidents:  make([]IncidentModel, 0, len(incidents)),
+		Categories: []CategoryModel{},
+		Deleted:    []SyncTombstoneModel{},
+		NextCursor: page.NextCursor,
+		Until:      until,
+	}
+
+	for _, incident := range incidents {
+		if incident.DeletedAt.Valid {
+			changes.Deleted = append(changes.Deleted, SyncTombstoneModel{Type: SyncTombstoneIncident, Id: incident.Id, DeletedAt: incident.DeletedAt.Time})
+			continue
+		}
+
+		model := IncidentModel{}
+		if err := copier.Copy(&model, incident); err != nil {
+			service.log(ctx).Error("Error copying incident to model: ", zap.Error(err))
+			return nil, problems.FromError(err)
+		}
+		if incident.ReportedBy != nil {
+			model.ReportedBy = &AccountModel{}
+			if err := copier.Copy(model.ReportedBy, incident.ReportedBy); err != nil {
+				service.log(ctx).Error("Error copying reported by to model: ", zap.Error(err))
+				return nil, problems.FromError(err)
+			}
+		}
+		changes.Incidents = append(changes.Incidents, model)
+	}
+
+	if filter.After == "" {
+		categories, err := service.categoryRepository.GetCategoryChanges(ctx, filter.Since)
+		if err != nil {
+			return nil, repositoryProblem(service.log(ctx), err)
+		}
+
+		for _, category := range categories {
+			if category.DeletedAt.Valid {
+				changes.Deleted = append(changes.Deleted, SyncTombstoneModel{Type: SyncTombstoneCategory, Id: category.Id, DeletedAt: category.DeletedAt.Time})
+				continue
+			}
+
+			model := CategoryModel{}
+			if err := copier.Copy(&model, category); err != nil {
+				service.log(ctx).Error("Error copying category to model: ", zap.Error(err))
+				return nil, problems.FromError(err)
+			}
+			changes.Categories = append(changes.Categories, model)
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prince272/konabra/internal/builds"
+	"github.com/prince272/konabra/internal/helpers"
+	"github.com/prince272/konabra/internal/locales"
+	"github.com/prince272/konabra/internal/logging"
+	"github.com/prince272/konabra/internal/models"
+	"github.com/prince272/konabra/internal/problems"
+	"github.com/prince272/konabra/internal/repositories"
+	"github.com/prince272/konabra/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// ussdPageSize is the number of categories listed per screen. Screens of most
+// phones hold about 160 characters.
+const ussdPageSize = 5
+
+// ussdNameMaxLength is the length category names are cut to on a screen
+const ussdNameMaxLength = 24
+
+// ussdLocationMaxLength is the length of the longest location accepted
+const ussdLocationMaxLength = 100
+
+const (
+	ussdOptionBack = "0"
+	ussdOptionMore = "98"
+)
+
+type ussdStep string
+
+const (
+	ussdStepCategory ussdStep = "category"
+	ussdStepSeverity ussdStep = "severity"
+	ussdStepLocation ussdStep = "location"
+)
+
+// ussdSeverities are the severities offered to callers, in menu order
+var ussdSeverities = []struct {
+	severity models.IncidentSeverity
+	label    string
+}{
+	{models.IncidentSeverityLow, "Low"},
+	{models.IncidentSeverityMedium, "Medium"},
+	{models.IncidentSeverityHigh, "High"},
+}
+
+// ussdSession is the progress of a caller through the menus, kept between the
+// callbacks of a session
+type ussdSession struct {
+	Step         ussdStep
+	Text         string // Everything typed so far, as last sent by the aggregator
+	ParentId     string // Category whose subcategories are listed, empty for the top level
+	Page         int
+	CategoryId   string
+	CategoryName string
+	Severity     models.IncidentSeverity
+}
+
+type UssdService struct {
+	categoryRepository *repositories.CategoryRepository
+	identityService    *IdentityService
+	incidentService    *IncidentService
+	validator          *helpers.Validator
+	state              *helpers.State
+	config             *builds.Config
+	logger             *zap.Logger
+}
+
+// UssdForm is the callback USSD aggregators send for every screen of a session
+type UssdForm struct {
+	SessionId   string `json:"sessionId" form:"sessionId" validate:"required,max=128"`
+	ServiceCode string `json:"serviceCode" form:"serviceCode"`
+	PhoneNumber string `json:"phoneNumber" form:"phoneNumber" validate:"required"`
+	Text        string `json:"text" form:"text"` // Every input of the session joined by *, or only the latest input for some aggregators
+}
+
+// UssdScreenModel is the screen shown to the caller in reply to a callback
+type UssdScreenModel struct {
+	Message string
+	End     bool // The session ends with this screen
+}
+
+func NewUssdService(
+	categoryRepository *repositories.CategoryRepository,
+	identityService *IdentityService,
+	incidentService *IncidentService,
+	validator *helpers.Validator,
+	state *helpers.State,
+	config *builds.Config,
+	logger *zap.Logger,
+) *UssdService {
+	return &UssdService{
+		categoryRepository,
+		identityService,
+		incidentService,
+		validator,
+		state,
+		config,
+		logger,
+	}
+}
+
+// log returns the request-scoped logger carried by ctx
+func (service *UssdService) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, service.logger)
+}
+
+// HandleSession walks a caller through reporting an incident: choosing a
+// category, then a severity, then typing where it happened
+func (service *UssdService) HandleSession(ctx context.Context, form UssdForm) (*UssdScreenModel, *problems.Problem) {
+	ctx, span := tracing.Start(ctx, "UssdService.HandleSession")
+	defer span.End()
+
+	if err := service.validator.ValidateStruct(form); err != nil {
+		return nil, problems.FromError(err)
+	}
+
+	phoneNumber, ok := helpers.NormalizePhoneNumber(form.PhoneNumber, service.config.PhoneDefaultRegion)
+	if !ok {
+		return nil, problems.NewValidationProblem(map[string]string{"phoneNumber": "Phone number is not valid."})
+	}
+
+	// Sessions are keyed by caller too, so that a guessed session id is of no use
+	key := fmt.Sprintf("ussd:session:%v:%v", phoneNumber, form.SessionId)
+
+	var screen *UssdScreenModel
+	session, _ := service.state.PeekItem(key).(*ussdSession)
+	if session == nil {
+		// The first callback may carry input typed as part of the dialled code
+		session = &ussdSession{Step: ussdStepCategory, Text: form.Text}
+		screen = service.categoryMenu(ctx, session, "")
+	} else {
+		screen = service.next(ctx, session, phoneNumber, session.input(form.Text))
+	}
+
+	if screen.End {
+		service.state.RemoveItem(key)
+	} else {
+		service.state.SetItem(key, session, service.config.UssdSessionTimeout)
+	}
+
+	return screen, nil
+}
+
+// input returns what the caller typed on the last screen
+func (session *ussdSession) input(text string) string {
+	input := text
+	if session.Text != "" {
+		if latest, found := strings.CutPrefix(text, session.Text+"*"); found {
+			input = latest
+		}
+	}
+	session.Text = text
+	return strings.TrimSpace(input)
+}
+
+func (service *UssdService) next(ctx context.Context, session *ussdSession, phoneNumber string, input string) *UssdScreenModel {
+	switch session.Step {
+	case ussdStepCategory:
+		return service.chooseCategory(ctx, session, input)
+	case ussdStepSeverity:
+		return service.chooseSeverity(ctx, session, input)
+	default:
+		return service.report(ctx, session, phoneNumber, input)
+	}
+}
+
+func (service *UssdService) categoryMenu(ctx context.Context, session *ussdSession, notice string) *UssdScreenModel {
+	categories, problem := service.listCategories(ctx, session.ParentId)
+	if problem != nil {
+		return ussdEnd(ctx, "The service is unavailable. Please try again later.")
+	}
+	if len(categories) == 0 {
+		return ussdEnd(ctx, "No categories are available for reporting.")
+	}
+
+	start := session.Page * ussdPageSize
+	if start >= len(categories) {
+		session.Page, start = 0, 0
+	}
+	end := min(start+ussdPageSize, len(categories))
+
+	lines := []string{}
+	if notice != "" {
+		lines = append(lines, locales.Translate(locales.FromContext(ctx), notice))
+	}
+	lines = append(lines, locales.Translate(locales.FromContext(ctx), "Choose a category:"))
+	for i, category := range categories[start:end] {
+		lines = append(lines, fmt.Sprintf("%d. %v", i+1, truncateRunes(category.Name, ussdNameMaxLength)))
+	}
+	if end < len(categories) {
+		lines = append(lines, localize(ctx, "%v. More", ussdOptionMore))
+	}
+	if session.ParentId != "" {
+		lines = append(lines, localize(ctx, "%v. Back", ussdOptionBack))
+	}
+
+	return &UssdScreenModel{Message: strings.Join(lines, "\n")}
+}
+
+func (service *UssdService) chooseCategory(ctx context.Context, session *ussdSession, input string) *UssdScreenModel {
+	switch {
+	case input == ussdOptionMore:
+		session.Page++
+		return service.categoryMenu(ctx, session, "")
+	case input == ussdOptionBack && session.ParentId != "":
+		session.ParentId, session.Page = "", 0
+		return service.categoryMenu(ctx, session, "")
+	}
+
+	categories, problem := service.listCategories(ctx, session.ParentId)
+	if problem != nil {
+		return ussdEnd(ctx, "The service is unavailable. Please try again later.")
+	}
+
+	choice, err := strconv.Atoi(input)
+	index := session.Page*ussdPageSize + choice - 1
+	if err != nil || choice < 1 || choice > ussdPageSize || index >= len(categories) {
+		return service.categoryMenu(ctx, session, "Invalid choice.")
+	}
+	category := categories[index]
+
+	if session.ParentId == "" {
+		children, problem := service.listCategories(ctx, category.Id)
+		if problem != nil {
+			return ussdEnd(ctx, "The service is unavailable. Please try again later.")
+		}
+		if len(children) > 0 {
+			session.ParentId, session.Page = category.Id, 0
+			return service.categoryMenu(ctx, session, "")
+		}
+	}
+
+	session.CategoryId, session.CategoryName = category.Id, category.Name
+	session.Step = ussdStepSeverity
+	return service.severityMenu(ctx, "")
+}
+
+func (service *UssdService) severityMenu(ctx context.Context, notice string) *UssdScreenModel {
+	locale := locales.FromContext(ctx)
+
+	lines := []string{}
+	if notice != "" {
+		lines = append(lines, locales.Translate(locale, notice))
+	}
+	lines = append(lines, locales.Translate(locale, "Choose the severity:"))
+	for i, option := range ussdSeverities {
+		lines = append(lines, fmt.Sprintf("%d. %v", i+1, locales.Translate(locale, option.label)))
+	}
+	lines = append(lines, localize(ctx, "%v. Back", ussdOptionBack))
+
+	return &UssdScreenModel{Message: strings.Join(lines, "\n")}
+}
+
+func (service *UssdService) chooseSeverity(ctx context.Context, session *ussdSession, input string) *UssdScreenModel {
+	if input == ussdOptionBack {
+		session.Step = ussdStepCategory
+		return service.categoryMenu(ctx, session, "")
+	}
+
+	choice, err := strconv.Atoi(input)
+	if err != nil || choice < 1 || choice > len(ussdSeverities) {
+		return service.severityMenu(ctx, "Invalid choice.")
+	}
+
+	session.Severity = ussdSeverities[choice-1].severity
+	session.Step = ussdStepLocation
+	return &UssdScreenModel{Message: locales.Translate(locales.FromContext(ctx), "Where did it happen? Type a short location:")}
+}
+
+func (service *UssdService) report(ctx context.Context, session *ussdSession, phoneNumber string, location string) *UssdScreenModel {
+	if location == "" || len([]rune(location)) > ussdLocationMaxLength {
+		return &UssdScreenModel{Message: locales.Translate(locales.FromContext(ctx), "Type a short location, such as a town or landmark:")}
+	}
+
+	account, problem := service.identityService.GetOrCreatePhoneAccount(ctx, phoneNumber)
+	if problem != nil {
+		return &UssdScreenModel{Message: problem.WithContext(ctx).Detail, End: true}
+	}
+
+	// The caller is the author of the report, and of the account when it was just created
+	info := helpers.GetRequestInfo(ctx)
+	info.UserId = account.Id
+	ctx = helpers.WithRequestInfo(ctx, info)
+
+	form := CreateIncidentForm{
+		CategoryId: session.CategoryId,
+		Summary:    truncateRunes(fmt.Sprintf("%v: %v", session.CategoryName, location), 256),
+		Severity:   string(session.Severity),
+		Location:   location,
+	}
+
+	incident, problem := service.incidentService.CreateIncident(ctx, account.Id, form)
+	if problem != nil {
+		service.log(ctx).Warn("Failed to create incident reported by USSD", zap.Int("status", problem.Status), zap.String("detail", problem.Detail))
+		return ussdEnd(ctx, "Your report could not be sent. Please try again later.")
+	}
+
+	return &UssdScreenModel{Message: localize(ctx, "Thank you. Your report %v has been received.", incident.Code), End: true}
+}
+
+// listCategories returns the categories offered under a parent, or the top-level
+// ones for an empty parent. Categories that need extra fields cannot be reported
+// on from a phone, so they are left out unless they lead to subcategories.
+func (service *UssdService) listCategories(ctx context.Context, parentId string) ([]models.Category, *problems.Problem) {
+	categories, err := service.categoryRepository.GetCategories(ctx, false)
+	if err != nil {
+		return nil, repositoryProblem(service.log(ctx), err)
+	}
+
+	hasChildren := map[string]bool{}
+	for _, category := range categories {
+		if category.ParentId != nil && *category.ParentId != "" && acceptsPhoneReports(category) {
+			hasChildren[*category.ParentId] = true
+		}
+	}
+
+	var listed []models.Category
+	for _, category := range categories {
+		categoryParentId := ""
+		if category.ParentId != nil {
+			categoryParentId = *category.ParentId
+		}
+		if categoryParentId != parentId {
+			continue
+		}
+		if acceptsPhoneReports(category) || (parentId == "" && hasChildren[category.Id]) {
+			listed = append(listed, category)
+		}
+	}
+
+	return listed, nil
+}
+
+// acceptsPhoneReports reports whether a category can be reported on without
+// filling in extra fields
+func acceptsPhoneReports(category models.Category) bool {
+	required, _ := category.Schema["required"].([]any)
+	return len(required) == 0
+}
+
+func ussdEnd(ctx context.Context, message string) *UssdScreenModel {
+	return &UssdScreenModel{Message: locales.Translate(locales.FromContext(ctx), message), End: true}
+}
+
+func truncateRunes(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length])
+}
@@ -0,0 +1,183 @@
+// Package tracing sets up OpenTelemetry tracing for HTTP requests, service
+// methods and database statements.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const instrumentationName = "github.com/prince272/konabra"
+
+const (
+	ExporterNone   = "none"   // Spans are created for propagation but not exported
+	ExporterStdout = "stdout" // Spans are written to standard output, for local use
+	ExporterOtlp   = "otlp"   // Spans are sent to an OTLP/HTTP collector
+)
+
+type Options struct {
+	ServiceName string
+	Exporter    string
+	Endpoint    string // OTLP/HTTP endpoint URL, defaults to OTEL_EXPORTER_OTLP_ENDPOINT
+	SampleRatio float64
+}
+
+type Tracing struct {
+	provider    *sdktrace.TracerProvider
+	serviceName string
+}
+
+// NewTracing creates the tracer provider and installs it, along with W3C trace
+// context and baggage propagation, as the global provider
+func NewTracing(options Options) (*Tracing, error) {
+	providerOptions := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(options.ServiceName))),
+	}
+
+	switch options.Exporter {
+	case ExporterNone:
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+		providerOptions = append(providerOptions, sdktrace.WithBatcher(exporter))
+	case ExporterOtlp:
+		var exporterOptions []otlptracehttp.Option
+		if options.Endpoint != "" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithEndpointURL(options.Endpoint))
+		}
+		exporter, err := otlptracehttp.New(context.Background(), exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		providerOptions = append(providerOptions, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", options.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOptions...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return &Tracing{provider, options.ServiceName}, nil
+}
+
+// Shutdown flushes the spans that have not been exported yet
+func (tracing *Tracing) Shutdown(ctx context.Context) error {
+	return tracing.provider.Shutdown(ctx)
+}
+
+// Middleware starts a span for every request, continuing the trace of the
+// caller when a traceparent header is present. Probe and metrics requests are
+// not traced.
+func (tracing *Tracing) Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(tracing.serviceName,
+		otelgin.WithTracerProvider(tracing.provider),
+		otelgin.WithFilter(func(request *http.Request) bool {
+			switch request.URL.Path {
+			case "/healthz", "/readyz", "/metrics":
+				return false
+			}
+			return true
+		}))
+}
+
+// Start starts a span as a child of the span in the context
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// TraceId returns the id of the trace in the context, or an empty string when there is none
+func TraceId(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// SpanId returns the id of the span in the context, or an empty string when there is none
+func SpanId(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasSpanID() {
+		return ""
+	}
+	return spanContext.SpanID().String()
+}
+
+const spanKey = "tracing:span"
+
+// InstrumentDB registers GORM callbacks that create a span for every statement.
+// Statements are only attached to the request trace when run with WithContext.
+func (tracing *Tracing) InstrumentDB(db *gorm.DB) error {
+	tracer := tracing.provider.Tracer(instrumentationName)
+
+	before := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			ctx, span := tracer.Start(tx.Statement.Context, "gorm."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemPostgreSQL))
+			tx.Statement.Context = ctx
+			tx.InstanceSet(spanKey, span)
+		}
+	}
+
+	after := func(tx *gorm.DB) {
+		value, ok := tx.InstanceGet(spanKey)
+		if !ok {
+			return
+		}
+
+		span, ok := value.(trace.Span)
+		if !ok {
+			return
+		}
+		defer span.End()
+
+		span.SetAttributes(
+			semconv.DBQueryText(tx.Statement.SQL.String()),
+			semconv.DBCollectionName(tx.Statement.Table),
+			attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+		)
+
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+			span.SetStatus(codes.Error, tx.Error.Error())
+		}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("gorm:create").Register("tracing:before_create", before("create")),
+		callbacks.Create().After("gorm:create").Register("tracing:after_create", after),
+		callbacks.Query().Before("gorm:query").Register("tracing:before_query", before("query")),
+		callbacks.Query().After("gorm:query").Register("tracing:after_query", after),
+		callbacks.Update().Before("gorm:update").Register("tracing:before_update", before("update")),
+		callbacks.Update().After("gorm:update").Register("tracing:after_update", after),
+		callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete")),
+		callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", after),
+		callbacks.Row().Before("gorm:row").Register("tracing:before_row", before("row")),
+		callbacks.Row().After("gorm:row").Register("tracing:after_row", after),
+		callbacks.Raw().Before("gorm:raw").Register("tracing:before_raw", before("raw")),
+		callbacks.Raw().After("gorm:raw").Register("tracing:after_raw", after),
+	)
+}
@@ -134,3 +134,8 @@ func MustGetWithKey[T any](c *Container, key string) T {
 	}
 	return service
 }
+
+// Invoke calls the function with its parameters resolved from the container
+func (container *Container) Invoke(function any) error {
+	return container.inner.Invoke(function)
+}
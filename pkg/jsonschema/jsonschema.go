@@ -0,0 +1,287 @@
+// Package jsonschema implements the small subset of JSON Schema used to
+// describe the extra fields of an incident report.
+//
+// Supported keywords: $schema, type (object, string, integer, number, boolean, array),
+// title, description, properties, required, additionalProperties (boolean),
+// enum, minLength, maxLength, pattern, minimum, maximum, items, minItems and maxItems.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a parsed JSON schema
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Error describes a value that does not match the schema
+type Error struct {
+	Path    string // Dot separated path of the invalid value, empty for the root
+	Message string
+}
+
+var supportedTypes = map[string]bool{
+	"object":  true,
+	"string":  true,
+	"integer": true,
+	"number":  true,
+	"boolean": true,
+	"array":   true,
+}
+
+// Parse builds a schema from its decoded JSON representation and checks that
+// it only uses supported keywords
+func Parse(document map[string]any) (*Schema, error) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+
+	schema := &Schema{}
+	if err := decoder.Decode(schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	if err := schema.compile(""); err != nil {
+		return nil, err
+	}
+
+	if schema.Type != "object" {
+		return nil, fmt.Errorf("invalid schema: root must be an object")
+	}
+
+	return schema, nil
+}
+
+func (schema *Schema) compile(path string) error {
+	if schema.Type == "" {
+		if path != "" {
+			return fmt.Errorf("invalid schema: %s must declare a type", path)
+		}
+		schema.Type = "object"
+	}
+
+	if !supportedTypes[schema.Type] {
+		return fmt.Errorf("invalid schema: unsupported type %q at %s", schema.Type, displayPath(path))
+	}
+
+	if schema.Pattern != "" {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema: bad pattern at %s: %w", displayPath(path), err)
+		}
+		schema.pattern = pattern
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			return fmt.Errorf("invalid schema: required property %q is not defined at %s", name, displayPath(path))
+		}
+	}
+
+	for name, property := range schema.Properties {
+		if property == nil {
+			return fmt.Errorf("invalid schema: property %q is empty", joinPath(path, name))
+		}
+		if err := property.compile(joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+
+	if schema.Items != nil {
+		if err := schema.Items.compile(joinPath(path, "items")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate checks a decoded JSON value against the schema and returns every violation found
+func (schema *Schema) Validate(value any) []Error {
+	var errors []Error
+	schema.validate("", value, &errors)
+	return errors
+}
+
+func (schema *Schema) validate(path string, value any, errors *[]Error) {
+	fail := func(format string, args ...any) {
+		*errors = append(*errors, Error{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			fail("must be an object")
+			return
+		}
+
+		for _, name := range schema.Required {
+			if item, ok := object[name]; !ok || item == nil {
+				*errors = append(*errors, Error{Path: joinPath(path, name), Message: "is required"})
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					*errors = append(*errors, Error{Path: joinPath(path, name), Message: "is not allowed"})
+				}
+				continue
+			}
+			if object[name] == nil {
+				continue
+			}
+			property.validate(joinPath(path, name), object[name], errors)
+		}
+
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			return
+		}
+
+		length := utf8.RuneCountInString(text)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			fail("must be at least %d characters long", *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			fail("must be at most %d characters long", *schema.MaxLength)
+		}
+		if schema.pattern != nil && !schema.pattern.MatchString(text) {
+			fail("is not in the expected format")
+		}
+
+	case "integer", "number":
+		number, ok := toNumber(value)
+		if !ok {
+			fail("must be a number")
+			return
+		}
+
+		if schema.Type == "integer" && number != math.Trunc(number) {
+			fail("must be a whole number")
+			return
+		}
+		if schema.Minimum != nil && number < *schema.Minimum {
+			fail("must be greater than or equal to %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			fail("must be less than or equal to %v", *schema.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be true or false")
+			return
+		}
+
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			fail("must be a list")
+			return
+		}
+
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			fail("must contain at least %d items", *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			fail("must contain at most %d items", *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			for i, item := range items {
+				schema.Items.validate(joinPath(path, fmt.Sprint(i)), item, errors)
+			}
+		}
+	}
+
+	if len(schema.Enum) > 0 && !containsValue(schema.Enum, value) {
+		fail("must be one of the allowed values")
+	}
+}
+
+func toNumber(value any) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case json.Number:
+		parsed, err := number.Float64()
+		return parsed, err == nil
+	}
+	return 0, false
+}
+
+func containsValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if candidateNumber, ok := toNumber(candidate); ok {
+			if number, ok := toNumber(value); ok && number == candidateNumber {
+				return true
+			}
+			continue
+		}
+		switch candidate.(type) {
+		case string, bool:
+			if candidate == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "root"
+	}
+	return path
+}